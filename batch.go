@@ -42,6 +42,10 @@ const (
 // batch is not indexed and thus doesn't support reads.
 var ErrNotIndexed = errors.New("pebble: batch not indexed")
 
+// ErrNoSavePoint is returned by Batch.RollbackToSavePoint and
+// Batch.PopSavePoint when the batch has no save point.
+var ErrNoSavePoint = errors.New("pebble: batch has no save point")
+
 // ErrInvalidBatch indicates that a batch is invalid or otherwise corrupted.
 var ErrInvalidBatch = batchrepr.ErrInvalidBatch
 
@@ -333,6 +337,9 @@ type batchInternal struct {
 	// memtable.
 	flushable *flushableBatch
 
+	// The save points recorded by SetSavePoint, most recent last.
+	savePoints []batchSavePoint
+
 	// minimumFormatMajorVersion indicates the format major version required in
 	// order to commit this batch. If an operation requires a particular format
 	// major version, it ratchets the batch's minimumFormatMajorVersion. When
@@ -361,6 +368,12 @@ type batchInternal struct {
 
 	commitErr error
 
+	// validate, if set, is invoked by the commit pipeline with
+	// commitPipeline.mu held, once every batch sequenced before this one is
+	// visible and before this batch is sequenced. If it returns an error, the
+	// batch is not committed and the error is returned from Apply.
+	validate func() error
+
 	// Position bools together to reduce the sizeof the struct.
 
 	// ingestedSSTBatch indicates that the batch contains one or more key kinds
@@ -1198,6 +1211,123 @@ func (b *Batch) ingestSST(fileNum base.FileNum) {
 	b.minimumFormatMajorVersion = FormatFlushableIngest
 }
 
+// batchSavePoint records the state of a Batch at the time of a call to
+// SetSavePoint.
+type batchSavePoint struct {
+	dataLen                   int
+	count                     uint64
+	countRangeDels            uint64
+	countRangeKeys            uint64
+	memTableSize              uint64
+	minimumFormatMajorVersion FormatMajorVersion
+	ingestedSSTBatch          bool
+	// The checkpoints of the batch's indexes, if the batch is indexed. A nil
+	// rangeDelIndex or rangeKeyIndex at the save point is recorded as a false
+	// hasRangeDelIndex or hasRangeKeyIndex.
+	index            batchskl.Checkpoint
+	rangeDelIndex    batchskl.Checkpoint
+	rangeKeyIndex    batchskl.Checkpoint
+	hasRangeDelIndex bool
+	hasRangeKeyIndex bool
+}
+
+// SetSavePoint records the current state of the batch, so that the mutations
+// added after it can later be undone with RollbackToSavePoint. Save points
+// nest: each call to RollbackToSavePoint or PopSavePoint applies to the most
+// recent save point that has not yet been rolled back or popped. Save points
+// are discarded by Reset and SetRepr. A save point must not be set while a
+// deferred operation is unfinished.
+func (b *Batch) SetSavePoint() {
+	if b.committing {
+		panic("pebble: batch already committing")
+	}
+	sp := batchSavePoint{
+		dataLen:                   len(b.data),
+		count:                     b.count,
+		countRangeDels:            b.countRangeDels,
+		countRangeKeys:            b.countRangeKeys,
+		memTableSize:              b.memTableSize,
+		minimumFormatMajorVersion: b.minimumFormatMajorVersion,
+		ingestedSSTBatch:          b.ingestedSSTBatch,
+	}
+	if b.index != nil {
+		sp.index = b.index.Checkpoint()
+	}
+	if b.rangeDelIndex != nil {
+		sp.rangeDelIndex = b.rangeDelIndex.Checkpoint()
+		sp.hasRangeDelIndex = true
+	}
+	if b.rangeKeyIndex != nil {
+		sp.rangeKeyIndex = b.rangeKeyIndex.Checkpoint()
+		sp.hasRangeKeyIndex = true
+	}
+	b.savePoints = append(b.savePoints, sp)
+}
+
+// RollbackToSavePoint undoes every mutation added to the batch since the most
+// recent save point, and removes that save point. It returns ErrNoSavePoint if
+// the batch has no save point. Iterators over the batch must not be used after
+// RollbackToSavePoint without first being refreshed with RefreshBatchSnapshot
+// or SetOptions.
+func (b *Batch) RollbackToSavePoint() error {
+	if b.committing {
+		panic("pebble: batch already committing")
+	}
+	n := len(b.savePoints)
+	if n == 0 {
+		return ErrNoSavePoint
+	}
+	sp := b.savePoints[n-1]
+	b.savePoints = b.savePoints[:n-1]
+
+	if b.index != nil {
+		if err := b.index.Truncate(sp.index); err != nil {
+			return err
+		}
+	}
+	if b.rangeDelIndex != nil {
+		if !sp.hasRangeDelIndex {
+			b.rangeDelIndex = nil
+		} else if err := b.rangeDelIndex.Truncate(sp.rangeDelIndex); err != nil {
+			return err
+		}
+	}
+	if b.rangeKeyIndex != nil {
+		if !sp.hasRangeKeyIndex {
+			b.rangeKeyIndex = nil
+		} else if err := b.rangeKeyIndex.Truncate(sp.rangeKeyIndex); err != nil {
+			return err
+		}
+	}
+	if sp.countRangeDels != b.countRangeDels {
+		b.tombstones = nil
+		b.tombstonesSeqNum = 0
+	}
+	if sp.countRangeKeys != b.countRangeKeys {
+		b.rangeKeys = nil
+		b.rangeKeysSeqNum = 0
+	}
+	b.data = b.data[:sp.dataLen]
+	b.count = sp.count
+	b.countRangeDels = sp.countRangeDels
+	b.countRangeKeys = sp.countRangeKeys
+	b.memTableSize = sp.memTableSize
+	b.minimumFormatMajorVersion = sp.minimumFormatMajorVersion
+	b.ingestedSSTBatch = sp.ingestedSSTBatch
+	return nil
+}
+
+// PopSavePoint removes the most recent save point without undoing any
+// mutations. It returns ErrNoSavePoint if the batch has no save point.
+func (b *Batch) PopSavePoint() error {
+	n := len(b.savePoints)
+	if n == 0 {
+		return ErrNoSavePoint
+	}
+	b.savePoints = b.savePoints[:n-1]
+	return nil
+}
+
 // Empty returns true if the batch is empty, and false otherwise.
 func (b *Batch) Empty() bool {
 	return batchrepr.IsEmpty(b.data)
@@ -1232,6 +1362,7 @@ func (b *Batch) SetRepr(data []byte) error {
 	}
 	b.data = data
 	b.count = uint64(h.Count)
+	b.savePoints = nil
 	var err error
 	if b.db != nil {
 		// Only track memTableSize for batches that will be committed to the DB.
@@ -1576,7 +1707,9 @@ func (b *Batch) reset() {
 		}
 	}
 	if b.index != nil {
-		b.index.Init(&b.data, b.cmp, b.abbreviatedKey)
+		// Retain the index's nodes, subject to the same bound as the data, so
+		// that reusing an indexed batch does not reallocate them.
+		b.index.ResetWithCap(&b.data, b.opts.maxRetainedSizeBytes)
 	}
 }
 
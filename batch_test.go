@@ -417,6 +417,59 @@ func TestBatchReset(t *testing.T) {
 	require.Equal(t, v, []byte(value))
 }
 
+func TestIndexedBatchResetRetainsIndex(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem(), Comparer: testkeys.Comparer})
+	require.NoError(t, err)
+	defer d.Close()
+	b := d.NewIndexedBatch()
+	defer b.Close()
+	keys := make([][]byte, 100)
+	for i := range keys {
+		keys[i] = []byte(fmt.Sprintf("k%02d@%d", i/4, i%4+1))
+	}
+	fill := func() {
+		for _, key := range keys {
+			require.NoError(t, b.Set(key, nil, nil))
+		}
+	}
+	check := func() {
+		iter, err := b.NewIter(nil)
+		require.NoError(t, err)
+		var n int
+		for valid := iter.First(); valid; valid = iter.Next() {
+			// testkeys sorts the versions of a key by descending suffix.
+			require.Equal(t, fmt.Sprintf("k%02d@%d", n/4, 4-n%4), string(iter.Key()))
+			n++
+		}
+		require.Equal(t, 100, n)
+		require.NoError(t, iter.Close())
+	}
+	fill()
+	check()
+
+	// The index nodes of a small batch are retained along with its data, so
+	// that reusing the batch does not allocate.
+	allocs := testing.AllocsPerRun(10, func() {
+		b.Reset()
+		fill()
+	})
+	require.Zero(t, allocs)
+	check()
+
+	// Index nodes beyond the maximum retained size are dropped, while the data,
+	// which is smaller, is still retained.
+	b.opts.maxRetainedSizeBytes = 2 << 10
+	require.Less(t, cap(b.data), b.opts.maxRetainedSizeBytes)
+	dataCap := cap(b.data)
+	allocs = testing.AllocsPerRun(10, func() {
+		b.Reset()
+		fill()
+	})
+	require.NotZero(t, allocs)
+	require.Equal(t, dataCap, cap(b.data))
+	check()
+}
+
 func TestBatchReuse(t *testing.T) {
 	db, err := Open("", &Options{
 		FS: vfs.NewMem(),
@@ -592,6 +645,104 @@ func TestIndexedBatchReset(t *testing.T) {
 
 // TestIndexedBatchMutation tests mutating an indexed batch with an open
 // iterator.
+func TestBatchSavePoint(t *testing.T) {
+	db, err := Open("", &Options{
+		FS: vfs.NewMem(),
+	})
+	require.NoError(t, err)
+	defer db.Close()
+
+	get := func(b *Batch, key string) string {
+		v, closer, err := b.Get([]byte(key))
+		if err == ErrNotFound {
+			return "<not found>"
+		}
+		require.NoError(t, err)
+		defer closer.Close()
+		return string(v)
+	}
+
+	for _, indexed := range []bool{false, true} {
+		t.Run(fmt.Sprintf("indexed=%t", indexed), func(t *testing.T) {
+			b := db.NewBatch()
+			if indexed {
+				b = db.NewIndexedBatch()
+			}
+			defer b.Close()
+			require.Equal(t, ErrNoSavePoint, b.RollbackToSavePoint())
+			require.Equal(t, ErrNoSavePoint, b.PopSavePoint())
+
+			// A save point on an empty batch rolls back to an empty batch.
+			b.SetSavePoint()
+			require.NoError(t, b.Set([]byte("x"), []byte("1"), nil))
+			require.NoError(t, b.RollbackToSavePoint())
+			require.True(t, b.Empty())
+			require.Equal(t, uint32(0), b.Count())
+
+			require.NoError(t, b.Set([]byte("a"), []byte("1"), nil))
+			repr := append([]byte(nil), b.Repr()...)
+			memTableSize := b.memTableSize
+
+			b.SetSavePoint()
+			require.NoError(t, b.Set([]byte("b"), []byte("1"), nil))
+			b.SetSavePoint()
+			require.NoError(t, b.DeleteRange([]byte("a"), []byte("z"), nil))
+			require.NoError(t, b.RangeKeySet([]byte("a"), []byte("z"), nil, []byte("v"), nil))
+			require.NoError(t, b.Set([]byte("c"), []byte("1"), nil))
+			if indexed {
+				require.Equal(t, "<not found>", get(b, "a"))
+				require.Equal(t, "1", get(b, "c"))
+			}
+
+			// Rolling back the inner save point undoes the range deletion and
+			// range key, but not the write of b.
+			require.NoError(t, b.RollbackToSavePoint())
+			require.Equal(t, uint32(2), b.Count())
+			require.Zero(t, b.countRangeDels)
+			require.Zero(t, b.countRangeKeys)
+			if indexed {
+				require.Nil(t, b.rangeDelIndex)
+				require.Nil(t, b.rangeKeyIndex)
+				require.Equal(t, "1", get(b, "a"))
+				require.Equal(t, "1", get(b, "b"))
+				require.Equal(t, "<not found>", get(b, "c"))
+			}
+
+			// Rolling back the outer save point restores the batch exactly.
+			require.NoError(t, b.RollbackToSavePoint())
+			require.Equal(t, repr, b.Repr())
+			require.Equal(t, memTableSize, b.memTableSize)
+			if indexed {
+				require.Equal(t, "<not found>", get(b, "b"))
+			}
+			require.Equal(t, ErrNoSavePoint, b.RollbackToSavePoint())
+
+			// A popped save point is no longer rolled back to.
+			b.SetSavePoint()
+			b.SetSavePoint()
+			require.NoError(t, b.Set([]byte("d"), []byte("1"), nil))
+			require.NoError(t, b.PopSavePoint())
+			require.NoError(t, b.Set([]byte("e"), []byte("1"), nil))
+			require.NoError(t, b.RollbackToSavePoint())
+			require.Equal(t, repr, b.Repr())
+
+			// Mutations after a rollback are applied along with the surviving
+			// mutations.
+			require.NoError(t, b.Set([]byte("f"), []byte("1"), nil))
+			if indexed {
+				iter, err := b.NewIter(nil)
+				require.NoError(t, err)
+				var keys []string
+				for valid := iter.First(); valid; valid = iter.Next() {
+					keys = append(keys, string(iter.Key()))
+				}
+				require.NoError(t, iter.Close())
+				require.Equal(t, []string{"a", "f"}, keys)
+			}
+		})
+	}
+}
+
 func TestIndexedBatchMutation(t *testing.T) {
 	opts := &Options{
 		Comparer:           testkeys.Comparer,
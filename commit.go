@@ -10,6 +10,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/batchrepr"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/record"
@@ -121,6 +122,10 @@ func (q *commitQueue) dequeueApplied() *Batch {
 	}
 }
 
+// errBatchRejected marks an error returned by a batch's validate function,
+// which rejects the batch without committing it.
+var errBatchRejected = errors.New("pebble: batch rejected")
+
 // commitEnv contains the environment that a commitPipeline interacts
 // with. This allows fine-grained testing of commitPipeline behavior without
 // construction of an entire DB.
@@ -315,6 +320,15 @@ func (p *commitPipeline) Commit(b *Batch, syncWAL bool, noSyncWait bool) error {
 	// NB: We set Batch.commitErr on error so that the batch won't be a candidate
 	// for reuse. See Batch.release().
 	mem, err := p.prepare(b, syncWAL, noSyncWait)
+	if errors.Is(err, errBatchRejected) {
+		// The batch was never enqueued, so it is safe to release the semaphores
+		// and to reuse the batch.
+		if syncWAL {
+			<-p.logSyncQSem
+		}
+		<-p.commitQueueSem
+		return err
+	}
 	if err != nil {
 		b.db = nil // prevent batch reuse on error
 		// NB: we are not doing <-p.commitQueueSem since the batch is still
@@ -431,6 +445,23 @@ func (p *commitPipeline) prepare(b *Batch, syncWAL bool, noSyncWait bool) (*memT
 	if n == invalidBatchCount {
 		return nil, ErrInvalidBatch
 	}
+	p.mu.Lock()
+
+	// Validate the batch, if requested, before it is enqueued or sequenced. We
+	// first wait for every batch sequenced before it to become visible, so that
+	// the validation observes all of their writes, and commitPipeline.mu
+	// prevents any other batch from being sequenced until this one is. A
+	// rejected batch is not enqueued and is never assigned a sequence number.
+	if b.validate != nil {
+		for p.env.visibleSeqNum.Load() != p.env.logSeqNum.Load() {
+			runtime.Gosched()
+		}
+		if err := b.validate(); err != nil {
+			p.mu.Unlock()
+			return nil, errors.Mark(err, errBatchRejected)
+		}
+	}
+
 	var syncWG *sync.WaitGroup
 	var syncErr *error
 	switch {
@@ -452,8 +483,6 @@ func (p *commitPipeline) prepare(b *Batch, syncWAL bool, noSyncWait bool) (*memT
 		b.commit.Add(2)
 	}
 
-	p.mu.Lock()
-
 	// Enqueue the batch in the pending queue. Note that while the pending queue
 	// is lock-free, we want the order of batches to be the same as the sequence
 	// number order.
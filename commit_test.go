@@ -13,6 +13,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/arenaskl"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/invariants"
@@ -170,6 +171,47 @@ func TestCommitPipelineSync(t *testing.T) {
 	}
 }
 
+func TestCommitPipelineValidate(t *testing.T) {
+	var e testCommitEnv
+	p := newCommitPipeline(e.env())
+	e.queueSemChan = p.logSyncQSem
+
+	// Half of the batches are rejected. Every batch is validated once all
+	// earlier batches are visible, and rejected batches must release their
+	// semaphores, or the commits would block.
+	const n = 1000
+	errRejected := errors.New("rejected")
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer wg.Done()
+			var b Batch
+			require.NoError(t, b.Set([]byte(fmt.Sprint(i)), nil, nil))
+			b.validate = func() error {
+				if v, l := e.visibleSeqNum.Load(), e.logSeqNum.Load(); v != l {
+					return errors.Newf("validating with visible seqnum %s < %s", v, l)
+				}
+				if i%2 == 1 {
+					return errRejected
+				}
+				return nil
+			}
+			err := p.Commit(&b, true, false)
+			if i%2 == 1 {
+				require.True(t, errors.Is(err, errRejected), "%v", err)
+				require.Equal(t, base.SeqNum(0), b.SeqNum())
+			} else {
+				require.NoError(t, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	require.Equal(t, uint64(n/2), e.writeCount.Load())
+	require.Equal(t, base.SeqNum(n/2), e.logSeqNum.Load())
+	require.Equal(t, base.SeqNum(n/2), e.visibleSeqNum.Load())
+}
+
 func TestCommitPipelineAllocateSeqNum(t *testing.T) {
 	var e testCommitEnv
 	p := newCommitPipeline(e.env())
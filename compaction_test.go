@@ -2837,3 +2837,57 @@ func TestCompactionErrorStats(t *testing.T) {
 	d.mu.Unlock()
 	require.NoError(t, d.Close())
 }
+
+func TestCompactionCompressionDictionaries(t *testing.T) {
+	for _, vers := range []FormatMajorVersion{FormatWALCompression, FormatCompressionDictionaries} {
+		t.Run(vers.String(), func(t *testing.T) {
+			mem := vfs.NewMem()
+			opts := &Options{
+				FS:                 mem,
+				FormatMajorVersion: vers,
+				Levels: []LevelOptions{{
+					BlockSize:           256,
+					Compression:         func() Compression { return ZstdCompression },
+					CompressionDictSize: 1 << 10,
+				}},
+			}
+			d, err := Open("", opts)
+			require.NoError(t, err)
+			value := func(i int) []byte {
+				return []byte(fmt.Sprintf(`{"id":%d,"status":"active","tier":%d}`, i, i%3))
+			}
+			const n = 5000
+			for i := 0; i < n; i++ {
+				require.NoError(t, d.Set([]byte(fmt.Sprintf("key%06d", i)), value(i), nil))
+			}
+			require.NoError(t, d.Compact([]byte("key"), []byte("kez"), false /* parallelize */))
+
+			// Dictionaries are only built once the format major version allows
+			// TableFormatPebblev5.
+			tables, err := d.SSTables()
+			require.NoError(t, err)
+			var count int
+			for _, level := range tables {
+				for _, info := range level {
+					f, err := mem.Open(base.MakeFilepath(mem, "", base.FileTypeTable, info.BackingSSTNum))
+					require.NoError(t, err)
+					readable, err := sstable.NewSimpleReadable(f)
+					require.NoError(t, err)
+					r, err := sstable.NewReader(readable, sstable.ReaderOptions{})
+					require.NoError(t, err)
+					l, err := r.Layout()
+					require.NoError(t, err)
+					require.Equal(t, vers == FormatCompressionDictionaries, l.CompressionDict.Length > 0)
+					require.NoError(t, r.Close())
+					count++
+				}
+			}
+			require.NotZero(t, count)
+
+			for i := 0; i < n; i += 97 {
+				verifyGet(t, d, []byte(fmt.Sprintf("key%06d", i)), value(i))
+			}
+			require.NoError(t, d.Close())
+		})
+	}
+}
@@ -861,6 +861,10 @@ func (d *DB) applyInternal(batch *Batch, opts *WriteOptions, noSyncWait bool) er
 		}
 	}
 	if err := d.commit.Commit(batch, sync, noSyncWait); err != nil {
+		if errors.Is(err, errBatchRejected) {
+			// The batch's validate function rejected it before it was sequenced.
+			return err
+		}
 		// There isn't much we can do on an error here. The commit pipeline will be
 		// horked at this point.
 		d.opts.Logger.Fatalf("pebble: fatal commit error: %v", err)
@@ -2342,6 +2346,23 @@ func (d *DB) walPreallocateSize() int {
 	return int(size)
 }
 
+// walCompression returns the compression algorithm for a new WAL, which is
+// Options.WALCompression once the format major version supports compressed
+// WALs.
+func (d *DB) walCompression() record.Compression {
+	if d.FormatMajorVersion() < FormatWALCompression {
+		return record.NoCompression
+	}
+	switch d.opts.WALCompression {
+	case SnappyCompression:
+		return record.SnappyCompression
+	case ZstdCompression:
+		return record.ZstdCompression
+	default:
+		return record.NoCompression
+	}
+}
+
 func (d *DB) newMemTable(
 	logNum base.DiskFileNum, logSeqNum base.SeqNum, minSize uint64,
 ) (*memTable, *flushableEntry) {
@@ -512,6 +512,29 @@ func (i WALDeleteInfo) SafeFormat(w redact.SafePrinter, _ rune) {
 	w.Printf("[JOB %d] WAL deleted %s", redact.Safe(i.JobID), i.FileNum)
 }
 
+// WALSyncInfo contains the info for a WAL sync event.
+type WALSyncInfo struct {
+	// FileNum is the file number of the WAL.
+	FileNum base.DiskFileNum
+	// Duration is the time spent syncing the WAL.
+	Duration time.Duration
+	Err      error
+}
+
+func (i WALSyncInfo) String() string {
+	return redact.StringWithoutMarkers(i)
+}
+
+// SafeFormat implements redact.SafeFormatter.
+func (i WALSyncInfo) SafeFormat(w redact.SafePrinter, _ rune) {
+	if i.Err != nil {
+		w.Printf("WAL %s sync error after %.1fs: %s", i.FileNum,
+			redact.Safe(i.Duration.Seconds()), i.Err)
+		return
+	}
+	w.Printf("WAL %s synced in %.1fs", i.FileNum, redact.Safe(i.Duration.Seconds()))
+}
+
 // WriteStallBeginInfo contains the info for a write stall begin event.
 type WriteStallBeginInfo struct {
 	Reason string
@@ -603,6 +626,12 @@ type EventListener struct {
 	// WALDeleted is invoked after a WAL has been deleted.
 	WALDeleted func(WALDeleteInfo)
 
+	// WALSynced is invoked after every sync of a WAL, successful or not, such
+	// as to trace the latency of individual syncs. WALSynced is called on the
+	// goroutine performing the sync, and delays the completion of the sync, so
+	// the callee MUST return quickly, without doing any IO or blocking.
+	WALSynced func(WALSyncInfo)
+
 	// WriteStallBegin is invoked when writes are intentionally delayed.
 	WriteStallBegin func(WriteStallBeginInfo)
 
@@ -675,6 +704,9 @@ func (l *EventListener) EnsureDefaults(logger Logger) {
 	if l.WALDeleted == nil {
 		l.WALDeleted = func(info WALDeleteInfo) {}
 	}
+	if l.WALSynced == nil {
+		l.WALSynced = func(info WALSyncInfo) {}
+	}
 	if l.WriteStallBegin == nil {
 		l.WriteStallBegin = func(info WriteStallBeginInfo) {}
 	}
@@ -684,7 +716,10 @@ func (l *EventListener) EnsureDefaults(logger Logger) {
 }
 
 // MakeLoggingEventListener creates an EventListener that logs all events to the
-// specified logger.
+// specified logger, except for successful WAL syncs, which are too frequent to
+// log. If the logger is a StructuredLogger, each message carries an "event"
+// field naming the event, and a "job" field with the ID of the job that raised
+// it, where there is one.
 func MakeLoggingEventListener(logger Logger) EventListener {
 	if logger == nil {
 		logger = DefaultLogger
@@ -692,61 +727,70 @@ func MakeLoggingEventListener(logger Logger) EventListener {
 
 	return EventListener{
 		BackgroundError: func(err error) {
+			if sl, ok := logger.(StructuredLogger); ok {
+				sl.Errorw(string(redact.Sprintf("background error: %s", err)), "event", "background_error")
+				return
+			}
 			logger.Errorf("background error: %s", err)
 		},
 		CompactionBegin: func(info CompactionInfo) {
-			logger.Infof("%s", info)
+			logEvent(logger, "compaction_begin", info, "job", info.JobID)
 		},
 		CompactionEnd: func(info CompactionInfo) {
-			logger.Infof("%s", info)
+			logEvent(logger, "compaction_end", info, "job", info.JobID, "duration", info.TotalDuration)
 		},
 		DiskSlow: func(info DiskSlowInfo) {
-			logger.Infof("%s", info)
+			logEvent(logger, "disk_slow", info, "path", info.Path, "duration", info.Duration)
 		},
 		FlushBegin: func(info FlushInfo) {
-			logger.Infof("%s", info)
+			logEvent(logger, "flush_begin", info, "job", info.JobID)
 		},
 		FlushEnd: func(info FlushInfo) {
-			logger.Infof("%s", info)
+			logEvent(logger, "flush_end", info, "job", info.JobID, "duration", info.TotalDuration)
 		},
 		DownloadBegin: func(info DownloadInfo) {
-			logger.Infof("%s", info)
+			logEvent(logger, "download_begin", info, "job", info.JobID)
 		},
 		DownloadEnd: func(info DownloadInfo) {
-			logger.Infof("%s", info)
+			logEvent(logger, "download_end", info, "job", info.JobID, "duration", info.Duration)
 		},
 		FormatUpgrade: func(v FormatMajorVersion) {
 			logger.Infof("upgraded to format version: %s", v)
 		},
 		ManifestCreated: func(info ManifestCreateInfo) {
-			logger.Infof("%s", info)
+			logEvent(logger, "manifest_created", info, "job", info.JobID, "file", info.FileNum)
 		},
 		ManifestDeleted: func(info ManifestDeleteInfo) {
-			logger.Infof("%s", info)
+			logEvent(logger, "manifest_deleted", info, "job", info.JobID, "file", info.FileNum)
 		},
 		TableCreated: func(info TableCreateInfo) {
-			logger.Infof("%s", info)
+			logEvent(logger, "table_created", info, "job", info.JobID, "file", info.FileNum)
 		},
 		TableDeleted: func(info TableDeleteInfo) {
-			logger.Infof("%s", info)
+			logEvent(logger, "table_deleted", info, "job", info.JobID, "file", info.FileNum)
 		},
 		TableIngested: func(info TableIngestInfo) {
-			logger.Infof("%s", info)
+			logEvent(logger, "table_ingested", info, "job", info.JobID)
 		},
 		TableStatsLoaded: func(info TableStatsInfo) {
-			logger.Infof("%s", info)
+			logEvent(logger, "table_stats_loaded", info, "job", info.JobID)
 		},
 		TableValidated: func(info TableValidatedInfo) {
-			logger.Infof("%s", info)
+			logEvent(logger, "table_validated", info, "job", info.JobID)
 		},
 		WALCreated: func(info WALCreateInfo) {
-			logger.Infof("%s", info)
+			logEvent(logger, "wal_created", info, "job", info.JobID, "file", info.FileNum)
 		},
 		WALDeleted: func(info WALDeleteInfo) {
-			logger.Infof("%s", info)
+			logEvent(logger, "wal_deleted", info, "job", info.JobID, "file", info.FileNum)
+		},
+		WALSynced: func(info WALSyncInfo) {
+			if info.Err != nil {
+				logEvent(logger, "wal_synced", info, "file", info.FileNum)
+			}
 		},
 		WriteStallBegin: func(info WriteStallBeginInfo) {
-			logger.Infof("%s", info)
+			logEvent(logger, "write_stall_begin", info)
 		},
 		WriteStallEnd: func() {
 			logger.Infof("write stall ending")
@@ -754,6 +798,20 @@ func MakeLoggingEventListener(logger Logger) EventListener {
 	}
 }
 
+// logEvent logs info, the description of an event. If logger is a
+// StructuredLogger, the name of the event and the given alternating keys and
+// values are attached to the message as fields, and nothing is logged unless
+// the logger's info level is enabled.
+func logEvent(logger Logger, event string, info redact.SafeFormatter, keysAndValues ...interface{}) {
+	if sl, ok := logger.(StructuredLogger); ok {
+		if sl.InfoEnabled() {
+			sl.Infow(string(redact.Sprint(info)), append([]interface{}{"event", event}, keysAndValues...)...)
+		}
+		return
+	}
+	logger.Infof("%s", info)
+}
+
 // TeeEventListener wraps two EventListeners, forwarding all events to both.
 func TeeEventListener(a, b EventListener) EventListener {
 	a.EnsureDefaults(nil)
@@ -831,6 +889,10 @@ func TeeEventListener(a, b EventListener) EventListener {
 			a.WALDeleted(info)
 			b.WALDeleted(info)
 		},
+		WALSynced: func(info WALSyncInfo) {
+			a.WALSynced(info)
+			b.WALSynced(info)
+		},
 		WriteStallBegin: func(info WriteStallBeginInfo) {
 			a.WriteStallBegin(info)
 			b.WriteStallBegin(info)
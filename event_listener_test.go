@@ -332,6 +332,46 @@ func (l redactLogger) Fatalf(format string, args ...interface{}) {
 	l.logger.Fatalf("%s", redact.Sprintf(format, args...).Redact())
 }
 
+func TestWALSyncedEvents(t *testing.T) {
+	var mu sync.Mutex
+	var created []base.DiskFileNum
+	var synced []WALSyncInfo
+	d, err := Open("", &Options{
+		FS: vfs.NewMem(),
+		EventListener: &EventListener{
+			WALCreated: func(info WALCreateInfo) {
+				mu.Lock()
+				defer mu.Unlock()
+				created = append(created, info.FileNum)
+			},
+			WALSynced: func(info WALSyncInfo) {
+				mu.Lock()
+				defer mu.Unlock()
+				synced = append(synced, info)
+			},
+		},
+	})
+	require.NoError(t, err)
+	// The sync of a synced write is reported before the write completes.
+	require.NoError(t, d.Set([]byte("a"), []byte("a"), Sync))
+	mu.Lock()
+	require.NotEmpty(t, synced)
+	for _, info := range synced {
+		require.Equal(t, created[len(created)-1], info.FileNum)
+		require.NoError(t, info.Err)
+	}
+	mu.Unlock()
+	require.NoError(t, d.Close())
+
+	// Only failed syncs are logged.
+	var log base.InMemLogger
+	l := MakeLoggingEventListener(&log)
+	l.WALSynced(WALSyncInfo{FileNum: 5, Duration: time.Millisecond})
+	require.Empty(t, log.String())
+	l.WALSynced(WALSyncInfo{FileNum: 5, Duration: 2 * time.Second, Err: errors.New("injected error")})
+	require.Equal(t, "WAL 000005 sync error after 2.0s: injected error\n", log.String())
+}
+
 func TestEventListenerRedact(t *testing.T) {
 	// The vast majority of event listener fields logged are safe and do not
 	// need to be redacted. Verify that the rare, unsafe error does appear in
@@ -346,6 +386,47 @@ func TestEventListenerRedact(t *testing.T) {
 	require.Equal(t, "[JOB 5] WAL delete error: unredacted error: ‹×›\n", log.String())
 }
 
+// structuredLogger is a StructuredLogger that records the fields of each
+// message.
+type structuredLogger struct {
+	base.InMemLogger
+	infoDisabled bool
+}
+
+func (l *structuredLogger) InfoEnabled() bool {
+	return !l.infoDisabled
+}
+
+func (l *structuredLogger) Infow(msg string, keysAndValues ...interface{}) {
+	l.Infof("%s %v", msg, keysAndValues)
+}
+
+func (l *structuredLogger) Errorw(msg string, keysAndValues ...interface{}) {
+	l.Infof("ERROR %s %v", msg, keysAndValues)
+}
+
+func TestEventListenerStructuredLogger(t *testing.T) {
+	var log structuredLogger
+	l := MakeLoggingEventListener(&log)
+	l.WALCreated(WALCreateInfo{JobID: 5, FileNum: base.DiskFileNum(20)})
+	l.FlushEnd(FlushInfo{JobID: 6, Reason: "forced", Done: true, Duration: time.Second, TotalDuration: 2 * time.Second})
+	l.TableIngested(TableIngestInfo{JobID: 7, Err: errors.Newf("ingest error: %s", "unsafe")})
+	l.BackgroundError(errors.Newf("an example error: %s", "unsafe"))
+	// Messages keep their redaction markers.
+	require.Equal(t, `[JOB 5] WAL created 000020 [event wal_created job 5 file 000020]
+[JOB 6] flushed 0 memtables (0B) to L0 [] (0B), in 1.0s (2.0s total), output rate 0B/s [event flush_end job 6 duration 2s]
+[JOB 7] ingest error: ingest error: ‹unsafe› [event table_ingested job 7]
+ERROR background error: an example error: ‹unsafe› [event background_error]
+`, log.String())
+
+	// Only errors are logged when the info level is disabled.
+	log = structuredLogger{infoDisabled: true}
+	l = MakeLoggingEventListener(&log)
+	l.WALCreated(WALCreateInfo{JobID: 5, FileNum: base.DiskFileNum(20)})
+	l.BackgroundError(errors.New("an example error"))
+	require.Equal(t, "ERROR background error: an example error [event background_error]\n", log.String())
+}
+
 func TestEventListenerEnsureDefaultsBackgroundError(t *testing.T) {
 	e := EventListener{}
 	e.EnsureDefaults(nil)
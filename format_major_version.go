@@ -197,6 +197,19 @@ const (
 
 	// -- Add experimental versions here --
 
+	// FormatWALCompression is a format major version that adds support for
+	// compressed WAL records (see Options.WALCompression). WALs written with
+	// compression enabled contain record chunk types that earlier versions
+	// interpret as a corrupt log tail, so compression is only enabled once the
+	// DB has ratcheted to this version.
+	FormatWALCompression
+
+	// FormatCompressionDictionaries is a format major version that adds support
+	// for sstables with compression dictionaries (see
+	// LevelOptions.CompressionDictSize), which require
+	// sstable.TableFormatPebblev5.
+	FormatCompressionDictionaries
+
 	// internalFormatNewest is the most recent, possibly experimental format major
 	// version.
 	internalFormatNewest FormatMajorVersion = iota - 2
@@ -222,8 +235,11 @@ func (v FormatMajorVersion) MaxTableFormat() sstable.TableFormat {
 	switch v {
 	case FormatDefault, FormatFlushableIngest, FormatPrePebblev1MarkedCompacted:
 		return sstable.TableFormatPebblev3
-	case FormatDeleteSizedAndObsolete, FormatVirtualSSTables, FormatSyntheticPrefixSuffix:
+	case FormatDeleteSizedAndObsolete, FormatVirtualSSTables, FormatSyntheticPrefixSuffix,
+		FormatWALCompression:
 		return sstable.TableFormatPebblev4
+	case FormatCompressionDictionaries:
+		return sstable.TableFormatPebblev5
 	default:
 		panic(fmt.Sprintf("pebble: unsupported format major version: %s", v))
 	}
@@ -234,7 +250,8 @@ func (v FormatMajorVersion) MaxTableFormat() sstable.TableFormat {
 func (v FormatMajorVersion) MinTableFormat() sstable.TableFormat {
 	switch v {
 	case FormatDefault, FormatFlushableIngest, FormatPrePebblev1MarkedCompacted,
-		FormatDeleteSizedAndObsolete, FormatVirtualSSTables, FormatSyntheticPrefixSuffix:
+		FormatDeleteSizedAndObsolete, FormatVirtualSSTables, FormatSyntheticPrefixSuffix,
+		FormatWALCompression, FormatCompressionDictionaries:
 		return sstable.TableFormatPebblev1
 	default:
 		panic(fmt.Sprintf("pebble: unsupported format major version: %s", v))
@@ -271,6 +288,12 @@ var formatMajorVersionMigrations = map[FormatMajorVersion]func(*DB) error{
 	FormatSyntheticPrefixSuffix: func(d *DB) error {
 		return d.finalizeFormatVersUpgrade(FormatSyntheticPrefixSuffix)
 	},
+	FormatWALCompression: func(d *DB) error {
+		return d.finalizeFormatVersUpgrade(FormatWALCompression)
+	},
+	FormatCompressionDictionaries: func(d *DB) error {
+		return d.finalizeFormatVersUpgrade(FormatCompressionDictionaries)
+	},
 }
 
 const formatVersionMarkerName = `format-version`
@@ -1181,6 +1181,38 @@ func (d *DB) IngestAndExcise(
 	return d.ingest(paths, shared, exciseSpan, sstsContainExciseTombstone, external)
 }
 
+// Excise atomically deletes all data within span, without rewriting any
+// sstables: sstables contained within span are dropped, and sstables that
+// straddle one of its bounds are replaced by virtual sstables that exclude
+// span. Memtables that overlap span are flushed first. Excise is equivalent
+// to IngestAndExcise without any files to ingest.
+//
+// Excise requires a format major version of at least FormatVirtualSSTables.
+// The bounds of span must be prefixes, without suffixes.
+func (d *DB) Excise(span KeyRange) error {
+	if err := d.closed.Load(); err != nil {
+		panic(err)
+	}
+	if d.opts.ReadOnly {
+		return ErrReadOnly
+	}
+	if !span.Valid() || d.cmp(span.Start, span.End) >= 0 {
+		return errors.Errorf("pebble: invalid excise span [%s, %s)",
+			d.opts.Comparer.FormatKey(span.Start), d.opts.Comparer.FormatKey(span.End))
+	}
+	if invariants.Enabled {
+		// Excise is only supported on prefix keys.
+		if d.opts.Comparer.Split(span.Start) != len(span.Start) {
+			panic("Excise called with suffixed start key")
+		}
+		if d.opts.Comparer.Split(span.End) != len(span.End) {
+			panic("Excise called with suffixed end key")
+		}
+	}
+	_, err := d.ingest(nil, nil, span, false, nil)
+	return err
+}
+
 // Both DB.mu and commitPipeline.mu must be held while this is called.
 func (d *DB) newIngestedFlushableEntry(
 	meta []*fileMetadata, seqNum base.SeqNum, logNum base.DiskFileNum, exciseSpan KeyRange,
@@ -1344,7 +1376,7 @@ func (d *DB) ingest(
 		return IngestOperationStats{}, err
 	}
 
-	if loadResult.fileCount() == 0 {
+	if loadResult.fileCount() == 0 && !exciseSpan.Valid() {
 		// All of the sstables to be ingested were empty. Nothing to do.
 		return IngestOperationStats{}, nil
 	}
@@ -1628,6 +1660,11 @@ func (d *DB) ingest(
 		}
 	}
 
+	if loadResult.fileCount() == 0 {
+		// An excise without any sstables to ingest.
+		return IngestOperationStats{}, err
+	}
+
 	info := TableIngestInfo{
 		JobID:     int(jobID),
 		Err:       err,
@@ -2376,7 +2413,9 @@ func (d *DB) ingestApply(
 		}
 	}
 
-	d.mu.versions.metrics.Ingest.Count++
+	if lr.fileCount() > 0 {
+		d.mu.versions.metrics.Ingest.Count++
+	}
 
 	d.updateReadStateLocked(d.opts.DebugCheck)
 	// updateReadStateLocked could have generated obsolete tables, schedule a
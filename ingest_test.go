@@ -1215,6 +1215,45 @@ func testIngestSharedImpl(
 	})
 }
 
+func TestDBExcise(t *testing.T) {
+	mem := vfs.NewMem()
+	opts := &Options{FS: mem, FormatMajorVersion: FormatVirtualSSTables}
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	for _, k := range []string{"a", "b", "c", "d"} {
+		require.NoError(t, d.Set([]byte(k), []byte(k), nil))
+	}
+	require.NoError(t, d.Flush())
+	// Keys in the memtable are excised too.
+	require.NoError(t, d.Set([]byte("bb"), []byte("bb"), nil))
+
+	require.Error(t, d.Excise(KeyRange{Start: []byte("c"), End: []byte("b")}))
+	require.NoError(t, d.Excise(KeyRange{Start: []byte("b"), End: []byte("d")}))
+
+	check := func() {
+		iter, err := d.NewIter(nil)
+		require.NoError(t, err)
+		var keys []string
+		for valid := iter.First(); valid; valid = iter.Next() {
+			keys = append(keys, string(iter.Key()))
+		}
+		require.NoError(t, iter.Close())
+		require.Equal(t, []string{"a", "d"}, keys)
+	}
+	check()
+	// The flushed sstable straddled both bounds of the span, so it is replaced
+	// by two virtual sstables without being rewritten.
+	m := d.Metrics()
+	require.Equal(t, uint64(2), m.NumVirtual())
+	require.Zero(t, m.Ingest.Count)
+	require.NoError(t, d.Close())
+
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	check()
+	require.NoError(t, d.Close())
+}
+
 func TestIngestShared(t *testing.T) {
 	for _, strategy := range []remote.CreateOnSharedStrategy{remote.CreateOnSharedAll, remote.CreateOnSharedLower} {
 		strategyStr := "all"
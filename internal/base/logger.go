@@ -21,6 +21,26 @@ type Logger interface {
 	Errorf(format string, args ...interface{})
 	Fatalf(format string, args ...interface{})
 }
+
+// StructuredLogger is a Logger that also accepts messages with structured
+// key-value fields, in the style of zap's SugaredLogger. Events logged by
+// Pebble through a StructuredLogger carry fields, such as the name of the
+// event and the ID of the job that raised it, which allow the messages of a
+// flush or compaction to be correlated.
+//
+// Messages are redactable strings (see redact.RedactableString), in which
+// unsafe values are enclosed in redaction markers.
+type StructuredLogger interface {
+	Logger
+	// InfoEnabled returns whether messages logged by Infow are emitted. Pebble
+	// does not format messages that would be discarded.
+	InfoEnabled() bool
+	// Infow logs msg with the given alternating keys and values.
+	Infow(msg string, keysAndValues ...interface{})
+	// Errorw logs msg as an error with the given alternating keys and values.
+	Errorw(msg string, keysAndValues ...interface{})
+}
+
 type defaultLogger struct{}
 
 // DefaultLogger logs to the Go stdlib logs.
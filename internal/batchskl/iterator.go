@@ -17,7 +17,11 @@
 
 package batchskl
 
-import "github.com/cockroachdb/pebble/internal/base"
+import (
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/invariants"
+)
 
 type splice struct {
 	prev uint32
@@ -47,6 +51,26 @@ type Iterator struct {
 	// allocated first, ensuring all other nodes have non-zero offsets.
 	lowerNode uint32
 	upperNode uint32
+	// skipDuplicateAbbreviatedKeys is set by SetSkipDuplicateAbbreviatedKeys.
+	skipDuplicateAbbreviatedKeys bool
+	// snapshotLen, if non-zero, is the length of the skiplist's nodes slice when
+	// the iterator was created by NewSnapshotIter. Nodes at or beyond this
+	// offset were allocated afterwards and are invisible to the iterator.
+	snapshotLen uint32
+}
+
+// Clone returns an independent iterator with the same position and bounds as
+// the receiver. Repositioning either iterator does not affect the other.
+func (it *Iterator) Clone() Iterator {
+	return *it
+}
+
+// Init binds the iterator to the skiplist s, as if it had been returned by
+// s.NewIter(nil, nil). The iterator's position, bounds, and any state cached
+// about the nodes of the previously bound skiplist are discarded, allowing a
+// long-lived iterator to be reused across skiplists without allocation.
+func (it *Iterator) Init(s *Skiplist) {
+	*it = Iterator{list: s}
 }
 
 // Close resets the iterator.
@@ -62,30 +86,153 @@ func (it *Iterator) Close() error {
 // bound.
 func (it *Iterator) SeekGE(key []byte, flags base.SeekGEFlags) *base.InternalKey {
 	if flags.TrySeekUsingNext() {
-		if it.nd == it.list.tail || it.nd == it.upperNode {
+		if k, done := it.trySeekUsingNext(key); done {
+			return k
+		}
+	}
+	return it.seekGE(key, it.list.abbreviatedKey(key))
+}
+
+// SeekGEWithAbbreviatedKey is like SeekGE, but uses the supplied abbreviated
+// key of key rather than computing it, for callers that already hold it. The
+// abbreviated key must equal the one computed by the skiplist's abbreviated
+// key function, which is verified in invariants builds.
+func (it *Iterator) SeekGEWithAbbreviatedKey(
+	key []byte, abbreviatedKey uint64, flags base.SeekGEFlags,
+) *base.InternalKey {
+	abbreviatedKey = it.list.suppliedAbbreviatedKey(abbreviatedKey)
+	if invariants.Enabled {
+		it.list.checkSuppliedAbbreviatedKey(key, abbreviatedKey)
+	}
+	if flags.TrySeekUsingNext() {
+		if k, done := it.trySeekUsingNext(key); done {
+			return k
+		}
+	}
+	return it.seekGE(key, abbreviatedKey)
+}
+
+// trySeekUsingNext attempts to satisfy a SeekGE by stepping forward from the
+// current position, returning true if it succeeded.
+func (it *Iterator) trySeekUsingNext(key []byte) (_ *base.InternalKey, done bool) {
+	if it.nd == it.list.tail || it.nd == it.upperNode {
+		// Iterator is done.
+		return nil, true
+	}
+	less := it.list.cmp(it.key.UserKey, key) < 0
+	// Arbitrary constant. By measuring the seek cost as a function of the
+	// number of elements in the skip list, and fitting to a model, we
+	// could adjust the number of nexts based on the current size of the
+	// skip list.
+	const numNexts = 5
+	for i := 0; less && i < numNexts; i++ {
+		k := it.Next()
+		if k == nil {
 			// Iterator is done.
-			return nil
+			return nil, true
+		}
+		less = it.list.cmp(k.UserKey, key) < 0
+	}
+	if !less {
+		return &it.key, true
+	}
+	return nil, false
+}
+
+func (it *Iterator) seekGE(key []byte, abbreviatedKey uint64) *base.InternalKey {
+	_, it.nd = it.seekForBaseSplice(key, abbreviatedKey)
+	it.nd = it.skipForward(it.nd)
+	if it.nd == it.list.tail || it.nd == it.upperNode {
+		return nil
+	}
+	nodeKey := it.list.getKey(it.nd)
+	if it.upper != nil && it.list.cmp(it.upper, nodeKey.UserKey) <= 0 {
+		it.upperNode = it.nd
+		return nil
+	}
+	it.key = nodeKey
+	return &it.key
+}
+
+// SeekGEWithMatch is like SeekGE, but returns whether the iterator is
+// positioned at an entry whose user key is equal to the given key. The result
+// is false if the iterator is positioned at an entry with a greater user key
+// or is exhausted. Whether the match is exact is determined during the seek
+// and does not require an additional key comparison. Like SeekGE,
+// SeekGEWithMatch only checks the upper bound.
+func (it *Iterator) SeekGEWithMatch(key []byte) (exact bool) {
+	abbreviatedKey := it.list.abbreviatedKey(key)
+	prev := it.list.head
+	for level := it.list.loadHeight() - 1; level > 0; level-- {
+		prev, _ = it.list.findSpliceForLevel(key, abbreviatedKey, level, prev)
+	}
+
+	// Search level 0, remembering the result of the comparison that ends the
+	// search.
+	it.nd = it.list.getNext(prev, 0)
+	if it.list.opts.stats {
+		it.list.stats.LinkTraversals++
+	}
+	for it.nd != it.list.tail {
+		n := it.list.node(it.nd)
+		if it.list.opts.stats {
+			it.list.countComparison(abbreviatedKey, n.abbreviatedKey)
 		}
-		less := it.list.cmp(it.key.UserKey, key) < 0
-		// Arbitrary constant. By measuring the seek cost as a function of the
-		// number of elements in the skip list, and fitting to a model, we
-		// could adjust the number of nexts based on the current size of the
-		// skip list.
-		const numNexts = 5
-		for i := 0; less && i < numNexts; i++ {
-			k := it.Next()
-			if k == nil {
-				// Iterator is done.
-				return nil
+		if abbreviatedKey < n.abbreviatedKey {
+			exact = false
+			break
+		}
+		if abbreviatedKey == n.abbreviatedKey {
+			if c := it.list.cmp(key, (*it.list.storage)[n.keyStart:n.keyEnd]); c <= 0 {
+				exact = c == 0
+				break
 			}
-			less = it.list.cmp(k.UserKey, key) < 0
 		}
-		if !less {
-			return &it.key
+		it.nd = it.list.loadNext(n, 0)
+		if it.list.opts.stats {
+			it.list.stats.LinkTraversals++
 		}
 	}
+	if nd := it.skipForward(it.nd); nd != it.nd {
+		// The node found by the search was added after the snapshot was taken.
+		it.nd = nd
+		exact = nd != it.list.tail && it.list.cmp(key, it.list.getKey(nd).UserKey) == 0
+	}
+
+	if it.nd == it.list.tail || it.nd == it.upperNode {
+		return false
+	}
+	nodeKey := it.list.getKey(it.nd)
+	if it.upper != nil && it.list.cmp(it.upper, nodeKey.UserKey) <= 0 {
+		it.upperNode = it.nd
+		return false
+	}
+	it.key = nodeKey
+	return exact
+}
 
-	_, it.nd = it.seekForBaseSplice(key, it.list.abbreviatedKey(key))
+// SeekGEAbbreviatedKey moves the iterator to the first entry whose abbreviated
+// key is greater than or equal to the given abbreviated key, comparing only
+// abbreviated keys and never retrieving keys from the storage. If every key is
+// fully determined by its abbreviated key (e.g. fixed 8-byte keys with the
+// default comparer), this is equivalent to SeekGE with the corresponding key.
+// Otherwise the seek is approximate: the iterator is positioned at the first of
+// the entries sharing the abbreviated key, and the caller is expected to refine
+// the position. Like SeekGE, SeekGEAbbreviatedKey only checks the upper bound.
+func (it *Iterator) SeekGEAbbreviatedKey(abbreviatedKey uint64) *base.InternalKey {
+	abbreviatedKey = it.list.suppliedAbbreviatedKey(abbreviatedKey)
+	prev := it.list.head
+	for level := it.list.loadHeight() - 1; ; level-- {
+		next := it.list.getNext(prev, level)
+		for next != it.list.tail && it.list.node(next).abbreviatedKey < abbreviatedKey {
+			prev = next
+			next = it.list.getNext(prev, level)
+		}
+		if level == 0 {
+			it.nd = it.skipForward(next)
+			break
+		}
+	}
 	if it.nd == it.list.tail || it.nd == it.upperNode {
 		return nil
 	}
@@ -104,6 +251,7 @@ func (it *Iterator) SeekGE(key []byte, flags base.SeekGEFlags) *base.InternalKey
 // caller to ensure that key is less than the upper bound.
 func (it *Iterator) SeekLT(key []byte) *base.InternalKey {
 	it.nd, _ = it.seekForBaseSplice(key, it.list.abbreviatedKey(key))
+	it.nd = it.skipBackward(it.nd)
 	if it.nd == it.list.head || it.nd == it.lowerNode {
 		return nil
 	}
@@ -121,7 +269,7 @@ func (it *Iterator) SeekLT(key []byte) *base.InternalKey {
 // bound. It is up to the caller to ensure that key is greater than or equal to
 // the lower bound (e.g. via a call to SeekGE(lower)).
 func (it *Iterator) First() *base.InternalKey {
-	it.nd = it.list.getNext(it.list.head, 0)
+	it.nd = it.skipForward(it.list.getNext(it.list.head, 0))
 	if it.nd == it.list.tail || it.nd == it.upperNode {
 		return nil
 	}
@@ -139,7 +287,7 @@ func (it *Iterator) First() *base.InternalKey {
 // bound. It is up to the caller to ensure that key is less than the upper
 // bound (e.g. via a call to SeekLT(upper)).
 func (it *Iterator) Last() *base.InternalKey {
-	it.nd = it.list.getPrev(it.list.tail, 0)
+	it.nd = it.skipBackward(it.list.getPrev(it.list.tail, 0))
 	if it.nd == it.list.head || it.nd == it.lowerNode {
 		return nil
 	}
@@ -152,10 +300,66 @@ func (it *Iterator) Last() *base.InternalKey {
 	return &it.key
 }
 
+// SetNode positions the iterator at the node with the given offset, as
+// returned by Skiplist.AddNode, and returns its key. This allows a retained
+// node offset to be used to resume iteration without seeking. The node must
+// still be linked into the skiplist and, for a snapshot iterator, be visible
+// to the snapshot, which is verified in invariants builds. Note that SetNode
+// does not check the bounds: it is up to the caller to ensure that the node
+// is within them.
+func (it *Iterator) SetNode(nodeOffset uint32) *base.InternalKey {
+	if invariants.Enabled {
+		it.checkSetNode(nodeOffset)
+	}
+	it.nd = nodeOffset
+	it.key = it.list.getKey(it.nd)
+	return &it.key
+}
+
+func (it *Iterator) checkSetNode(nodeOffset uint32) {
+	s := it.list
+	if nodeOffset <= s.tail || uint64(nodeOffset)+uint64(nodeSize(1)) > uint64(len(s.nodes)) {
+		panic(errors.AssertionFailedf("batchskl: invalid node offset %d", errors.Safe(nodeOffset)))
+	}
+	if s.getNext(s.getPrev(nodeOffset, 0), 0) != nodeOffset {
+		panic(errors.AssertionFailedf("batchskl: node %d is not linked", errors.Safe(nodeOffset)))
+	}
+	if it.snapshotLen != 0 && nodeOffset >= it.snapshotLen {
+		panic(errors.AssertionFailedf("batchskl: node %d is not visible to the snapshot",
+			errors.Safe(nodeOffset)))
+	}
+}
+
 // Next advances to the next position. If there are no following nodes, then
 // Valid() will be false after this call.
 func (it *Iterator) Next() *base.InternalKey {
+	return it.next(it.skipDuplicateAbbreviatedKeys)
+}
+
+// SkipAbbreviatedKeyGroup advances to the first following entry whose
+// abbreviated key differs from that of the current entry, as Next does when
+// SetSkipDuplicateAbbreviatedKeys is enabled. The skipped entries are
+// identified solely by the abbreviated keys cached in their nodes, without
+// retrieving their keys from the storage. Note that entries with distinct user
+// keys may share an abbreviated key (e.g. keys longer than 8 bytes with a
+// common 8 byte prefix), in which case they are skipped too: grouping by
+// abbreviated key is only equivalent to grouping by user key if the
+// abbreviated key determines the user key, as for fixed-width keys of up to 8
+// bytes with the default comparer.
+func (it *Iterator) SkipAbbreviatedKeyGroup() *base.InternalKey {
+	return it.next(true /* skipDuplicates */)
+}
+
+func (it *Iterator) next(skipDuplicates bool) *base.InternalKey {
+	prev := it.nd
 	it.nd = it.list.getNext(it.nd, 0)
+	if skipDuplicates && !it.list.isSentinel(prev) {
+		abbreviatedKey := it.list.node(prev).abbreviatedKey
+		for it.nd != it.list.tail && it.list.node(it.nd).abbreviatedKey == abbreviatedKey {
+			it.nd = it.list.getNext(it.nd, 0)
+		}
+	}
+	it.nd = it.skipForward(it.nd)
 	if it.nd == it.list.tail || it.nd == it.upperNode {
 		return nil
 	}
@@ -171,7 +375,15 @@ func (it *Iterator) Next() *base.InternalKey {
 // Prev moves to the previous position. If there are no previous nodes, then
 // Valid() will be false after this call.
 func (it *Iterator) Prev() *base.InternalKey {
+	next := it.nd
 	it.nd = it.list.getPrev(it.nd, 0)
+	if it.skipDuplicateAbbreviatedKeys && !it.list.isSentinel(next) {
+		abbreviatedKey := it.list.node(next).abbreviatedKey
+		for it.nd != it.list.head && it.list.node(it.nd).abbreviatedKey == abbreviatedKey {
+			it.nd = it.list.getPrev(it.nd, 0)
+		}
+	}
+	it.nd = it.skipBackward(it.nd)
 	if it.nd == it.list.head || it.nd == it.lowerNode {
 		return nil
 	}
@@ -184,13 +396,81 @@ func (it *Iterator) Prev() *base.InternalKey {
 	return &it.key
 }
 
+// PeekNext returns the offset of the record following the iterator's current
+// position at level 0 without moving the iterator, or false if there is no
+// such record: the iterator is positioned at the last record or after it. If
+// the iterator is positioned before the first record, PeekNext returns the
+// first record. PeekNext does not check the upper bound and ignores
+// SetSkipDuplicateAbbreviatedKeys. A snapshot iterator only peeks at records
+// visible to its snapshot.
+func (it *Iterator) PeekNext() (offset uint32, ok bool) {
+	if it.nd == it.list.tail {
+		return 0, false
+	}
+	nd := it.skipForward(it.list.getNext(it.nd, 0))
+	if nd == it.list.tail {
+		return 0, false
+	}
+	return it.list.node(nd).offset, true
+}
+
+// PeekPrev is like PeekNext, but returns the offset of the record preceding
+// the iterator's current position. PeekPrev does not check the lower bound.
+func (it *Iterator) PeekPrev() (offset uint32, ok bool) {
+	if it.nd == it.list.head {
+		return 0, false
+	}
+	nd := it.skipBackward(it.list.getPrev(it.nd, 0))
+	if nd == it.list.head {
+		return 0, false
+	}
+	return it.list.node(nd).offset, true
+}
+
+// AtStart returns true if the iterator is positioned before the first entry,
+// i.e. the last movement (e.g. Prev or SeekLT) ran off the beginning of the
+// skiplist. A newly constructed iterator is also positioned before the first
+// entry. AtStart returns false if iteration was stopped by the lower bound.
+func (it *Iterator) AtStart() bool {
+	return it.nd == it.list.head
+}
+
+// AtEnd returns true if the iterator is positioned after the last entry, i.e.
+// the last movement (e.g. Next or SeekGE) ran off the end of the skiplist.
+// AtEnd returns false if iteration was stopped by the upper bound.
+func (it *Iterator) AtEnd() bool {
+	return it.nd == it.list.tail
+}
+
 // KeyInfo returns the offset of the start of the record, the start of the key,
 // and the end of the key.
 func (it *Iterator) KeyInfo() (offset, keyStart, keyEnd uint32) {
+	if invariants.Enabled {
+		it.list.checkNotSentinel(it.nd)
+	}
 	n := it.list.node(it.nd)
 	return n.offset, n.keyStart, n.keyEnd
 }
 
+// Value returns the inline value of the current entry, as supplied to
+// Skiplist.AddWithValue. It returns zero if the skiplist was not constructed
+// WithValues.
+func (it *Iterator) Value() uint64 {
+	if !it.list.opts.values {
+		return 0
+	}
+	return *it.list.valueOf(it.nd)
+}
+
+// StableKeys returns true if the user keys returned by the iterator may be
+// retained indefinitely without copying, which is the case if the skiplist was
+// constructed WithStableStorage. Otherwise returned user keys alias the
+// storage and are only valid until the storage is modified (e.g. when a batch
+// is reset and reused).
+func (it *Iterator) StableKeys() bool {
+	return it.list.opts.stable
+}
+
 func (it *Iterator) String() string {
 	return "batch"
 }
@@ -205,9 +485,40 @@ func (it *Iterator) SetBounds(lower, upper []byte) {
 	it.upperNode = 0
 }
 
+// SetSkipDuplicateAbbreviatedKeys sets whether Next and Prev skip over entries
+// that have the same abbreviated key as the current entry. When enabled, Next
+// moves to the first following entry whose abbreviated key differs from that
+// of the current entry, and Prev moves to the first preceding such entry. As a
+// result only one entry is surfaced from each run of entries sharing an
+// abbreviated key: the first entry when iterating forward and the last when
+// iterating backward. Note that entries with distinct user keys may share an
+// abbreviated key. The setting takes effect from the next call to Next or
+// Prev and does not affect seeks, First or Last.
+func (it *Iterator) SetSkipDuplicateAbbreviatedKeys(skip bool) {
+	it.skipDuplicateAbbreviatedKeys = skip
+}
+
+// skipForward returns nd, or if nd is invisible to a snapshot iterator, the
+// first visible node following it at level 0 (or the tail).
+func (it *Iterator) skipForward(nd uint32) uint32 {
+	for it.snapshotLen != 0 && nd >= it.snapshotLen && nd != it.list.tail {
+		nd = it.list.getNext(nd, 0)
+	}
+	return nd
+}
+
+// skipBackward returns nd, or if nd is invisible to a snapshot iterator, the
+// first visible node preceding it at level 0 (or the head).
+func (it *Iterator) skipBackward(nd uint32) uint32 {
+	for it.snapshotLen != 0 && nd >= it.snapshotLen {
+		nd = it.list.getPrev(nd, 0)
+	}
+	return nd
+}
+
 func (it *Iterator) seekForBaseSplice(key []byte, abbreviatedKey uint64) (prev, next uint32) {
 	prev = it.list.head
-	for level := it.list.height - 1; ; level-- {
+	for level := it.list.loadHeight() - 1; ; level-- {
 		prev, next = it.list.findSpliceForLevel(key, abbreviatedKey, level, prev)
 		if level == 0 {
 			break
@@ -0,0 +1,209 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package batchskl
+
+import (
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// MergingIterator iterates forward over the union of the records indexed by
+// several skiplists sharing a storage, without physically merging them (see
+// Skiplist.Merge). Records are returned in the order in which a merged
+// skiplist would index them: by user key (descending if the skiplists were
+// constructed WithDescending), with records with equal user keys ordered by
+// descending offset. Use NewMergingIterator to construct a MergingIterator.
+type MergingIterator struct {
+	iters []Iterator
+	heap  mergingIterHeap
+	// collapseDuplicates is set by SetCollapseDuplicates.
+	collapseDuplicates bool
+}
+
+// NewMergingIterator returns a new MergingIterator over the given skiplists,
+// which must index the same storage and have been constructed with the same
+// comparer. Skiplists constructed WithSequenceTags cannot be merged, as the
+// sequence tags of different skiplists do not order their records relative to
+// each other.
+func NewMergingIterator(lists ...*Skiplist) (*MergingIterator, error) {
+	m := &MergingIterator{iters: make([]Iterator, len(lists))}
+	for i, l := range lists {
+		if l.storage != lists[0].storage {
+			return nil, errors.New("batchskl: cannot merge skiplists with different storage")
+		}
+		if l.opts.seqTags {
+			return nil, errors.New("batchskl: cannot merge skiplists with sequence tags")
+		}
+		if l.opts.descending != lists[0].opts.descending {
+			return nil, errors.New("batchskl: cannot merge skiplists with different orders")
+		}
+		m.iters[i] = l.NewIter(nil, nil)
+	}
+	if len(lists) > 0 {
+		m.heap.cmp = lists[0].cmp
+	}
+	m.heap.items = make([]*Iterator, 0, len(lists))
+	return m, nil
+}
+
+// SetCollapseDuplicates sets whether a record indexed by more than one of the
+// skiplists (i.e. the same storage offset) is returned once, as it would be
+// indexed once by a merged skiplist, rather than once for every skiplist
+// indexing it. Records with equal user keys at different offsets are distinct
+// and never collapsed. The setting takes effect from the next call to Next.
+func (m *MergingIterator) SetCollapseDuplicates(collapse bool) {
+	m.collapseDuplicates = collapse
+}
+
+// First moves the iterator to the first record, returning its key, or nil if
+// the skiplists are empty.
+func (m *MergingIterator) First() *base.InternalKey {
+	m.heap.items = m.heap.items[:0]
+	for i := range m.iters {
+		if m.iters[i].First() != nil {
+			m.heap.items = append(m.heap.items, &m.iters[i])
+		}
+	}
+	m.heap.init()
+	return m.top()
+}
+
+// SeekGE moves the iterator to the first record whose user key is greater than
+// or equal to the given key, returning its key, or nil if there is no such
+// record.
+func (m *MergingIterator) SeekGE(key []byte) *base.InternalKey {
+	m.heap.items = m.heap.items[:0]
+	for i := range m.iters {
+		if m.iters[i].SeekGE(key, base.SeekGEFlagsNone) != nil {
+			m.heap.items = append(m.heap.items, &m.iters[i])
+		}
+	}
+	m.heap.init()
+	return m.top()
+}
+
+// Next advances to the next record, returning its key, or nil if the iterator
+// has returned every record. Skiplists whose records have all been returned
+// leave the heap, so the cost of Next is logarithmic in the number of
+// skiplists that still have records to return.
+func (m *MergingIterator) Next() *base.InternalKey {
+	if m.heap.len() == 0 {
+		return nil
+	}
+	offset, _, _ := m.heap.items[0].KeyInfo()
+	m.advance()
+	if m.collapseDuplicates {
+		for m.heap.len() > 0 {
+			if o, _, _ := m.heap.items[0].KeyInfo(); o != offset {
+				break
+			}
+			m.advance()
+		}
+	}
+	return m.top()
+}
+
+// KeyInfo returns the offset of the start of the current record, the start of
+// its key, and the end of its key.
+func (m *MergingIterator) KeyInfo() (offset, keyStart, keyEnd uint32) {
+	return m.heap.items[0].KeyInfo()
+}
+
+// advance moves the iterator at the top of the heap to its next record,
+// removing it from the heap if it is exhausted.
+func (m *MergingIterator) advance() {
+	if m.heap.items[0].Next() != nil {
+		m.heap.fix(0)
+	} else {
+		m.heap.pop()
+	}
+}
+
+func (m *MergingIterator) top() *base.InternalKey {
+	if m.heap.len() == 0 {
+		return nil
+	}
+	return &m.heap.items[0].key
+}
+
+// mergingIterHeap is a min-heap of the iterators of a MergingIterator that are
+// positioned at a record, ordered by their current records.
+type mergingIterHeap struct {
+	cmp   base.Compare
+	items []*Iterator
+}
+
+func (h *mergingIterHeap) len() int {
+	return len(h.items)
+}
+
+func (h *mergingIterHeap) less(i, j int) bool {
+	ik, jk := &h.items[i].key, &h.items[j].key
+	if c := h.cmp(ik.UserKey, jk.UserKey); c != 0 {
+		return c < 0
+	}
+	ioffset, _, _ := h.items[i].KeyInfo()
+	joffset, _, _ := h.items[j].KeyInfo()
+	return ioffset > joffset
+}
+
+func (h *mergingIterHeap) swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+}
+
+// init, fix, pop, up and down are copied from the go stdlib.
+func (h *mergingIterHeap) init() {
+	// heapify
+	n := h.len()
+	for i := n/2 - 1; i >= 0; i-- {
+		h.down(i, n)
+	}
+}
+
+func (h *mergingIterHeap) fix(i int) {
+	if !h.down(i, h.len()) {
+		h.up(i)
+	}
+}
+
+func (h *mergingIterHeap) pop() *Iterator {
+	n := h.len() - 1
+	h.swap(0, n)
+	h.down(0, n)
+	item := h.items[n]
+	h.items = h.items[:n]
+	return item
+}
+
+func (h *mergingIterHeap) up(j int) {
+	for {
+		i := (j - 1) / 2 // parent
+		if i == j || !h.less(j, i) {
+			break
+		}
+		h.swap(i, j)
+		j = i
+	}
+}
+
+func (h *mergingIterHeap) down(i0, n int) bool {
+	i := i0
+	for {
+		j1 := 2*i + 1
+		if j1 >= n || j1 < 0 { // j1 < 0 after int overflow
+			break
+		}
+		j := j1 // left child
+		if j2 := j1 + 1; j2 < n && h.less(j2, j1) {
+			j = j2 // = 2*i + 2  // right child
+		}
+		if !h.less(j, i) {
+			break
+		}
+		h.swap(i, j)
+		i = j
+	}
+	return i > i0
+}
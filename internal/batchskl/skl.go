@@ -19,14 +19,16 @@
 Adapted from RocksDB inline skiplist.
 
 Key differences:
-- No optimization for sequential inserts (no "prev").
-- No custom comparator.
+- Sequential inserts are optimized by caching the insertion position in a
+  Splice (see AddWithSplice), the analogue of RocksDB's "prev".
+- Keys are ordered by the base.Compare supplied to NewSkiplist (an indexed
+  batch supplies the DB's Comparer), with abbreviated keys derived by the
+  supplied base.AbbreviatedKey, which must be consistent with it.
 - Support overwrites. This requires care when we see the same key when inserting.
   For RocksDB or LevelDB, overwrites are implemented as a newer sequence number in the key, so
 	there is no need for values. We don't intend to support versioning. In-place updates of values
 	would be more efficient.
 - We discard all non-concurrent code.
-- We do not support Splices. This simplifies the code a lot.
 - No AllocateNode or other pointer arithmetic.
 - We combine the findLessThan, findGreaterOrEqual, etc into one function.
 */
@@ -45,8 +47,10 @@ Key differences:
 Further adapted from arenaskl: https://github.com/andy-kimball/arenaskl
 
 Key differences:
-- Removed support for deletion.
-- Removed support for concurrency.
+- Deletion removes a single record by its storage offset (DeleteByOffset), or
+  every record added after a checkpoint (Truncate), rather than by key.
+- Concurrency is limited to a single writer with concurrent readers (see
+  NewConcurrentSkiplist), rather than concurrent writers.
 - External storage of keys.
 - Node storage grows to an arbitrary size.
 */
@@ -58,12 +62,14 @@ import (
 	"encoding/binary"
 	"fmt"
 	"math"
+	"sync/atomic"
 	"time"
 	"unsafe"
 
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/base"
 	"github.com/cockroachdb/pebble/internal/constants"
+	"github.com/cockroachdb/pebble/internal/invariants"
 	"golang.org/x/exp/rand"
 )
 
@@ -72,6 +78,7 @@ const (
 	maxNodeSize  = uint64(unsafe.Sizeof(node{}))
 	linksSize    = uint64(unsafe.Sizeof(links{}))
 	maxNodesSize = constants.MaxUint32OrInt
+	spansSize    = uint64(unsafe.Sizeof([maxHeight]uint32{}))
 )
 
 var (
@@ -84,6 +91,15 @@ var (
 	// nodes slice exceeds the maximum allowed size (currently 1 << 32 - 1). This
 	// corresponds to ~117 M skiplist entries.
 	ErrTooManyRecords = errors.New("too many records")
+
+	// ErrInconsistentAbbreviatedKey is returned when adding a record to a
+	// skiplist constructed WithAbbreviatedKeyValidation reveals that the
+	// abbreviated key function orders records differently than the comparer.
+	ErrInconsistentAbbreviatedKey = errors.New("abbreviated key is inconsistent with the comparer")
+
+	// ErrArenaFull is returned when adding a record to a skiplist constructed by
+	// NewConcurrentSkiplist whose fixed-size nodes slice is exhausted.
+	ErrArenaFull = errors.New("allocation failed because arena is full")
 )
 
 type links struct {
@@ -92,11 +108,18 @@ type links struct {
 }
 
 type node struct {
-	// The offset of the start of the record in the storage.
+	// The offset of the start of the record in the storage. Zero is a valid
+	// record offset. The head and tail sentinels also store a zero offset, so
+	// sentinels must always be identified by their node offset (see
+	// Skiplist.isSentinel) and never by the contents of their fields, and their
+	// keys must never be read (invariants builds check this in getKey).
 	offset uint32
 	// The offset of the start and end of the key in storage.
 	keyStart uint32
 	keyEnd   uint32
+	// The height of the node's link tower. This occupies what would otherwise
+	// be padding before abbreviatedKey.
+	height uint32
 	// A fixed 8-byte abbreviation of the key, used to avoid retrieval of the key
 	// during seek operations. The key retrieval can be expensive purely due to
 	// cache misses while the abbreviatedKey stored here will be in the same
@@ -111,157 +134,1437 @@ type node struct {
 	links [maxHeight]links
 }
 
-// Skiplist is a fast, non-cocnurrent skiplist implementation that supports
-// forward and backward iteration. See arenaskl.Skiplist for a concurrent
-// skiplist. Keys and values are stored externally from the skiplist via the
-// Storage interface. Deletion is not supported. Instead, higher-level code is
-// expected to perform deletion via tombstones and needs to process those
-// tombstones appropriately during retrieval operations.
+// Skiplist is a fast skiplist implementation that supports forward and
+// backward iteration. A skiplist created by NewConcurrentSkiplist may be read
+// concurrently with its single writer; see arenaskl.Skiplist for a skiplist
+// that supports concurrent writers. Keys and values are stored externally
+// from the skiplist via the Storage interface. Records may be removed from the
+// index (see DeleteByOffset), but higher-level code is expected to perform
+// deletion of keys via tombstones and needs to process those tombstones
+// appropriately during retrieval operations.
 type Skiplist struct {
 	storage        *[]byte
 	cmp            base.Compare
 	abbreviatedKey base.AbbreviatedKey
 	nodes          []byte
-	head           uint32
-	tail           uint32
-	height         uint32 // Current height: 1 <= height <= maxHeight
+	head           uint32 // Node offset of the head sentinel; always 0
+	tail           uint32 // Node offset of the tail sentinel
+	height         uint32 // Current height: 1 <= height <= heightLimit
+	heightLimit    uint32 // Maximum tower height; the height of the sentinels
+	count          uint32 // Number of records in the skiplist
 	rand           rand.PCGSource
+	probabilities  *[maxHeight]uint32
+	opts           options
+	seqTag         uint32 // Sequence tag of the next node if WithSequenceTags
+	generation     uint32 // Incremented whenever nodes are removed; see Splice
+	incarnation    uint32 // Incremented by Reset and Init; see Checkpoint
+	stats          Stats  // Maintained only if WithStats
+	arenaUsed      uint32 // Bytes of the nodes slice allocated if concurrent
+}
+
+// Option configures optional behavior of a Skiplist.
+type Option func(*options)
+
+type options struct {
+	rank    bool
+	stable  bool
+	seqTags bool
+	values  bool
+	stats   bool
+	pValue  float64
+	// maxHeight is the maximum tower height, or zero for the default of
+	// maxHeight.
+	maxHeight uint32
+	// validateAbbreviatedKeys is the number of records for which the
+	// abbreviated key is validated, set by WithAbbreviatedKeyValidation.
+	validateAbbreviatedKeys uint32
+	// maxKeyLength is the maximum length of a user key, or zero for no limit.
+	maxKeyLength uint32
+	// rejectEmptyKeys is set by WithoutEmptyKeys.
+	rejectEmptyKeys bool
+	// descending is set by WithDescending.
+	descending bool
+	// concurrent is set by NewConcurrentSkiplist, which also sets the fixed
+	// size of the nodes slice.
+	concurrent bool
+	arenaSize  uint32
+	// seed is the seed of the source of random tower heights, if seeded is set
+	// by WithSeed.
+	seed   uint64
+	seeded bool
 }
 
+// Stats holds counters of the work performed when searching a skiplist
+// constructed WithStats. The searches counted are those performed by Add and
+// by the SeekGE, SeekLT and SeekGEWithMatch methods of iterators.
+type Stats struct {
+	// Comparisons is the number of comparisons of a search key against the key
+	// of a node, whether decided by the abbreviated keys alone or not.
+	Comparisons uint64
+	// KeyFetches is the number of comparisons for which the abbreviated keys
+	// were equal, requiring the key of the node to be retrieved from the storage
+	// and compared using the comparer.
+	KeyFetches uint64
+	// LinkTraversals is the number of links followed.
+	LinkTraversals uint64
+}
+
+// WithStats enables maintenance of counters of the link traversals and key
+// comparisons performed by searches, which are returned by Skiplist.Stats.
+// The counters are useful for evaluating the effect of the abbreviated key
+// function and pvalue on a workload. When disabled, maintaining the counters
+// costs a single branch.
+func WithStats() Option {
+	return func(opts *options) {
+		opts.stats = true
+	}
+}
+
+// WithRank enables maintenance of span counters alongside every link: the
+// span of a link is the number of level 0 links it skips over. The counters
+// allow Rank to be computed in O(log n) at the cost of 4 additional bytes per
+// level of each node's tower.
+func WithRank() Option {
+	return func(opts *options) {
+		opts.rank = true
+	}
+}
+
+// WithSequenceTags enables tagging every node with a monotonically increasing
+// sequence number assigned when the node is inserted. Nodes with equal user
+// keys are ordered by ascending sequence tag, so that multiple records for a
+// user key are iterated in insertion order (oldest first, newest last) rather
+// than by descending offset. Note that iterators over such a skiplist then
+// return equal user keys with ascending sequence numbers, which does not match
+// the internal key ordering; this mode is not suitable for indexing a batch
+// that is read through the LSM. Sequence tags cost 4 additional bytes per
+// node.
+func WithSequenceTags() Option {
+	return func(opts *options) {
+		opts.seqTags = true
+	}
+}
+
+// defaultPValue is the probability with which a node's tower extends to each
+// successive level. The inverse of Euler's number is the optimal pvalue.
+const defaultPValue = 1 / math.E
+
 var (
 	probabilities [maxHeight]uint32
 )
 
 func init() {
-	const pValue = 1 / math.E
+	computeProbabilities(defaultPValue, &probabilities)
+}
 
-	// Precompute the skiplist probabilities so that only a single random number
-	// needs to be generated and so that the optimal pvalue can be used (inverse
-	// of Euler's number).
+// computeProbabilities precomputes the skiplist probabilities for the given
+// pvalue so that only a single random number needs to be generated per node.
+func computeProbabilities(pValue float64, probs *[maxHeight]uint32) {
 	p := float64(1.0)
 	for i := 0; i < maxHeight; i++ {
-		probabilities[i] = uint32(float64(math.MaxUint32) * p)
+		probs[i] = uint32(float64(math.MaxUint32) * p)
 		p *= pValue
 	}
 }
 
-// NewSkiplist constructs and initializes a new, empty skiplist.
-func NewSkiplist(storage *[]byte, cmp base.Compare, abbreviatedKey base.AbbreviatedKey) *Skiplist {
+// WithValues enables storage of a fixed-size value inline in every node,
+// supplied by AddWithValue and returned by Iterator.Value. Inline values allow
+// a small quantity associated with a record (e.g. a block offset) to be
+// retrieved without accessing the storage. Values cost 8 additional bytes per
+// node.
+func WithValues() Option {
+	return func(opts *options) {
+		opts.values = true
+	}
+}
+
+// WithPValue sets the probability with which a node's tower extends to each
+// successive level, which must be within (0, 1). A lower pvalue produces
+// shorter towers on average, reducing memory usage at the cost of slower
+// seeks, while a higher pvalue does the opposite. The default is 1/e.
+func WithPValue(pValue float64) Option {
+	if !(pValue > 0 && pValue < 1) {
+		panic(errors.AssertionFailedf("pvalue %f is not within (0, 1)", pValue))
+	}
+	return func(opts *options) {
+		opts.pValue = pValue
+	}
+}
+
+// WithMaxHeight limits the height of the link towers of the skiplist's nodes,
+// which must be within [1, 20]: nodes whose randomly chosen height would
+// exceed the limit are clamped to it. The head and tail sentinels are only
+// allocated with towers of this height, reducing the memory used by small
+// skiplists. A lower limit degrades seek performance once the skiplist grows
+// large enough to benefit from taller towers. The default, and maximum, is 20.
+func WithMaxHeight(height int) Option {
+	if height < 1 || height > maxHeight {
+		panic(errors.AssertionFailedf("max height %d is not within [1, %d]", height, maxHeight))
+	}
+	return func(opts *options) {
+		opts.maxHeight = uint32(height)
+	}
+}
+
+// WithSeed seeds the source of random tower heights of the skiplist with the
+// given seed, rather than the current time. Skiplists constructed with the
+// same seed, options and sequence of added records have identical node
+// layouts, allowing tests to reproduce a layout exactly. The source is
+// reseeded whenever the skiplist is reinitialized, for example by
+// ResetWithCap.
+func WithSeed(seed uint64) Option {
+	return func(opts *options) {
+		opts.seed = seed
+		opts.seeded = true
+	}
+}
+
+// WithAbbreviatedKeyValidation enables validation of the abbreviated key
+// function against the comparer while the skiplist indexes at most n records:
+// every record added is checked against its neighbors, and if the comparer and
+// abbreviated keys order them differently, the record is not added and an
+// error wrapping ErrInconsistentAbbreviatedKey is returned. An inconsistent
+// abbreviated key function otherwise silently misorders records. Validation
+// costs two additional key comparisons per record added, so bounding it to the
+// first records allows an integration to be checked at little cost to large
+// batches. The number of records n must be positive. Invariants builds always
+// validate every record, panicking on an inconsistency.
+func WithAbbreviatedKeyValidation(n int) Option {
+	if n <= 0 || n > math.MaxUint32 {
+		panic(errors.AssertionFailedf("batchskl: invalid number of records to validate %d", n))
+	}
+	return func(opts *options) {
+		opts.validateAbbreviatedKeys = uint32(n)
+	}
+}
+
+// WithMaxKeyLength limits the length of the user keys of the records added to
+// the skiplist to n bytes, which must be positive: adding a record with a
+// longer key returns an error. By default the length of keys is unlimited.
+// Limiting it catches bugs in the encoding of records early.
+func WithMaxKeyLength(n int) Option {
+	if n <= 0 || n > math.MaxUint32 {
+		panic(errors.AssertionFailedf("batchskl: invalid maximum key length %d", n))
+	}
+	return func(opts *options) {
+		opts.maxKeyLength = uint32(n)
+	}
+}
+
+// WithoutEmptyKeys causes adding a record with an empty user key to the
+// skiplist to return an error. By default empty keys are permitted.
+func WithoutEmptyKeys() Option {
+	return func(opts *options) {
+		opts.rejectEmptyKeys = true
+	}
+}
+
+// WithDescending orders the records of the skiplist by descending user key,
+// so that First and Next walk from the largest key to the smallest. The sense
+// of every comparison of keys and abbreviated keys is reversed, and every
+// method that depends on the order of keys uses the reversed order: SeekGE
+// positions the iterator at the first record whose key is less than or equal
+// to the sought key and SeekLT at the last record whose key is greater, a
+// lower bound excludes records with larger keys and an upper bound those with
+// smaller or equal keys, and Rank and CountRange count records by descending
+// key. Abbreviated keys supplied by callers, for example to
+// AddWithAbbreviatedKey, are those computed by the abbreviated key function
+// the skiplist was constructed with. The order of records with equal user keys
+// is unaffected.
+func WithDescending() Option {
+	return func(opts *options) {
+		opts.descending = true
+	}
+}
+
+// WithStableStorage declares that the bytes of the storage are never modified
+// or reused once a record has been added to the skiplist, for example because
+// the storage is append-only and never reset. Keys returned by iterators over
+// such a skiplist may be retained indefinitely without copying. See
+// Iterator.StableKeys.
+func WithStableStorage() Option {
+	return func(opts *options) {
+		opts.stable = true
+	}
+}
+
+// NewSkiplist constructs and initializes a new, empty skiplist. The
+// abbreviatedKey function must be consistent with cmp as described by
+// base.AbbreviatedKey: it is used to order records before cmp is consulted, so
+// an inconsistent abbreviatedKey misorders records. In invariants builds,
+// every added record is checked against its neighbors for such
+// inconsistencies.
+func NewSkiplist(
+	storage *[]byte, cmp base.Compare, abbreviatedKey base.AbbreviatedKey, opts ...Option,
+) *Skiplist {
 	s := &Skiplist{}
-	s.Init(storage, cmp, abbreviatedKey)
+	s.Init(storage, cmp, abbreviatedKey, opts...)
 	return s
 }
 
+// NewConcurrentSkiplist constructs and initializes a new, empty skiplist that
+// permits a single writer to add records while any number of readers iterate
+// over the skiplist concurrently, without synchronization. Links are published
+// with atomic operations, and a new node is linked into level 0 before the
+// levels above it, so that readers observe every node either fully linked at
+// level 0 or not at all; a reader moving backward may not observe a node that
+// a concurrent reader moving forward does.
+//
+// Since growing the nodes slice would move the nodes out from under readers,
+// the nodes slice is allocated once with a fixed size of arenaSize bytes, and
+// adding a record returns ErrArenaFull once it is exhausted (see Grow for an
+// estimate of the size required). For the same reason, the storage slice must
+// not be modified while readers are active: every record must be written to
+// the storage before it is added, without reallocating or resizing the
+// storage.
+//
+// Only iterators returned by NewIter may be used by readers; every other
+// method may only be called by the writer. Truncate and UpdateKeyOffset
+// return an error, and WithStats and WithValues may not be specified, as they
+// would modify state observed by readers.
+func NewConcurrentSkiplist(
+	storage *[]byte,
+	cmp base.Compare,
+	abbreviatedKey base.AbbreviatedKey,
+	arenaSize int,
+	opts ...Option,
+) *Skiplist {
+	opts = append(opts[:len(opts):len(opts)], func(opts *options) {
+		if opts.stats || opts.values {
+			panic(errors.AssertionFailedf("batchskl: WithStats and WithValues cannot be used concurrently"))
+		}
+		if arenaSize <= 0 || uint64(arenaSize) > maxNodesSize {
+			panic(errors.AssertionFailedf("batchskl: invalid arena size %d", arenaSize))
+		}
+		opts.concurrent = true
+		opts.arenaSize = uint32(arenaSize)
+	})
+	return NewSkiplist(storage, cmp, abbreviatedKey, opts...)
+}
+
+// BuildSkiplist constructs a skiplist indexing the records at the given
+// offsets in the storage, which must already be in the skiplist's order:
+// ascending by user key (or descending if WithDescending is specified), with
+// records with equal user keys ordered by descending offset (or in any order
+// if WithSequenceTags is specified, in which case the records are tagged in
+// the given order). Rather than searching for the position of each record,
+// every node is linked in after the last node at each level of its tower,
+// building the skiplist in O(n) with a single allocation of the nodes slice.
+// The order of the records is verified in invariants builds. An error is
+// returned if a record is malformed.
+func BuildSkiplist(
+	storage *[]byte,
+	cmp base.Compare,
+	abbreviatedKey base.AbbreviatedKey,
+	offsets []uint32,
+	opts ...Option,
+) (*Skiplist, error) {
+	s := NewSkiplist(storage, cmp, abbreviatedKey, opts...)
+	if _, err := s.build(offsets, false /* dropDuplicates */, false /* keepLast */); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// BuildSkiplistWithoutDuplicates is like BuildSkiplist, but indexes only one
+// record of each run of records with equal user keys: the last of the run if
+// keepLast is true, and the first otherwise. The records within a run may be
+// in any order. The number of records dropped is returned.
+func BuildSkiplistWithoutDuplicates(
+	storage *[]byte,
+	cmp base.Compare,
+	abbreviatedKey base.AbbreviatedKey,
+	offsets []uint32,
+	keepLast bool,
+	opts ...Option,
+) (_ *Skiplist, dropped int, _ error) {
+	s := NewSkiplist(storage, cmp, abbreviatedKey, opts...)
+	dropped, err := s.build(offsets, true /* dropDuplicates */, keepLast)
+	if err != nil {
+		return nil, 0, err
+	}
+	return s, dropped, nil
+}
+
+// build appends the records at the given offsets to the empty skiplist. If
+// dropDuplicates is true, the record appended for each run of equal user keys
+// is held back until the end of the run, so that it may be replaced by a later
+// record of the run if keepLast is true.
+func (s *Skiplist) build(offsets []uint32, dropDuplicates, keepLast bool) (dropped int, _ error) {
+	s.Grow(len(offsets))
+	var pending struct {
+		ok                       bool
+		offset, keyStart, keyEnd uint32
+		abbreviatedKey           uint64
+	}
+	flush := func() error {
+		if !pending.ok {
+			return nil
+		}
+		pending.ok = false
+		_, err := s.appendNode(s.randomHeight(), pending.offset, pending.keyStart, pending.keyEnd,
+			pending.abbreviatedKey)
+		return err
+	}
+	for _, offset := range offsets {
+		keyStart, keyEnd, err := s.decodeKey(offset)
+		if err != nil {
+			return 0, err
+		}
+		key := (*s.storage)[keyStart:keyEnd]
+		abbreviatedKey := s.abbreviatedKey(key)
+		if pending.ok && pending.abbreviatedKey == abbreviatedKey &&
+			s.cmp((*s.storage)[pending.keyStart:pending.keyEnd], key) == 0 {
+			dropped++
+			if keepLast {
+				pending.offset, pending.keyStart, pending.keyEnd = offset, keyStart, keyEnd
+			}
+			continue
+		}
+		if err := flush(); err != nil {
+			return 0, err
+		}
+		if invariants.Enabled {
+			if last := s.getPrev(s.tail, 0); !s.nodeBefore(last, key, abbreviatedKey, s.newOrder(offset)) {
+				panic(errors.AssertionFailedf("batchskl: record at offset %d is out of order", errors.Safe(offset)))
+			}
+		}
+		pending.ok = true
+		pending.offset, pending.keyStart, pending.keyEnd = offset, keyStart, keyEnd
+		pending.abbreviatedKey = abbreviatedKey
+		if !dropDuplicates {
+			if err := flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return dropped, flush()
+}
+
 // Reset the fields in the skiplist for reuse.
 func (s *Skiplist) Reset() {
 	*s = Skiplist{
-		nodes:  s.nodes[:0],
-		height: 1,
+		nodes:       s.nodes[:0],
+		generation:  s.generation + 1,
+		incarnation: s.incarnation + 1,
 	}
+	s.height = 1
 	const batchMaxRetainedSize = 1 << 20 // 1 MB
 	if cap(s.nodes) > batchMaxRetainedSize {
 		s.nodes = nil
 	}
 }
 
+// ResetWithCap resets the skiplist to empty, indexing the given storage with
+// the comparer, abbreviated key function and options it was constructed with.
+// Unlike Reset, the skiplist is immediately ready for use. The nodes slice is
+// retained for reuse only if its capacity is at most maxRetainedCap bytes;
+// otherwise it is released and a small one allocated, so that a skiplist
+// reused from a pool does not retain the memory of the largest batch it ever
+// indexed.
+func (s *Skiplist) ResetWithCap(storage *[]byte, maxRetainedCap int) {
+	if cap(s.nodes) > maxRetainedCap {
+		s.nodes = nil
+	}
+	s.init(storage, s.cmp, s.abbreviatedKey, s.opts)
+}
+
 // Init the skiplist to empty and re-initialize.
-func (s *Skiplist) Init(storage *[]byte, cmp base.Compare, abbreviatedKey base.AbbreviatedKey) {
+func (s *Skiplist) Init(
+	storage *[]byte, cmp base.Compare, abbreviatedKey base.AbbreviatedKey, opts ...Option,
+) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.descending {
+		cmp, abbreviatedKey = reverseCompare(cmp), reverseAbbreviatedKey(abbreviatedKey)
+	}
+	s.init(storage, cmp, abbreviatedKey, o)
+}
+
+// reverseCompare returns a comparer ordering keys in the opposite order to
+// cmp, for WithDescending.
+func reverseCompare(cmp base.Compare) base.Compare {
+	return func(a, b []byte) int {
+		return cmp(b, a)
+	}
+}
+
+// reverseAbbreviatedKey returns an abbreviated key function consistent with
+// reverseCompare(cmp) if abbreviatedKey is consistent with cmp. Complementing
+// the abbreviated key reverses its order while preserving equality.
+func reverseAbbreviatedKey(abbreviatedKey base.AbbreviatedKey) base.AbbreviatedKey {
+	return func(key []byte) uint64 {
+		return ^abbreviatedKey(key)
+	}
+}
+
+// suppliedAbbreviatedKey converts an abbreviated key computed by the
+// abbreviated key function the skiplist was constructed with into the
+// abbreviated key used to order its records.
+func (s *Skiplist) suppliedAbbreviatedKey(abbreviatedKey uint64) uint64 {
+	if s.opts.descending {
+		return ^abbreviatedKey
+	}
+	return abbreviatedKey
+}
+
+func (s *Skiplist) init(
+	storage *[]byte, cmp base.Compare, abbreviatedKey base.AbbreviatedKey, opts options,
+) {
 	*s = Skiplist{
 		storage:        storage,
 		cmp:            cmp,
 		abbreviatedKey: abbreviatedKey,
 		nodes:          s.nodes[:0],
-		height:         1,
+		heightLimit:    maxHeight,
+		probabilities:  &probabilities,
+		opts:           opts,
+		generation:     s.generation + 1,
+		incarnation:    s.incarnation + 1,
+	}
+	s.height = 1
+	if opts.maxHeight != 0 {
+		s.heightLimit = opts.maxHeight
+	}
+	if opts.pValue != 0 && opts.pValue != defaultPValue {
+		s.probabilities = new([maxHeight]uint32)
+		computeProbabilities(opts.pValue, s.probabilities)
+	}
+	if opts.seeded {
+		s.rand.Seed(opts.seed)
+	} else {
+		s.rand.Seed(uint64(time.Now().UnixNano()))
 	}
-	s.rand.Seed(uint64(time.Now().UnixNano()))
 
 	const initBufSize = 256
-	if cap(s.nodes) < initBufSize {
+	if opts.concurrent {
+		// The nodes slice is never resized, sparing readers from observing a
+		// change to its length.
+		if uint32(cap(s.nodes)) < opts.arenaSize {
+			s.nodes = make([]byte, opts.arenaSize)
+		}
+		s.nodes = s.nodes[:opts.arenaSize]
+	} else if cap(s.nodes) < initBufSize {
 		s.nodes = make([]byte, 0, initBufSize)
 	}
 
 	// Allocate head and tail nodes. While allocating a new node can fail, in the
 	// context of initializing the skiplist we consider it unrecoverable.
 	var err error
-	s.head, err = s.newNode(maxHeight, 0, 0, 0, 0)
+	s.head, err = s.newNode(s.heightLimit, 0, 0, 0, 0)
 	if err != nil {
 		panic(err)
 	}
-	s.tail, err = s.newNode(maxHeight, 0, 0, 0, 0)
+	s.tail, err = s.newNode(s.heightLimit, 0, 0, 0, 0)
 	if err != nil {
 		panic(err)
 	}
 
-	// Link all head/tail levels together.
+	// Link all head/tail levels together. The tail also links to itself, as the
+	// head's prev links already do, so that moving past either end of the
+	// skiplist remains there rather than reaching the key of the other sentinel.
 	headNode := s.node(s.head)
 	tailNode := s.node(s.tail)
-	for i := uint32(0); i < maxHeight; i++ {
+	for i := uint32(0); i < s.heightLimit; i++ {
 		headNode.links[i].next = s.tail
 		tailNode.links[i].prev = s.head
+		tailNode.links[i].next = s.tail
+	}
+	if s.opts.rank {
+		s.spans(s.head)[0] = 1
+	}
+}
+
+// Add adds a new key to the skiplist if it does not yet exist. If the record
+// already exists, then Add returns ErrRecordExists.
+//
+// Add does not panic on a malformed record or when the skiplist is full.
+// Instead it returns an error and leaves the skiplist unmodified:
+//   - a keyOffset outside of the storage or a record whose key does not fit
+//     within the storage results in a corrupted batch entry error.
+//   - a new node that would not fit in the nodes slice results in
+//     ErrTooManyRecords.
+func (s *Skiplist) Add(keyOffset uint32) error {
+	_, err := s.AddNode(keyOffset)
+	return err
+}
+
+// AddNode is like Add, but also returns the offset of the new node in the
+// skiplist's nodes slice. Node offsets remain valid while the nodes slice
+// grows, as growing only copies the nodes, and so may be retained as handles
+// to the node, e.g. for use with UpdateKeyOffset. A node offset is
+// invalidated if the node is removed or the skiplist is reset or truncated to
+// a checkpoint taken before the node was added.
+func (s *Skiplist) AddNode(keyOffset uint32) (nodeOffset uint32, err error) {
+	keyStart, keyEnd, err := s.decodeKey(keyOffset)
+	if err != nil {
+		return 0, err
+	}
+	key := (*s.storage)[keyStart:keyEnd]
+	return s.addNode(keyOffset, keyStart, keyEnd, key, s.abbreviatedKey(key))
+}
+
+// AddWithAbbreviatedKey is like Add, but uses the supplied abbreviated key of
+// the record's key rather than computing it, for callers that already hold
+// it. The abbreviated key must equal the one computed by the skiplist's
+// abbreviated key function, which is verified in invariants builds.
+func (s *Skiplist) AddWithAbbreviatedKey(keyOffset uint32, abbreviatedKey uint64) error {
+	keyStart, keyEnd, err := s.decodeKey(keyOffset)
+	if err != nil {
+		return err
+	}
+	abbreviatedKey = s.suppliedAbbreviatedKey(abbreviatedKey)
+	key := (*s.storage)[keyStart:keyEnd]
+	if invariants.Enabled {
+		s.checkSuppliedAbbreviatedKey(key, abbreviatedKey)
+	}
+	_, err = s.addNode(keyOffset, keyStart, keyEnd, key, abbreviatedKey)
+	return err
+}
+
+// checkSuppliedAbbreviatedKey panics if abbreviatedKey is not the abbreviated
+// key of key.
+func (s *Skiplist) checkSuppliedAbbreviatedKey(key []byte, abbreviatedKey uint64) {
+	if expected := s.abbreviatedKey(key); abbreviatedKey != expected {
+		panic(errors.AssertionFailedf("batchskl: supplied abbreviated key %016x of %q does not match %016x",
+			abbreviatedKey, key, expected))
+	}
+}
+
+func (s *Skiplist) addNode(
+	keyOffset, keyStart, keyEnd uint32, key []byte, abbreviatedKey uint64,
+) (nodeOffset uint32, err error) {
+
+	// spl holds the list of next and previous links for each level in the
+	// skiplist indicating where the new node will be inserted.
+	var spl [maxHeight]splice
+
+	if s.opts.rank {
+		var rank [maxHeight]uint32
+		s.findSpliceRank(key, abbreviatedKey, s.newOrder(keyOffset), &spl, &rank)
+		return s.insert(&spl, &rank, s.randomHeight(), keyOffset, keyStart, keyEnd, abbreviatedKey)
+	}
+
+	// Fast-path for in-order insertion of keys: compare the new key against the
+	// last key. With sequence tags, the new record also sorts after every
+	// existing record with an equal user key.
+	prev := s.getPrev(s.tail, 0)
+	if s.opts.stats && prev != s.head {
+		s.stats.Comparisons++
+		if abbreviatedKey == s.node(prev).abbreviatedKey {
+			s.stats.KeyFetches++
+		}
+	}
+	if prevNode := s.node(prev); prev == s.head ||
+		abbreviatedKey > prevNode.abbreviatedKey ||
+		(abbreviatedKey == prevNode.abbreviatedKey &&
+			s.cmpAfterLast(key, (*s.storage)[prevNode.keyStart:prevNode.keyEnd])) {
+		for level := uint32(0); level < s.height; level++ {
+			spl[level].prev = s.getPrev(s.tail, level)
+			spl[level].next = s.tail
+		}
+	} else if s.opts.seqTags {
+		s.findSpliceRank(key, abbreviatedKey, s.newOrder(keyOffset), &spl, nil)
+	} else {
+		s.findSplice(key, abbreviatedKey, &spl)
+	}
+
+	return s.insert(&spl, nil, s.randomHeight(), keyOffset, keyStart, keyEnd, abbreviatedKey)
+}
+
+// AddWithValue is like Add, but also stores the given value inline in the new
+// node, from where it is returned by Iterator.Value. The skiplist must have
+// been constructed WithValues. Records added by other means have a value of
+// zero.
+func (s *Skiplist) AddWithValue(keyOffset uint32, value uint64) error {
+	if !s.opts.values {
+		return errors.New("batchskl: skiplist was not constructed WithValues")
+	}
+	nd, err := s.AddNode(keyOffset)
+	if err != nil {
+		return err
+	}
+	*s.valueOf(nd) = value
+	return nil
+}
+
+// UpdateKeyOffset retargets the node with the given offset, as returned by
+// AddNode, to the record at newKeyOffset in the storage, without searching for
+// the node. The new record must have the same user key as the node's current
+// record, and must sort in the same position relative to the other records
+// with that user key: by default records with equal user keys are ordered by
+// descending offset, while with sequence tags the order is unaffected by the
+// record offset. Otherwise an error is returned and the node is unmodified.
+func (s *Skiplist) UpdateKeyOffset(nodeOffset, newKeyOffset uint32) error {
+	if s.opts.concurrent {
+		return errors.New("batchskl: cannot update the nodes of a concurrent skiplist")
+	}
+	if nodeOffset <= s.tail || uint64(nodeOffset)+uint64(nodeSize(1)) > uint64(len(s.nodes)) {
+		return errors.Errorf("batchskl: invalid node offset %d", errors.Safe(nodeOffset))
+	}
+	keyStart, keyEnd, err := s.decodeKey(newKeyOffset)
+	if err != nil {
+		return err
+	}
+	key := (*s.storage)[keyStart:keyEnd]
+	n := s.node(nodeOffset)
+	if s.cmp(key, (*s.storage)[n.keyStart:n.keyEnd]) != 0 {
+		return errors.Errorf("batchskl: record at offset %d does not have the user key of node %d",
+			errors.Safe(newKeyOffset), errors.Safe(nodeOffset))
+	}
+	if !s.opts.seqTags {
+		order := uint64(^newKeyOffset)
+		if !s.nodeBefore(n.links[0].prev, key, n.abbreviatedKey, order) ||
+			s.nodeBefore(n.links[0].next, key, n.abbreviatedKey, order) {
+			return errors.Errorf("batchskl: record at offset %d would reorder node %d",
+				errors.Safe(newKeyOffset), errors.Safe(nodeOffset))
+		}
+	}
+	n.offset = newKeyOffset
+	n.keyStart = keyStart
+	n.keyEnd = keyEnd
+	return nil
+}
+
+// cmpAfterLast returns true if a new record with the given key sorts after an
+// existing record with the key last.
+func (s *Skiplist) cmpAfterLast(key, last []byte) bool {
+	c := s.cmp(key, last)
+	return c > 0 || (c == 0 && s.opts.seqTags)
+}
+
+// Splice caches the position in a skiplist at which the most recent record
+// added with AddWithSplice was inserted, allowing a subsequent insert of a
+// nearby key to resume the search from the cached position rather than from
+// the head. The zero value is an empty cache. A Splice may be reused across
+// skiplists; it is ignored by any skiplist other than the one that filled it.
+//
+// The cached position at a level is the pair of adjacent nodes (prev, next)
+// between which the last record was linked. A level of the cache is valid for
+// a new record if prev and next are still adjacent at that level and the
+// record sorts between them. A level stops being valid once a node has been
+// inserted between prev and next (for example by Add or Merge), which is
+// detected by the adjacency check. The whole cache is invalidated if any node
+// is removed from the skiplist (DeleteByOffset, Truncate) or the skiplist is
+// re-initialized (Init, Reset), since removed nodes may still appear adjacent.
+type Splice struct {
+	list       *Skiplist
+	generation uint32
+	height     uint32
+	spl        [maxHeight]splice
+}
+
+// AddWithSplice is like Add, but uses and updates the position cached in sp.
+// The search for the insertion position starts at the lowest level above
+// which every level of the cache is valid for the new record, descending from
+// the head only if no level is. Inserting keys in ascending order, or keys
+// that are clustered near one another, avoids most of the search performed by
+// Add. If the skiplist was constructed WithRank, the span counters require the
+// search to start from the head and the cache provides no benefit.
+func (s *Skiplist) AddWithSplice(keyOffset uint32, sp *Splice) error {
+	keyStart, keyEnd, err := s.decodeKey(keyOffset)
+	if err != nil {
+		return err
+	}
+	key := (*s.storage)[keyStart:keyEnd]
+	abbreviatedKey := s.abbreviatedKey(key)
+	order := s.newOrder(keyOffset)
+
+	var rankBuf [maxHeight]uint32
+	var rank *[maxHeight]uint32
+	spl := &sp.spl
+	if s.opts.rank {
+		rank = &rankBuf
+		s.findSpliceRank(key, abbreviatedKey, order, spl, rank)
+	} else {
+		// Find the lowest level such that the cache is valid at it and every
+		// level above it. Levels added to the skiplist since the cache was
+		// filled are not cached.
+		level := s.height
+		if sp.list == s && sp.generation == s.generation && sp.height == s.height {
+			// The cache describes a single position, so at the levels where prev
+			// and next are still adjacent the bracket at each level contains the
+			// bracket at every lower level. Find the lowest level above which every
+			// level is adjacent, and then the lowest such level that brackets the
+			// record: every level above it brackets the record as well.
+			adjacent := s.height
+			for adjacent > 0 && s.getNext(spl[adjacent-1].prev, adjacent-1) == spl[adjacent-1].next {
+				adjacent--
+			}
+			for l := adjacent; l < s.height; l++ {
+				if s.nodeBefore(spl[l].prev, key, abbreviatedKey, order) &&
+					!s.nodeBefore(spl[l].next, key, abbreviatedKey, order) {
+					level = l
+					break
+				}
+			}
+		}
+		prev := s.head
+		if level < s.height {
+			prev = spl[level].prev
+		}
+		for level > 0 {
+			level--
+			next := s.getNext(prev, level)
+			for s.nodeBefore(next, key, abbreviatedKey, order) {
+				prev = next
+				next = s.getNext(prev, level)
+			}
+			spl[level].prev = prev
+			spl[level].next = next
+		}
+	}
+
+	height := s.randomHeight()
+	nd, err := s.insert(spl, rank, height, keyOffset, keyStart, keyEnd, abbreviatedKey)
+	if err != nil {
+		sp.list = nil
+		return err
+	}
+	// The new node becomes the predecessor at every level it participates in.
+	for level := uint32(0); level < height; level++ {
+		spl[level].prev = nd
+	}
+	sp.list = s
+	sp.generation = s.generation
+	sp.height = s.height
+	return nil
+}
+
+// decodeKey returns the start and end offsets of the key of the record at the
+// given offset in the storage.
+func (s *Skiplist) decodeKey(keyOffset uint32) (keyStart, keyEnd uint32, err error) {
+	if uint64(keyOffset) >= uint64(len(*s.storage)) {
+		return 0, 0, errors.Errorf("corrupted batch entry: %d", errors.Safe(keyOffset))
+	}
+	data := (*s.storage)[keyOffset+1:]
+	v, n := binary.Uvarint(data)
+	if n <= 0 {
+		return 0, 0, errors.Errorf("corrupted batch entry: %d", errors.Safe(keyOffset))
+	}
+	data = data[n:]
+	if v > uint64(len(data)) {
+		return 0, 0, errors.Errorf("corrupted batch entry: %d", errors.Safe(keyOffset))
+	}
+	keyStart = 1 + keyOffset + uint32(n)
+	keyEnd = keyStart + uint32(v)
+	return keyStart, keyEnd, nil
+}
+
+// Grow ensures the nodes slice has capacity for roughly expectedKeys
+// additional records, performing at most a single allocation, so that adding
+// them avoids repeatedly growing and copying the nodes slice. The capacity
+// required is estimated from the expected tower height for the skiplist's
+// pvalue. Grow never shrinks the nodes slice and may be called at any time.
+func (s *Skiplist) Grow(expectedKeys int) {
+	if expectedKeys <= 0 || s.opts.concurrent {
+		return
+	}
+	pValue := s.opts.pValue
+	if pValue == 0 {
+		pValue = defaultPValue
+	}
+	// Tower heights are geometrically distributed with a mean of 1/(1-p) and a
+	// variance of p/(1-p)^2. Allow for the total height of the towers to exceed
+	// its mean by four standard deviations.
+	n := float64(expectedKeys)
+	meanHeight := 1 / (1 - pValue)
+	totalHeight := n*meanHeight + 4*math.Sqrt(n*pValue)/(1-pValue)
+	linkSize := float64(linksSize)
+	fixedSize := float64(nodeSize(1)) - float64(linksSize)
+	// Include the slack that alloc requires beyond the last node.
+	slack := maxNodeSize
+	if s.opts.rank {
+		linkSize += 4
+		slack += spansSize
+	}
+	fixedSize += float64(s.trailerSize())
+	slack += uint64(s.trailerSize())
+	size := uint64(len(s.nodes)) + uint64(math.Ceil(n*fixedSize+totalHeight*linkSize)) + slack
+	if size > maxNodesSize {
+		size = maxNodesSize
+	}
+	if size <= uint64(cap(s.nodes)) {
+		return
+	}
+	tmp := make([]byte, len(s.nodes), size)
+	copy(tmp, s.nodes)
+	s.nodes = tmp
+}
+
+// BytesPerKey returns the average number of bytes of the nodes slice used per
+// record, excluding the head and tail sentinels, or zero if the skiplist is
+// empty. The average includes the link towers, and so reflects the
+// distribution of tower heights, as well as any span counters and sequence
+// tags. Nodes that have been removed (see DeleteByOffset) continue to occupy
+// the nodes slice until the skiplist is compacted, and are included.
+func (s *Skiplist) BytesPerKey() float64 {
+	if s.count == 0 {
+		return 0
+	}
+	sentinels := s.tail + s.nodeAllocSize(s.heightLimit)
+	return float64(s.allocated()-sentinels) / float64(s.count)
+}
+
+// Stats returns the counters of the work performed by searches since the
+// skiplist was initialized. The counters are only maintained if the skiplist
+// was constructed WithStats.
+func (s *Skiplist) Stats() Stats {
+	return s.stats
+}
+
+// Len returns the number of records in the skiplist.
+func (s *Skiplist) Len() int {
+	return int(s.count)
+}
+
+// Bounds returns the record offsets of the first and last records in the
+// skiplist, i.e. the records with the smallest and largest keys, in O(1). If
+// the skiplist is empty, Bounds returns false.
+func (s *Skiplist) Bounds() (min, max uint32, ok bool) {
+	first, last := s.getNext(s.head, 0), s.getPrev(s.tail, 0)
+	if first == s.tail {
+		return 0, 0, false
+	}
+	return s.node(first).offset, s.node(last).offset, true
+}
+
+// DeleteByOffset removes the record at the given offset in the storage from
+// the skiplist, returning false if the record is not in the skiplist. The key
+// of the record is retrieved from the storage to locate its node. Multiple
+// records may share a user key; only the node for the record at offset is
+// removed. The memory used by the node is not reclaimed until the skiplist is
+// compacted (see Compact). Iterators positioned at the removed node must be
+// repositioned before use.
+func (s *Skiplist) DeleteByOffset(offset uint32) bool {
+	keyStart, keyEnd, err := s.decodeKey(offset)
+	if err != nil {
+		return false
+	}
+	key := (*s.storage)[keyStart:keyEnd]
+	abbreviatedKey := s.abbreviatedKey(key)
+	it := Iterator{list: s}
+	_, nd := it.seekForBaseSplice(key, abbreviatedKey)
+	// Search the nodes with an equal user key for the one for the record.
+	for ; nd != s.tail; nd = s.getNext(nd, 0) {
+		n := s.node(nd)
+		if n.abbreviatedKey != abbreviatedKey ||
+			s.cmp((*s.storage)[n.keyStart:n.keyEnd], key) != 0 {
+			return false
+		}
+		if n.offset == offset {
+			s.unlink(nd)
+			return true
+		}
+	}
+	return false
+}
+
+// unlink removes the node nd from every level of the skiplist.
+func (s *Skiplist) unlink(nd uint32) {
+	n := s.node(nd)
+	height := n.height
+	if s.opts.rank {
+		ndSpans := s.spans(nd)
+		for level := uint32(0); level < height; level++ {
+			// The prev node's link absorbs the links skipped by the node.
+			s.spans(n.links[level].prev)[level] += ndSpans[level] - 1
+		}
+		// At the levels above the node's tower, the link that skips over the node
+		// belongs to the closest preceding node with a taller tower. Walk back
+		// along the top level of each preceding node to find it.
+		prev := n.links[height-1].prev
+		for level := height; level < s.height; level++ {
+			for s.node(prev).height <= level {
+				prev = s.node(prev).links[s.node(prev).height-1].prev
+			}
+			s.spans(prev)[level]--
+		}
+	}
+	for level := uint32(0); level < height; level++ {
+		next := n.links[level].next
+		prev := n.links[level].prev
+		s.setNext(prev, level, next)
+		s.setPrev(next, level, prev)
+	}
+	s.count--
+	s.generation++
+}
+
+// Checkpoint records the state of a skiplist so that records added after it
+// can later be discarded. See Skiplist.Checkpoint and Skiplist.Truncate.
+type Checkpoint struct {
+	nodesLen    uint32
+	seqTag      uint32
+	incarnation uint32
+}
+
+// Checkpoint returns a checkpoint of the current state of the skiplist.
+func (s *Skiplist) Checkpoint() Checkpoint {
+	return Checkpoint{nodesLen: s.allocated(), seqTag: s.seqTag, incarnation: s.incarnation}
+}
+
+// Truncate discards every record added to the skiplist after the given
+// checkpoint was taken, restoring the records present at the time of the
+// checkpoint. Records removed after the checkpoint was taken remain removed.
+// Since nodes are allocated sequentially, the discarded nodes are exactly
+// those allocated beyond the checkpoint. Truncate walks every level of the
+// skiplist, re-linking the surviving nodes around the discarded ones, and then
+// releases the memory used by the discarded nodes. An error is returned if the
+// checkpoint does not belong to the current incarnation of the skiplist, that
+// is if the skiplist has been reset or reinitialized since it was taken.
+// Iterators positioned at discarded nodes must be repositioned before use.
+func (s *Skiplist) Truncate(c Checkpoint) error {
+	if s.opts.concurrent {
+		return errors.New("batchskl: cannot truncate a concurrent skiplist")
+	}
+	if c.incarnation != s.incarnation {
+		return errors.New("batchskl: checkpoint taken before the skiplist was reset")
+	}
+	if c.nodesLen > uint32(len(s.nodes)) || c.nodesLen <= s.tail {
+		return errors.Errorf("batchskl: invalid checkpoint (nodes=%d, current=%d)",
+			errors.Safe(c.nodesLen), errors.Safe(len(s.nodes)))
+	}
+	for level := uint32(0); level < s.height; level++ {
+		prev := s.head
+		for nd := s.getNext(s.head, level); nd != s.tail; nd = s.getNext(nd, level) {
+			if nd >= c.nodesLen {
+				if level == 0 {
+					s.count--
+				}
+				continue
+			}
+			s.node(prev).links[level].next = nd
+			s.node(nd).links[level].prev = prev
+			prev = nd
+		}
+		s.node(prev).links[level].next = s.tail
+		s.node(s.tail).links[level].prev = prev
+	}
+	if s.opts.rank {
+		s.recomputeSpans()
+	}
+	s.nodes = s.nodes[:c.nodesLen]
+	s.seqTag = c.seqTag
+	s.generation++
+	return nil
+}
+
+// recomputeSpans recomputes every span counter from the links of the skiplist.
+// The span of a link at level 0 is one, and the span of a link at a higher
+// level is the sum of the spans of the links it skips over one level down.
+func (s *Skiplist) recomputeSpans() {
+	for nd := s.head; nd != s.tail; nd = s.getNext(nd, 0) {
+		s.spans(nd)[0] = 1
+	}
+	for level := uint32(1); level < s.height; level++ {
+		for nd := s.head; nd != s.tail; {
+			next := s.getNext(nd, level)
+			var span uint32
+			for below := nd; below != next; below = s.getNext(below, level-1) {
+				span += s.spans(below)[level-1]
+			}
+			s.spans(nd)[level] = span
+			nd = next
+		}
+	}
+}
+
+// insert allocates a new node with the given height and links it in at the
+// position described by spl, returning the offset of the new node. If span
+// counters are maintained, rank must hold the rank of the prev node of spl at
+// each level.
+func (s *Skiplist) insert(
+	spl *[maxHeight]splice,
+	rank *[maxHeight]uint32,
+	height, offset, keyStart, keyEnd uint32,
+	abbreviatedKey uint64,
+) (nd uint32, err error) {
+	if err := s.checkKeyLength(offset, keyEnd-keyStart); err != nil {
+		return 0, err
+	}
+	// Increase s.height as necessary.
+	if s.height < height {
+		for level := s.height; level < height; level++ {
+			spl[level].next = s.tail
+			spl[level].prev = s.head
+			if s.opts.rank {
+				// The head links directly to the tail at the new level, skipping over
+				// every record.
+				rank[level] = 0
+				s.spans(s.head)[level] = s.count + 1
+			}
+		}
+		s.storeHeight(height)
+	}
+
+	// We always insert from the base level and up. After you add a node in base
+	// level, we cannot create a node in the level above because it would have
+	// discovered the node in the base level.
+	nd, err = s.newNode(height, offset, keyStart, keyEnd, abbreviatedKey)
+	if err != nil {
+		return 0, err
+	}
+	if s.opts.seqTags {
+		*s.seqTagOf(nd) = s.seqTag
+		s.seqTag++
+	}
+	if s.opts.values {
+		*s.valueOf(nd) = 0
+	}
+	// The new node's tower is complete before it is linked into any level, so
+	// that a concurrent reader that reaches it may follow any of its links.
+	newNode := s.node(nd)
+	for level := uint32(0); level < height; level++ {
+		s.storeNext(newNode, level, spl[level].next)
+		s.storePrev(newNode, level, spl[level].prev)
+	}
+	for level := uint32(0); level < height; level++ {
+		s.setNext(spl[level].prev, level, nd)
+		s.setPrev(spl[level].next, level, nd)
+	}
+	if s.opts.rank {
+		newSpans := s.spans(nd)
+		for level := uint32(0); level < height; level++ {
+			prevSpans := s.spans(spl[level].prev)
+			// The new node is rank[0]-rank[level]+1 level 0 links to the right of
+			// the prev node at this level.
+			delta := rank[0] - rank[level]
+			newSpans[level] = prevSpans[level] - delta
+			prevSpans[level] = delta + 1
+		}
+		for level := height; level < s.height; level++ {
+			s.spans(spl[level].prev)[level]++
+		}
+	}
+	s.count++
+	if s.count <= s.opts.validateAbbreviatedKeys {
+		if err := s.verifyAbbreviatedKey(nd); err != nil {
+			s.unlink(nd)
+			return 0, err
+		}
+	} else if invariants.Enabled {
+		if err := s.verifyAbbreviatedKey(nd); err != nil {
+			panic(errors.NewAssertionErrorWithWrappedErrf(err, "batchskl: adding record"))
+		}
+	}
+	return nd, nil
+}
+
+// checkKeyLength returns an error if the length of the user key of the record
+// at the given offset violates the limits configured by WithMaxKeyLength and
+// WithoutEmptyKeys.
+func (s *Skiplist) checkKeyLength(offset, length uint32) error {
+	if length == 0 && s.opts.rejectEmptyKeys {
+		return errors.Errorf("batchskl: record at offset %d has an empty key", errors.Safe(offset))
+	}
+	if s.opts.maxKeyLength != 0 && length > s.opts.maxKeyLength {
+		return errors.Errorf("batchskl: record at offset %d has a key of length %d, exceeding the maximum of %d",
+			errors.Safe(offset), errors.Safe(length), errors.Safe(s.opts.maxKeyLength))
+	}
+	return nil
+}
+
+// verifyAbbreviatedKey returns an error if the node nd is misordered relative
+// to its neighbors at level 0 according to the comparer, or if its abbreviated
+// key orders it differently than the comparer relative to them.
+func (s *Skiplist) verifyAbbreviatedKey(nd uint32) error {
+	n := s.node(nd)
+	key := (*s.storage)[n.keyStart:n.keyEnd]
+	prev, next := n.links[0].prev, n.links[0].next
+	for _, other := range [2]uint32{prev, next} {
+		if s.isSentinel(other) {
+			continue
+		}
+		o := s.node(other)
+		otherKey := (*s.storage)[o.keyStart:o.keyEnd]
+		c := s.cmp(key, otherKey)
+		if (other == prev && c < 0) || (other == next && c > 0) ||
+			(c < 0 && n.abbreviatedKey > o.abbreviatedKey) ||
+			(c > 0 && n.abbreviatedKey < o.abbreviatedKey) ||
+			(c == 0 && n.abbreviatedKey != o.abbreviatedKey) {
+			return errors.Wrapf(ErrInconsistentAbbreviatedKey,
+				"batchskl: abbreviated keys of %q (%016x) and %q (%016x)",
+				key, n.abbreviatedKey, otherKey, o.abbreviatedKey)
+		}
+	}
+	return nil
+}
+
+// appendNode adds a node with the given height after the last node in the
+// skiplist. The new node must sort after every existing node.
+func (s *Skiplist) appendNode(
+	height, offset, keyStart, keyEnd uint32, abbreviatedKey uint64,
+) (uint32, error) {
+	var spl [maxHeight]splice
+	var rank [maxHeight]uint32
+	for level := uint32(0); level < s.height; level++ {
+		spl[level].prev = s.getPrev(s.tail, level)
+		spl[level].next = s.tail
+		if s.opts.rank {
+			// The prev node links to the tail, which has rank count+1.
+			rank[level] = s.count + 1 - s.spans(spl[level].prev)[level]
+		}
+	}
+	return s.insert(&spl, &rank, height, offset, keyStart, keyEnd, abbreviatedKey)
+}
+
+// Compact returns a new skiplist indexing the same records as s, using the
+// same storage, comparer and options. The nodes of the new skiplist retain
+// their tower heights but are allocated contiguously in key order in a nodes
+// slice sized to fit them, excluding any nodes that are no longer linked into
+// s. The receiver is not modified.
+func (s *Skiplist) Compact() *Skiplist {
+	// Size the new nodes slice to fit every node, plus the slack that alloc
+	// requires beyond the last node.
+	size := 2*uint64(s.nodeAllocSize(s.heightLimit)) + maxNodeSize
+	if s.opts.rank {
+		size += spansSize
+	}
+	size += uint64(s.trailerSize())
+	for nd := s.getNext(s.head, 0); nd != s.tail; nd = s.getNext(nd, 0) {
+		size += uint64(s.nodeAllocSize(s.node(nd).height))
+	}
+
+	c := &Skiplist{nodes: make([]byte, 0, size)}
+	c.init(s.storage, s.cmp, s.abbreviatedKey, s.opts)
+	for nd := s.getNext(s.head, 0); nd != s.tail; nd = s.getNext(nd, 0) {
+		n := s.node(nd)
+		cnd, err := c.appendNode(n.height, n.offset, n.keyStart, n.keyEnd, n.abbreviatedKey)
+		if err != nil {
+			// The new skiplist is no larger than s, so it cannot run out of space.
+			panic(errors.NewAssertionErrorWithWrappedErrf(err, "compacting skiplist"))
+		}
+		if s.opts.values {
+			*c.valueOf(cnd) = *s.valueOf(nd)
+		}
+	}
+	return c
+}
+
+// Merge adds all of the records indexed by other to s. Both skiplists must
+// index the same storage. A record indexed by both skiplists (i.e. a record at
+// the same storage offset) is only indexed once in s. Records with equal user
+// keys are ordered by descending offset, mirroring the descending sequence
+// number order of the internal keys they represent. If s was constructed
+// WithSequenceTags, the records from other are instead tagged as they are
+// added, ordering them after the records of s with equal user keys. If both
+// skiplists were constructed WithValues, the values of the records from other
+// are carried over. The other skiplist is not modified.
+//
+// Merge takes advantage of other being sorted: rather than searching from the
+// head of s for every record, the splice found for the previous record is
+// reused at every level that still brackets the next record.
+func (s *Skiplist) Merge(other *Skiplist) error {
+	if s.storage != other.storage {
+		return errors.New("batchskl: cannot merge skiplists with different storage")
+	}
+	if s.opts.descending != other.opts.descending {
+		return errors.New("batchskl: cannot merge skiplists with different orders")
+	}
+	if s == other {
+		return nil
+	}
+
+	// Start with the splice for a record that sorts before all others.
+	var spl [maxHeight]splice
+	for level := uint32(0); level < s.heightLimit; level++ {
+		spl[level].prev = s.head
+		spl[level].next = s.getNext(s.head, level)
+	}
+	var rankBuf [maxHeight]uint32
+	var rank *[maxHeight]uint32
+	for nd := other.getNext(other.head, 0); nd != other.tail; nd = other.getNext(nd, 0) {
+		n := other.node(nd)
+		key := (*s.storage)[n.keyStart:n.keyEnd]
+		order := s.newOrder(n.offset)
+		if s.opts.rank {
+			// Span counters need the rank of the splice at every level, which
+			// requires searching from the head.
+			rank = &rankBuf
+			s.findSpliceRank(key, n.abbreviatedKey, order, &spl, rank)
+		} else {
+			s.repairSplice(key, n.abbreviatedKey, order, &spl)
+		}
+		if s.indexed(&spl, key, n.abbreviatedKey, n.offset) {
+			// The record is already indexed by s.
+			continue
+		}
+		height := s.randomHeight()
+		newNode, err := s.insert(&spl, rank, height, n.offset, n.keyStart, n.keyEnd, n.abbreviatedKey)
+		if err != nil {
+			return err
+		}
+		if s.opts.values && other.opts.values {
+			*s.valueOf(newNode) = *other.valueOf(nd)
+		}
+		// The next record from other sorts after the new node, so the new node
+		// becomes the predecessor at every level it participates in.
+		for level := uint32(0); level < height; level++ {
+			spl[level].prev = newNode
+		}
+	}
+	return nil
+}
+
+// indexed returns true if the record at the given offset is indexed by s,
+// given the splice at which a new node for the record would be inserted.
+func (s *Skiplist) indexed(
+	spl *[maxHeight]splice, key []byte, abbreviatedKey uint64, offset uint32,
+) bool {
+	if !s.opts.seqTags {
+		// Nodes with equal user keys are ordered by offset, so the node for the
+		// record would immediately follow the splice.
+		next := spl[0].next
+		return next != s.tail && s.node(next).offset == offset
+	}
+	// A new node sorts after every node with an equal user key, so search the
+	// nodes with the user key that precede the splice.
+	for nd := spl[0].prev; nd != s.head; nd = s.getPrev(nd, 0) {
+		n := s.node(nd)
+		if n.abbreviatedKey != abbreviatedKey ||
+			s.cmp((*s.storage)[n.keyStart:n.keyEnd], key) != 0 {
+			return false
+		}
+		if n.offset == offset {
+			return true
+		}
 	}
+	return false
 }
 
-// Add adds a new key to the skiplist if it does not yet exist. If the record
-// already exists, then Add returns ErrRecordExists.
-func (s *Skiplist) Add(keyOffset uint32) error {
-	data := (*s.storage)[keyOffset+1:]
-	v, n := binary.Uvarint(data)
-	if n <= 0 {
-		return errors.Errorf("corrupted batch entry: %d", errors.Safe(keyOffset))
+// Get returns the record offset of the first record with the given user key
+// in the skiplist's ordering, or of the last such record if last is true. If
+// there is no record with the user key, Get returns false. By default the
+// first record is the one with the highest offset; if the skiplist was
+// constructed WithSequenceTags, the first record is the one inserted first.
+func (s *Skiplist) Get(key []byte, last bool) (offset uint32, ok bool) {
+	abbreviatedKey := s.abbreviatedKey(key)
+	// Every node with an equal user key sorts after a record with the minimum
+	// order and before a record with the maximum order.
+	order := uint64(0)
+	if last {
+		order = math.MaxUint64
 	}
-	data = data[n:]
-	if v > uint64(len(data)) {
-		return errors.Errorf("corrupted batch entry: %d", errors.Safe(keyOffset))
+	var spl [maxHeight]splice
+	s.findSpliceRank(key, abbreviatedKey, order, &spl, nil)
+	nd := spl[0].next
+	if last {
+		nd = spl[0].prev
 	}
-	keyStart := 1 + keyOffset + uint32(n)
-	keyEnd := keyStart + uint32(v)
-	key := data[:v]
-	abbreviatedKey := s.abbreviatedKey(key)
+	if s.isSentinel(nd) {
+		return 0, false
+	}
+	n := s.node(nd)
+	if n.abbreviatedKey != abbreviatedKey || s.cmp((*s.storage)[n.keyStart:n.keyEnd], key) != 0 {
+		return 0, false
+	}
+	return n.offset, true
+}
 
-	// spl holds the list of next and previous links for each level in the
-	// skiplist indicating where the new node will be inserted.
+// MultiGet looks up each of the given user keys, returning for each the
+// record offset of the first record with that user key, or -1 if there is no
+// such record. MultiGet is intended to be used with keys sorted in ascending
+// order: the splice found for one key is reused at every level that also
+// brackets the next key, so that each lookup resumes from where the previous
+// one finished rather than from the head. Unsorted keys are looked up
+// correctly, but without the benefit of this reuse.
+func (s *Skiplist) MultiGet(keys [][]byte) []int {
+	res := make([]int, len(keys))
 	var spl [maxHeight]splice
-
-	// Fast-path for in-order insertion of keys: compare the new key against the
-	// last key.
-	prev := s.getPrev(s.tail, 0)
-	if prevNode := s.node(prev); prev == s.head ||
-		abbreviatedKey > prevNode.abbreviatedKey ||
-		(abbreviatedKey == prevNode.abbreviatedKey &&
-			s.cmp(key, (*s.storage)[prevNode.keyStart:prevNode.keyEnd]) > 0) {
-		for level := uint32(0); level < s.height; level++ {
-			spl[level].prev = s.getPrev(s.tail, level)
-			spl[level].next = s.tail
+	for level := uint32(0); level < s.heightLimit; level++ {
+		spl[level].prev = s.head
+		spl[level].next = s.getNext(s.head, level)
+	}
+	for i, key := range keys {
+		abbreviatedKey := s.abbreviatedKey(key)
+		// Nodes with equal user keys sort after a record with the minimum order,
+		// positioning spl before the first record with the key.
+		s.repairSplice(key, abbreviatedKey, 0, &spl)
+		res[i] = -1
+		if next := spl[0].next; next != s.tail {
+			n := s.node(next)
+			if n.abbreviatedKey == abbreviatedKey &&
+				s.cmp((*s.storage)[n.keyStart:n.keyEnd], key) == 0 {
+				res[i] = int(n.offset)
+			}
 		}
-	} else {
-		s.findSplice(key, abbreviatedKey, &spl)
 	}
+	return res
+}
 
-	height := s.randomHeight()
-	// Increase s.height as necessary.
-	for ; s.height < height; s.height++ {
-		spl[s.height].next = s.tail
-		spl[s.height].prev = s.head
+// repairSplice updates spl, which must describe a valid splice for some
+// record, so that it describes the position at which the record with the
+// given key and order (see order) belongs. Levels of spl that still bracket
+// the record are reused and only the levels below them are searched again.
+func (s *Skiplist) repairSplice(
+	key []byte, abbreviatedKey uint64, order uint64, spl *[maxHeight]splice,
+) {
+	// The bracket at each level contains the bracket at every lower level, so
+	// once a level brackets the record all higher levels do as well.
+	level := uint32(0)
+	for ; level < s.height; level++ {
+		if s.nodeBefore(spl[level].prev, key, abbreviatedKey, order) &&
+			!s.nodeBefore(spl[level].next, key, abbreviatedKey, order) {
+			break
+		}
+	}
+	prev := s.head
+	if level < s.height {
+		prev = spl[level].prev
+	}
+	for level > 0 {
+		level--
+		next := s.getNext(prev, level)
+		for s.nodeBefore(next, key, abbreviatedKey, order) {
+			prev = next
+			next = s.getNext(prev, level)
+		}
+		spl[level].prev = prev
+		spl[level].next = next
 	}
+}
 
-	// We always insert from the base level and up. After you add a node in base
-	// level, we cannot create a node in the level above because it would have
-	// discovered the node in the base level.
-	nd, err := s.newNode(height, keyOffset, keyStart, keyEnd, abbreviatedKey)
-	if err != nil {
-		return err
+// nodeBefore returns true if the node nd sorts before the record with the
+// given key and order. Nodes with equal user keys are ordered by ascending
+// order (see order). The head sorts before, and the tail after, every record.
+func (s *Skiplist) nodeBefore(nd uint32, key []byte, abbreviatedKey uint64, order uint64) bool {
+	if nd == s.head {
+		return true
 	}
-	newNode := s.node(nd)
-	for level := uint32(0); level < height; level++ {
-		next := spl[level].next
-		prev := spl[level].prev
-		newNode.links[level].next = next
-		newNode.links[level].prev = prev
-		s.node(next).links[level].prev = nd
-		s.node(prev).links[level].next = nd
+	if nd == s.tail {
+		return false
+	}
+	n := s.node(nd)
+	if n.abbreviatedKey != abbreviatedKey {
+		return n.abbreviatedKey < abbreviatedKey
+	}
+	if c := s.cmp((*s.storage)[n.keyStart:n.keyEnd], key); c != 0 {
+		return c < 0
 	}
+	return s.order(nd) < order
+}
 
-	return nil
+// order returns the position of the node nd among the nodes with an equal
+// user key, which are ordered by ascending order. By default nodes are ordered
+// by descending offset, and with sequence tags by ascending sequence tag. The
+// order of every node is within [0, math.MaxUint64).
+func (s *Skiplist) order(nd uint32) uint64 {
+	if s.opts.seqTags {
+		return uint64(*s.seqTagOf(nd))
+	}
+	return uint64(^s.node(nd).offset)
+}
+
+// newOrder returns the order that a new node for the record at the given
+// offset will have.
+func (s *Skiplist) newOrder(offset uint32) uint64 {
+	if s.opts.seqTags {
+		return uint64(s.seqTag)
+	}
+	return uint64(^offset)
 }
 
 // NewIter returns a new Iterator object. The lower and upper bound parameters
@@ -274,21 +1577,44 @@ func (s *Skiplist) NewIter(lower, upper []byte) Iterator {
 	return Iterator{list: s, lower: lower, upper: upper}
 }
 
+// NewBoundedIterator returns a new Iterator constrained to the bounds lower and
+// upper, as if by NewIter followed by SetBounds. The iterator is unpositioned
+// until it is first positioned (see AtStart), and the bounds are checked as
+// with NewIter: the lower bound is not checked on {SeekGE,First} and the upper
+// bound is not checked on {SeekLT,Last}.
+func (s *Skiplist) NewBoundedIterator(lower, upper []byte) Iterator {
+	return s.NewIter(lower, upper)
+}
+
+// NewSnapshotIter is like NewIter, but returns an iterator over the records
+// present in the skiplist at the time of the call: records added afterwards
+// are invisible to the iterator, even as they continue to be added. Nodes are
+// allocated sequentially, so the iterator treats every node allocated after
+// the snapshot was taken as nonexistent, following the links through such
+// nodes while skipping over them. Records removed from the skiplist after the
+// snapshot was taken (see DeleteByOffset) are also removed from the snapshot,
+// and the iterator must not be used after the skiplist is truncated (see
+// Truncate), reset or re-initialized.
+func (s *Skiplist) NewSnapshotIter(lower, upper []byte) Iterator {
+	return Iterator{list: s, lower: lower, upper: upper, snapshotLen: s.allocated()}
+}
+
 func (s *Skiplist) newNode(
 	height,
 	offset, keyStart, keyEnd uint32, abbreviatedKey uint64,
 ) (uint32, error) {
 	if height < 1 || height > maxHeight {
-		panic("height cannot be less than one or greater than the max height")
+		return 0, errors.AssertionFailedf("node height %d is not within [1, %d]",
+			errors.Safe(height), errors.Safe(maxHeight))
 	}
 
-	unusedSize := uint64(maxHeight-int(height)) * linksSize
-	nodeOffset, err := s.alloc(uint32(maxNodeSize - unusedSize))
+	nodeOffset, err := s.alloc(s.nodeAllocSize(height))
 	if err != nil {
 		return 0, err
 	}
 	nd := s.node(nodeOffset)
 
+	nd.height = height
 	nd.offset = offset
 	nd.keyStart = keyStart
 	nd.keyEnd = keyEnd
@@ -297,11 +1623,22 @@ func (s *Skiplist) newNode(
 }
 
 func (s *Skiplist) alloc(size uint32) (uint32, error) {
-	offset := uint64(len(s.nodes))
+	offset := uint64(s.allocated())
 
 	// We only have a need for memory up to offset + size, but we never want
 	// to allocate a node whose tail points into unallocated memory.
 	minAllocSize := offset + maxNodeSize
+	if s.opts.rank {
+		minAllocSize += spansSize
+	}
+	minAllocSize += uint64(s.trailerSize())
+	if s.opts.concurrent {
+		if uint64(len(s.nodes)) < minAllocSize {
+			return 0, ErrArenaFull
+		}
+		s.arenaUsed = uint32(offset) + size
+		return uint32(offset), nil
+	}
 	if uint64(cap(s.nodes)) < minAllocSize {
 		allocSize := uint64(cap(s.nodes)) * 2
 		if allocSize < minAllocSize {
@@ -330,14 +1667,96 @@ func (s *Skiplist) alloc(size uint32) (uint32, error) {
 	return uint32(offset), nil
 }
 
+// allocated returns the number of bytes of the nodes slice allocated to nodes.
+func (s *Skiplist) allocated() uint32 {
+	if s.opts.concurrent {
+		return s.arenaUsed
+	}
+	return uint32(len(s.nodes))
+}
+
 func (s *Skiplist) node(offset uint32) *node {
+	if invariants.Enabled {
+		s.checkNodeOffset(offset)
+	}
 	return (*node)(unsafe.Pointer(&s.nodes[offset]))
 }
 
+// checkNodeOffset panics if offset cannot be the offset of a node: node sizes
+// are multiples of 4 bytes, so every node offset is 4-byte aligned, and a node
+// of height 1 must fit within the allocated nodes. Without this check, an
+// invalid offset that is less than len(s.nodes) would access arbitrary memory
+// beyond the allocated nodes, or a misaligned node. The check cannot verify
+// that offset refers to the start of a node rather than the middle of one.
+func (s *Skiplist) checkNodeOffset(offset uint32) {
+	if offset%4 != 0 || uint64(offset)+uint64(nodeSize(1)) > uint64(len(s.nodes)) {
+		panic(errors.AssertionFailedf("batchskl: invalid node offset %d (nodes=%d)",
+			errors.Safe(offset), errors.Safe(len(s.nodes))))
+	}
+}
+
+// nodeSize returns the size of a node with the given height, excluding any
+// sequence tag, value and span counters.
+func nodeSize(height uint32) uint32 {
+	unusedSize := uint64(maxHeight-int(height)) * linksSize
+	return uint32(maxNodeSize - unusedSize)
+}
+
+// nodeAllocSize returns the number of bytes allocated for a node with the
+// given height, including any sequence tag, value and span counters.
+func (s *Skiplist) nodeAllocSize(height uint32) uint32 {
+	size := nodeSize(height) + s.trailerSize()
+	if s.opts.rank {
+		size += height * 4
+	}
+	return size
+}
+
+// seqTagOf returns the sequence tag of the node at the given offset. The
+// sequence tag is stored immediately after the node's link tower and is only
+// allocated if WithSequenceTags was specified.
+func (s *Skiplist) seqTagOf(offset uint32) *uint32 {
+	size := nodeSize(s.node(offset).height)
+	return (*uint32)(unsafe.Pointer(&s.nodes[offset+size]))
+}
+
+// valueOf returns the inline value of the node at the given offset. The value
+// is stored after the node's link tower and sequence tag, and is only
+// allocated if WithValues was specified.
+func (s *Skiplist) valueOf(offset uint32) *uint64 {
+	size := nodeSize(s.node(offset).height)
+	if s.opts.seqTags {
+		size += 4
+	}
+	return (*uint64)(unsafe.Pointer(&s.nodes[offset+size]))
+}
+
+// spans returns the span counters of the node at the given offset. Only the
+// first height counters are valid. Span counters are stored after the node's
+// link tower, sequence tag and value, and are only allocated if WithRank was
+// specified.
+func (s *Skiplist) spans(offset uint32) *[maxHeight]uint32 {
+	size := nodeSize(s.node(offset).height) + s.trailerSize()
+	return (*[maxHeight]uint32)(unsafe.Pointer(&s.nodes[offset+size]))
+}
+
+// trailerSize returns the number of bytes allocated after each node's link
+// tower for its sequence tag and value, if enabled.
+func (s *Skiplist) trailerSize() uint32 {
+	var size uint32
+	if s.opts.seqTags {
+		size += 4
+	}
+	if s.opts.values {
+		size += 8
+	}
+	return size
+}
+
 func (s *Skiplist) randomHeight() uint32 {
 	rnd := uint32(s.rand.Uint64())
 	h := uint32(1)
-	for h < maxHeight && rnd <= probabilities[h] {
+	for h < s.heightLimit && rnd <= s.probabilities[h] {
 		h++
 	}
 	return h
@@ -354,10 +1773,16 @@ func (s *Skiplist) findSplice(key []byte, abbreviatedKey uint64, spl *[maxHeight
 		// later if inlining improves.
 
 		next := s.getNext(prev, level)
+		if s.opts.stats {
+			s.stats.LinkTraversals++
+		}
 		for next != s.tail {
 			// Assume prev.key < key.
 			nextNode := s.node(next)
 			nextAbbreviatedKey := nextNode.abbreviatedKey
+			if s.opts.stats {
+				s.countComparison(abbreviatedKey, nextAbbreviatedKey)
+			}
 			if abbreviatedKey < nextAbbreviatedKey {
 				// We are done for this level, since prev.key < key < next.key.
 				break
@@ -372,14 +1797,326 @@ func (s *Skiplist) findSplice(key []byte, abbreviatedKey uint64, spl *[maxHeight
 			// Keep moving right on this level.
 			prev = next
 			next = nextNode.links[level].next
+			if s.opts.stats {
+				s.stats.LinkTraversals++
+			}
+		}
+
+		spl[level].prev = prev
+		spl[level].next = next
+		if level == 0 {
+			break
 		}
+	}
+}
 
+// findSpliceRank is like findSplice, but positions the splice for the record
+// with the given key and order (see order) among the nodes with an equal user
+// key. If rank is non-nil, it also computes the rank of the prev node at each
+// level: the number of level 0 links between the head and the node, which
+// requires span counters.
+func (s *Skiplist) findSpliceRank(
+	key []byte,
+	abbreviatedKey uint64,
+	order uint64,
+	spl *[maxHeight]splice,
+	rank *[maxHeight]uint32,
+) {
+	prev := s.head
+	var r uint32
+	for level := s.height - 1; ; level-- {
+		next := s.getNext(prev, level)
+		for s.nodeBefore(next, key, abbreviatedKey, order) {
+			if rank != nil {
+				r += s.spans(prev)[level]
+			}
+			prev = next
+			next = s.getNext(prev, level)
+		}
 		spl[level].prev = prev
 		spl[level].next = next
+		if rank != nil {
+			rank[level] = r
+		}
+		if level == 0 {
+			break
+		}
+	}
+}
+
+// Rank returns the number of records whose user key is less than key. If the
+// skiplist was constructed WithRank, Rank is computed in O(log n) using the
+// span counters. Otherwise Rank walks the records at level 0.
+func (s *Skiplist) Rank(key []byte) int {
+	abbreviatedKey := s.abbreviatedKey(key)
+	if !s.opts.rank {
+		var r int
+		for nd := s.getNext(s.head, 0); nd != s.tail && s.keyLess(nd, key, abbreviatedKey); nd = s.getNext(nd, 0) {
+			r++
+		}
+		return r
+	}
+	prev := s.head
+	var r uint32
+	for level := s.height - 1; ; level-- {
+		next := s.getNext(prev, level)
+		for next != s.tail && s.keyLess(next, key, abbreviatedKey) {
+			r += s.spans(prev)[level]
+			prev = next
+			next = s.getNext(prev, level)
+		}
 		if level == 0 {
 			break
 		}
 	}
+	return int(r)
+}
+
+// Distance returns the number of level 0 links from the node with offset a to
+// the node with offset b, both as returned by AddNode, or false if b does not
+// follow a. The distance from a node to itself is zero. Distance walks the
+// records at level 0 and so takes time proportional to the distance; unlike
+// Rank, it does not use the span counters and so may be used to verify them.
+func (s *Skiplist) Distance(a, b uint32) (int, bool) {
+	var d int
+	for nd := a; nd != b; nd = s.getNext(nd, 0) {
+		if nd == s.tail {
+			return 0, false
+		}
+		d++
+	}
+	return d, true
+}
+
+// CountRange returns the number of records whose user key is within
+// [start, end). If start >= end, CountRange returns 0. If the skiplist was
+// constructed WithRank, the count is computed in O(log n) using the span
+// counters. Otherwise CountRange seeks to start and walks the records at level
+// 0 until reaching end.
+func (s *Skiplist) CountRange(start, end []byte) int {
+	if s.cmp(start, end) >= 0 {
+		return 0
+	}
+	if s.opts.rank {
+		return s.Rank(end) - s.Rank(start)
+	}
+	it := Iterator{list: s}
+	_, nd := it.seekForBaseSplice(start, s.abbreviatedKey(start))
+	endAbbreviatedKey := s.abbreviatedKey(end)
+	var count int
+	for ; nd != s.tail && s.keyLess(nd, end, endAbbreviatedKey); nd = s.getNext(nd, 0) {
+		count++
+	}
+	return count
+}
+
+// PrefixScan invokes fn with the record offset of every record whose user key
+// has the given byte prefix, in key order, stopping early if fn returns false.
+// An empty prefix matches every record. PrefixScan requires that the keys with
+// a given prefix are contiguous in the skiplist's ordering, as is the case for
+// comparers that order keys bytewise.
+func (s *Skiplist) PrefixScan(prefix []byte, fn func(offset uint32) bool) {
+	if s.opts.descending {
+		s.prefixScanDescending(prefix, fn)
+		return
+	}
+	it := Iterator{list: s}
+	_, nd := it.seekForBaseSplice(prefix, s.abbreviatedKey(prefix))
+
+	// Every key with the prefix sorts before the prefix's successor. A node
+	// whose abbreviated key is less than the successor's is therefore known to
+	// have the prefix without retrieving its key.
+	checkKeys := len(prefix) > 0
+	var succAbbreviatedKey uint64
+	if succ := prefixSuccessor(prefix); succ != nil {
+		succAbbreviatedKey = s.abbreviatedKey(succ)
+	}
+	for ; nd != s.tail; nd = s.getNext(nd, 0) {
+		n := s.node(nd)
+		if checkKeys && n.abbreviatedKey >= succAbbreviatedKey &&
+			!bytes.HasPrefix((*s.storage)[n.keyStart:n.keyEnd], prefix) {
+			return
+		}
+		if !fn(n.offset) {
+			return
+		}
+	}
+}
+
+// CollectPrefix returns the record offsets of the records whose user key has
+// the given byte prefix, in key order, as PrefixScan would visit them. At most
+// max offsets are returned, bounding the memory used; if max <= 0, every
+// matching offset is returned. If fewer than max records match, only those
+// are returned, and if none match, CollectPrefix returns nil. The returned
+// slice is freshly allocated and owned by the caller.
+func (s *Skiplist) CollectPrefix(prefix []byte, max int) []uint32 {
+	var offsets []uint32
+	s.PrefixScan(prefix, func(offset uint32) bool {
+		offsets = append(offsets, offset)
+		return max <= 0 || len(offsets) < max
+	})
+	return offsets
+}
+
+// prefixScanDescending implements PrefixScan for a skiplist constructed
+// WithDescending, in which the keys with the prefix follow the prefix's
+// successor (or begin at the head if there is no successor) and precede the
+// prefix itself.
+func (s *Skiplist) prefixScanDescending(prefix []byte, fn func(offset uint32) bool) {
+	nd := s.getNext(s.head, 0)
+	if succ := prefixSuccessor(prefix); succ != nil {
+		it := Iterator{list: s}
+		_, nd = it.seekForBaseSplice(succ, s.abbreviatedKey(succ))
+	}
+	for ; nd != s.tail; nd = s.getNext(nd, 0) {
+		n := s.node(nd)
+		key := (*s.storage)[n.keyStart:n.keyEnd]
+		if !bytes.HasPrefix(key, prefix) {
+			// Records with the successor as their key precede the records with the
+			// prefix.
+			if s.cmp(key, prefix) < 0 {
+				continue
+			}
+			return
+		}
+		if !fn(n.offset) {
+			return
+		}
+	}
+}
+
+// Keys returns a pull-style iterator over the record offsets of the skiplist
+// in key order. Each call to the returned function yields the offset of the
+// next record, returning false once every record has been yielded, and on
+// every call thereafter. Calls do not allocate. As with Iterator, the
+// skiplist must not be modified while the returned function is in use.
+func (s *Skiplist) Keys() func() (offset uint32, ok bool) {
+	nd := s.head
+	return func() (uint32, bool) {
+		if nd == s.tail {
+			return 0, false
+		}
+		nd = s.getNext(nd, 0)
+		if nd == s.tail {
+			return 0, false
+		}
+		return s.node(nd).offset, true
+	}
+}
+
+// SortedOffsets returns the record offsets of every record in key order, in a
+// freshly allocated slice owned by the caller. It is the materialized
+// counterpart to Keys, walking level 0 once into a slice sized exactly to the
+// number of records.
+func (s *Skiplist) SortedOffsets() []uint32 {
+	offsets := make([]uint32, 0, s.count)
+	for nd := s.getNext(s.head, 0); nd != s.tail; nd = s.getNext(nd, 0) {
+		offsets = append(offsets, s.node(nd).offset)
+	}
+	return offsets
+}
+
+// FilterScan walks every record in key order, invoking fn with the record
+// offset of each record whose user key satisfies pred, and stopping early if
+// fn returns false. The key passed to pred aliases the storage and must not be
+// retained or modified.
+func (s *Skiplist) FilterScan(pred func(key []byte) bool, fn func(offset uint32) bool) {
+	for nd := s.getNext(s.head, 0); nd != s.tail; nd = s.getNext(nd, 0) {
+		n := s.node(nd)
+		if pred((*s.storage)[n.keyStart:n.keyEnd]) && !fn(n.offset) {
+			return
+		}
+	}
+}
+
+// prefixSuccessor returns the smallest key that is greater than every key with
+// the given prefix, or nil if there is no such key (i.e. the prefix is empty
+// or consists entirely of 0xff bytes).
+func prefixSuccessor(prefix []byte) []byte {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] != 0xff {
+			succ := append([]byte(nil), prefix[:i+1]...)
+			succ[i]++
+			return succ
+		}
+	}
+	return nil
+}
+
+// Equal returns true if s and other contain the same sequence of user keys,
+// compared using the comparer of s. The skiplists may index different
+// storages, and differences in tower heights and node layout are ignored.
+func (s *Skiplist) Equal(other *Skiplist) bool {
+	if s.count != other.count {
+		return false
+	}
+	a, b := s.getNext(s.head, 0), other.getNext(other.head, 0)
+	for ; a != s.tail && b != other.tail; a, b = s.getNext(a, 0), other.getNext(b, 0) {
+		an, bn := s.node(a), other.node(b)
+		if s.cmp((*s.storage)[an.keyStart:an.keyEnd], (*other.storage)[bn.keyStart:bn.keyEnd]) != 0 {
+			return false
+		}
+	}
+	return a == s.tail && b == other.tail
+}
+
+// HeightOf returns the height of the link tower of the node with the given
+// user key, or false if there is no such node. If multiple records have the
+// user key, the height of the first of their nodes is returned.
+func (s *Skiplist) HeightOf(key []byte) (int, bool) {
+	it := Iterator{list: s}
+	_, nd := it.seekForBaseSplice(key, s.abbreviatedKey(key))
+	if nd == s.tail {
+		return 0, false
+	}
+	n := s.node(nd)
+	if s.cmp((*s.storage)[n.keyStart:n.keyEnd], key) != 0 {
+		return 0, false
+	}
+	return int(n.height), true
+}
+
+// CompareKeys compares the user keys a and b using the same ordering as the
+// skiplist: their abbreviated keys are compared first, falling back to the
+// skiplist's comparer only if the abbreviated keys are equal. External code
+// that must agree exactly with the order of the skiplist's records should use
+// CompareKeys rather than invoking the comparer directly.
+func (s *Skiplist) CompareKeys(a, b []byte) int {
+	if aa, ba := s.abbreviatedKey(a), s.abbreviatedKey(b); aa != ba {
+		if aa < ba {
+			return -1
+		}
+		return +1
+	}
+	return s.cmp(a, b)
+}
+
+// CaseFoldedAbbreviatedKey is an abbreviated key function for comparers that
+// order keys case-insensitively by their ASCII case-folded bytes. Like the
+// abbreviated key of base.DefaultComparer, it returns the first eight bytes of
+// the key in big-endian order, but with ASCII upper case letters folded to
+// lower case, so that it is consistent with such a comparer.
+func CaseFoldedAbbreviatedKey(key []byte) uint64 {
+	if len(key) > 8 {
+		key = key[:8]
+	}
+	var v uint64
+	for i, c := range key {
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		v |= uint64(c) << (56 - 8*uint(i))
+	}
+	return v
+}
+
+// keyLess returns true if the user key of the node nd is less than key.
+func (s *Skiplist) keyLess(nd uint32, key []byte, abbreviatedKey uint64) bool {
+	n := s.node(nd)
+	if n.abbreviatedKey != abbreviatedKey {
+		return n.abbreviatedKey < abbreviatedKey
+	}
+	return s.cmp((*s.storage)[n.keyStart:n.keyEnd], key) < 0
 }
 
 func (s *Skiplist) findSpliceForLevel(
@@ -387,11 +2124,17 @@ func (s *Skiplist) findSpliceForLevel(
 ) (prev, next uint32) {
 	prev = start
 	next = s.getNext(prev, level)
+	if s.opts.stats {
+		s.stats.LinkTraversals++
+	}
 
 	for next != s.tail {
 		// Assume prev.key < key.
 		nextNode := s.node(next)
 		nextAbbreviatedKey := nextNode.abbreviatedKey
+		if s.opts.stats {
+			s.countComparison(abbreviatedKey, nextAbbreviatedKey)
+		}
 		if abbreviatedKey < nextAbbreviatedKey {
 			// We are done for this level, since prev.key < key < next.key.
 			break
@@ -405,13 +2148,44 @@ func (s *Skiplist) findSpliceForLevel(
 
 		// Keep moving right on this level.
 		prev = next
-		next = nextNode.links[level].next
+		next = s.loadNext(nextNode, level)
+		if s.opts.stats {
+			s.stats.LinkTraversals++
+		}
 	}
 
 	return
 }
 
+// countComparison counts a comparison of a search key against the key of a
+// node, given their abbreviated keys.
+func (s *Skiplist) countComparison(abbreviatedKey, nodeAbbreviatedKey uint64) {
+	s.stats.Comparisons++
+	if abbreviatedKey == nodeAbbreviatedKey {
+		s.stats.KeyFetches++
+	}
+}
+
+// isSentinel returns true if nd is the node offset of the head or tail
+// sentinel. The sentinels have no key, and their fields are indistinguishable
+// from those of a record with an empty key at storage offset zero.
+func (s *Skiplist) isSentinel(nd uint32) bool {
+	return nd == s.head || nd == s.tail
+}
+
+// checkNotSentinel panics if nd is the node offset of a sentinel, whose key
+// would otherwise be silently read as that of the record at storage offset
+// zero.
+func (s *Skiplist) checkNotSentinel(nd uint32) {
+	if s.isSentinel(nd) {
+		panic(errors.AssertionFailedf("batchskl: reading the key of sentinel node %d", errors.Safe(nd)))
+	}
+}
+
 func (s *Skiplist) getKey(nd uint32) base.InternalKey {
+	if invariants.Enabled {
+		s.checkNotSentinel(nd)
+	}
 	n := s.node(nd)
 	kind := base.InternalKeyKind((*s.storage)[n.offset])
 	key := (*s.storage)[n.keyStart:n.keyEnd]
@@ -419,11 +2193,73 @@ func (s *Skiplist) getKey(nd uint32) base.InternalKey {
 }
 
 func (s *Skiplist) getNext(nd, h uint32) uint32 {
-	return s.node(nd).links[h].next
+	return s.loadNext(s.node(nd), h)
 }
 
 func (s *Skiplist) getPrev(nd, h uint32) uint32 {
-	return s.node(nd).links[h].prev
+	return s.loadPrev(s.node(nd), h)
+}
+
+func (s *Skiplist) setNext(nd, h, next uint32) {
+	s.storeNext(s.node(nd), h, next)
+}
+
+func (s *Skiplist) setPrev(nd, h, prev uint32) {
+	s.storePrev(s.node(nd), h, prev)
+}
+
+// loadNext and the accessors below it access the links and height atomically
+// if the skiplist is concurrent, as the writer publishes them to readers, and
+// directly otherwise. As the writer is the only goroutine that stores them, it
+// may still load them directly.
+func (s *Skiplist) loadNext(n *node, h uint32) uint32 {
+	if s.opts.concurrent {
+		return atomicUint32(&n.links[h].next).Load()
+	}
+	return n.links[h].next
+}
+
+func (s *Skiplist) loadPrev(n *node, h uint32) uint32 {
+	if s.opts.concurrent {
+		return atomicUint32(&n.links[h].prev).Load()
+	}
+	return n.links[h].prev
+}
+
+func (s *Skiplist) storeNext(n *node, h, next uint32) {
+	if s.opts.concurrent {
+		atomicUint32(&n.links[h].next).Store(next)
+	} else {
+		n.links[h].next = next
+	}
+}
+
+func (s *Skiplist) storePrev(n *node, h, prev uint32) {
+	if s.opts.concurrent {
+		atomicUint32(&n.links[h].prev).Store(prev)
+	} else {
+		n.links[h].prev = prev
+	}
+}
+
+func (s *Skiplist) loadHeight() uint32 {
+	if s.opts.concurrent {
+		return atomicUint32(&s.height).Load()
+	}
+	return s.height
+}
+
+func (s *Skiplist) storeHeight(height uint32) {
+	if s.opts.concurrent {
+		atomicUint32(&s.height).Store(height)
+	} else {
+		s.height = height
+	}
+}
+
+// atomicUint32 returns p as an atomic.Uint32, which has the same layout.
+func atomicUint32(p *uint32) *atomic.Uint32 {
+	return (*atomic.Uint32)(unsafe.Pointer(p))
 }
 
 func (s *Skiplist) debug() string {
@@ -440,3 +2276,93 @@ func (s *Skiplist) debug() string {
 
 // Silence unused warning.
 var _ = (*Skiplist).debug
+
+// maxStringNodes is the maximum number of nodes rendered by Skiplist.String.
+const maxStringNodes = 64
+
+// String returns an ASCII diagram of the structure of the skiplist: a column
+// for each node in level 0 order, labelled with a prefix of its key, and a row
+// for each level from the top down. A node is shown at every level that it is
+// linked into, and a run of dashes is shown where a link passes over a node.
+// A node whose tower height disagrees with the levels it is linked into is
+// shown as a run of '!' at the offending levels. At most maxStringNodes nodes
+// are rendered.
+func (s *Skiplist) String() string {
+	return s.format(maxStringNodes)
+}
+
+func (s *Skiplist) format(maxNodes int) string {
+	cols := []uint32{s.head}
+	var omitted int
+	for nd := s.getNext(s.head, 0); nd != s.tail; nd = s.getNext(nd, 0) {
+		if len(cols) > maxNodes {
+			omitted++
+			continue
+		}
+		cols = append(cols, nd)
+	}
+	if omitted == 0 {
+		cols = append(cols, s.tail)
+	}
+	labels := make([]string, len(cols))
+	for i, nd := range cols {
+		switch nd {
+		case s.head:
+			labels[i] = "head"
+		case s.tail:
+			labels[i] = "tail"
+		default:
+			n := s.node(nd)
+			key := (*s.storage)[n.keyStart:n.keyEnd]
+			if len(key) > 8 {
+				key = key[:8]
+			}
+			labels[i] = string(key)
+			for _, c := range key {
+				if c < ' ' || c > '~' {
+					labels[i] = fmt.Sprintf("%x", key)
+					break
+				}
+			}
+			if labels[i] == "" {
+				labels[i] = `""`
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	linked := make(map[uint32]bool)
+	for level := int(s.height) - 1; level >= 0; level-- {
+		// Follow the links at this level, bounding the walk in case the links
+		// contain a cycle.
+		clear(linked)
+		for nd, i := s.head, 0; i <= int(s.count)+1; nd, i = s.getNext(nd, uint32(level)), i+1 {
+			linked[nd] = true
+			if nd == s.tail {
+				break
+			}
+		}
+		fmt.Fprintf(&buf, "%2d |", level)
+		for i, nd := range cols {
+			fill := byte('-')
+			if participates := s.node(nd).height > uint32(level); participates == linked[nd] {
+				if participates {
+					fmt.Fprintf(&buf, " %s", labels[i])
+					continue
+				}
+			} else {
+				fill = '!'
+			}
+			buf.WriteByte(' ')
+			buf.Write(bytes.Repeat([]byte{fill}, len(labels[i])))
+		}
+		if omitted > 0 {
+			buf.WriteString(" ...")
+		}
+		buf.WriteByte('\n')
+	}
+	if omitted > 0 {
+		fmt.Fprintf(&buf, "(%d more nodes)\n", omitted)
+	}
+	return buf.String()
+}
@@ -18,13 +18,22 @@
 package batchskl
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/cockroachdb/datadriven"
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/invariants"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/exp/rand"
 )
@@ -165,6 +174,2092 @@ func TestSkiplistAdd_Overflow(t *testing.T) {
 	require.True(t, errors.Is(err, ErrTooManyRecords))
 }
 
+func TestSkiplistMerge(t *testing.T) {
+	keys := func(l *Skiplist) []string {
+		var res []string
+		it := l.NewIter(nil, nil)
+		for k := it.First(); k != nil; k = it.Next() {
+			res = append(res, string(k.UserKey))
+		}
+		return res
+	}
+
+	t.Run("disjoint", func(t *testing.T) {
+		d := &testStorage{}
+		a, b := newTestSkiplist(d), newTestSkiplist(d)
+		for i := 0; i < 50; i++ {
+			require.NoError(t, a.Add(d.add(fmt.Sprintf("%05d", i))))
+			require.NoError(t, b.Add(d.add(fmt.Sprintf("%05d", i+50))))
+		}
+		require.NoError(t, a.Merge(b))
+		var expected []string
+		for i := 0; i < 100; i++ {
+			expected = append(expected, fmt.Sprintf("%05d", i))
+		}
+		require.Equal(t, expected, keys(a))
+		require.Equal(t, 100, lengthRev(a))
+		// The merged skiplist is unaffected.
+		require.Equal(t, 50, length(b))
+	})
+
+	t.Run("overlapping", func(t *testing.T) {
+		d := &testStorage{}
+		a, b := newTestSkiplist(d), newTestSkiplist(d)
+		for i := 0; i < 100; i += 2 {
+			require.NoError(t, a.Add(d.add(fmt.Sprintf("%05d", i))))
+		}
+		for i := 25; i < 75; i++ {
+			require.NoError(t, b.Add(d.add(fmt.Sprintf("%05d", i))))
+		}
+		// Records indexed by both skiplists are only retained once.
+		for i := 0; i < 10; i++ {
+			offset := d.add(fmt.Sprintf("shared%d", i))
+			require.NoError(t, a.Add(offset))
+			require.NoError(t, b.Add(offset))
+		}
+		require.NoError(t, a.Merge(b))
+		require.Equal(t, 50+50+10, length(a))
+		require.Equal(t, 50+50+10, lengthRev(a))
+
+		// Keys are sorted, and equal user keys are ordered by descending offset.
+		it := a.NewIter(nil, nil)
+		prev := *it.First()
+		for k := it.Next(); k != nil; k = it.Next() {
+			c := base.DefaultComparer.Compare(prev.UserKey, k.UserKey)
+			require.True(t, c < 0 || (c == 0 && prev.SeqNum() > k.SeqNum()), "%s %s", prev, k)
+			prev = *k
+		}
+
+		// Merging the same records again is a no-op.
+		require.NoError(t, a.Merge(b))
+		require.Equal(t, 110, length(a))
+	})
+
+	t.Run("different storage", func(t *testing.T) {
+		a := newTestSkiplist(&testStorage{})
+		b := newTestSkiplist(&testStorage{})
+		require.Error(t, a.Merge(b))
+	})
+}
+
+// checkSpans verifies that the span counter of every link matches the number
+// of level 0 links between its endpoints.
+func checkSpans(t *testing.T, l *Skiplist) {
+	pos := make(map[uint32]uint32)
+	var i uint32
+	for nd := l.head; nd != l.tail; nd = l.getNext(nd, 0) {
+		pos[nd] = i
+		i++
+	}
+	pos[l.tail] = i
+	for level := uint32(0); level < l.height; level++ {
+		for nd := l.head; nd != l.tail; nd = l.getNext(nd, level) {
+			next := l.getNext(nd, level)
+			require.Equal(t, pos[next]-pos[nd], l.spans(nd)[level], "level %d", level)
+		}
+	}
+}
+
+func TestSkiplistRank(t *testing.T) {
+	seed := uint64(time.Now().UnixNano())
+	t.Logf("seed: %d", seed)
+	rng := rand.New(rand.NewSource(seed))
+
+	d := &testStorage{}
+	l := NewSkiplist(&d.data, base.DefaultComparer.Compare,
+		base.DefaultComparer.AbbreviatedKey, WithRank())
+	var keys []string
+	for i := 0; i < 500; i++ {
+		key := fmt.Sprintf("%04d", rng.Intn(300))
+		keys = append(keys, key)
+		require.NoError(t, l.Add(d.add(key)))
+	}
+	checkSpans(t, l)
+
+	unranked := newTestSkiplist(d)
+	require.NoError(t, unranked.Merge(l))
+
+	for i := 0; i <= 300; i++ {
+		key := fmt.Sprintf("%04d", i)
+		var expected int
+		for _, k := range keys {
+			if k < key {
+				expected++
+			}
+		}
+		require.Equal(t, expected, l.Rank(makeKey(key)), key)
+		require.Equal(t, expected, unranked.Rank(makeKey(key)), key)
+	}
+	require.Equal(t, 0, l.Rank(nil))
+
+	// Span counters are maintained when merging into a skiplist.
+	merged := NewSkiplist(&d.data, base.DefaultComparer.Compare,
+		base.DefaultComparer.AbbreviatedKey, WithRank())
+	for i := 0; i < 100; i++ {
+		require.NoError(t, merged.Add(d.add(fmt.Sprintf("%04d", rng.Intn(300)))))
+	}
+	require.NoError(t, merged.Merge(l))
+	checkSpans(t, merged)
+	require.Equal(t, 600, merged.Rank(makeKey("9999")))
+}
+
+// TestSkiplistZeroOffset verifies that a record at storage offset zero is not
+// confused with the head and tail sentinels, which also store a zero offset.
+func TestSkiplistZeroOffset(t *testing.T) {
+	d := &testStorage{}
+	l := newTestSkiplist(d)
+	// An empty key at offset zero has a zero abbreviated key, making its node
+	// fields indistinguishable from those of the sentinels.
+	zero := d.add("")
+	require.EqualValues(t, 0, zero)
+	require.NoError(t, l.Add(zero))
+	require.NoError(t, l.Add(d.add("a")))
+	require.NoError(t, l.Add(d.add("b")))
+
+	it := l.NewIter(nil, nil)
+	assertKey(t, "", it.First())
+	offset, _, _ := it.KeyInfo()
+	require.EqualValues(t, 0, offset)
+	require.Nil(t, it.Prev())
+	assertKey(t, "", it.SeekGE(nil, base.SeekGEFlagsNone))
+	assertKey(t, "", it.SeekLT(makeKey("a")))
+	require.Nil(t, it.SeekLT(nil))
+	assertKey(t, "", it.SeekLT(makeKey("a")))
+	assertKey(t, "a", it.Next())
+	assertKey(t, "b", it.Last())
+	assertKey(t, "a", it.Prev())
+	assertKey(t, "", it.Prev())
+	require.Nil(t, it.Prev())
+	require.Equal(t, 3, length(l))
+	require.Equal(t, 3, lengthRev(l))
+	require.Equal(t, 0, l.Rank(nil))
+	require.Equal(t, 1, l.Rank(makeKey("a")))
+
+	// Merging the record at offset zero again does not duplicate it.
+	other := newTestSkiplist(d)
+	require.NoError(t, other.Add(zero))
+	require.NoError(t, l.Merge(other))
+	require.Equal(t, 3, length(l))
+}
+
+func TestSkiplistCountRange(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithRank()}} {
+		d := &testStorage{}
+		l := NewSkiplist(&d.data, base.DefaultComparer.Compare,
+			base.DefaultComparer.AbbreviatedKey, opts...)
+		require.Equal(t, 0, l.CountRange(nil, makeKey("z")))
+
+		// 00000, 00010, 00020, ..., 00990.
+		for i := 0; i < 100; i++ {
+			require.NoError(t, l.Add(d.add(fmt.Sprintf("%05d", i*10))))
+		}
+		// A duplicate user key is counted separately.
+		require.NoError(t, l.Add(d.add("00500")))
+
+		testCases := []struct {
+			start, end string
+			expected   int
+		}{
+			// Full range.
+			{"", "99999", 101},
+			{"00000", "00991", 101},
+			// Start is inclusive and end is exclusive.
+			{"00010", "00050", 4},
+			{"00011", "00051", 4},
+			{"00500", "00510", 2},
+			// Empty intersection.
+			{"00011", "00019", 0},
+			{"01000", "99999", 0},
+			// Start is not before end.
+			{"00500", "00500", 0},
+			{"00600", "00500", 0},
+		}
+		for _, tc := range testCases {
+			require.Equal(t, tc.expected, l.CountRange(makeKey(tc.start), makeKey(tc.end)),
+				"[%s, %s)", tc.start, tc.end)
+		}
+	}
+}
+
+func TestSkiplistAdd_Corrupted(t *testing.T) {
+	d := &testStorage{}
+	l := newTestSkiplist(d)
+	require.NoError(t, l.Add(d.add("a")))
+
+	// Offsets outside of the storage.
+	for _, offset := range []uint32{uint32(len(d.data)), uint32(len(d.data)) + 1, math.MaxUint32} {
+		require.Error(t, l.Add(offset))
+	}
+	// A truncated key length.
+	offset := uint32(len(d.data))
+	d.data = append(d.data, uint8(base.InternalKeyKindSet), 0x80)
+	require.Error(t, l.Add(offset))
+	// A key length that extends beyond the storage.
+	offset = uint32(len(d.data))
+	d.data = append(d.data, uint8(base.InternalKeyKindSet), 10, 'b')
+	require.Error(t, l.Add(offset))
+
+	// None of the failed additions modified the skiplist.
+	require.Equal(t, 1, length(l))
+	require.NoError(t, l.Add(d.add("b")))
+	require.Equal(t, 2, length(l))
+}
+
+func TestSkiplistNewNode_InvalidHeight(t *testing.T) {
+	l := newTestSkiplist(&testStorage{})
+	size := len(l.nodes)
+	for _, height := range []uint32{0, maxHeight + 1} {
+		_, err := l.newNode(height, 0, 0, 0, 0)
+		require.Error(t, err)
+		require.Equal(t, size, len(l.nodes))
+	}
+}
+
+func TestSkiplistPrefixScan(t *testing.T) {
+	d := &testStorage{}
+	l := newTestSkiplist(d)
+	keys := []string{
+		"a", "ab", "abc", "abd", "b",
+		// Long keys which share their abbreviated key.
+		"commonprefix1", "commonprefix2", "commonprefiy",
+		"\xff\xff", "\xff\xff\x01",
+	}
+	for _, k := range keys {
+		require.NoError(t, l.Add(d.add(k)))
+	}
+	scan := func(prefix string, limit int) []string {
+		var res []string
+		l.PrefixScan(makeKey(prefix), func(offset uint32) bool {
+			it := l.NewIter(nil, nil)
+			for k := it.First(); k != nil; k = it.Next() {
+				if o, _, _ := it.KeyInfo(); o == offset {
+					res = append(res, string(k.UserKey))
+				}
+			}
+			return len(res) != limit
+		})
+		return res
+	}
+
+	// An empty prefix scans everything.
+	require.Equal(t, keys, scan("", 0))
+	require.Equal(t, []string{"a", "ab", "abc", "abd"}, scan("a", 0))
+	require.Equal(t, []string{"ab", "abc", "abd"}, scan("ab", 0))
+	require.Equal(t, []string{"abc"}, scan("abc", 0))
+	require.Equal(t, []string{"commonprefix1", "commonprefix2"}, scan("commonprefix", 0))
+	require.Equal(t, []string{"commonprefix1", "commonprefix2", "commonprefiy"}, scan("commonpref", 0))
+	require.Equal(t, []string{"\xff\xff", "\xff\xff\x01"}, scan("\xff", 0))
+
+	// Prefixes without any matching keys never invoke the callback.
+	require.Nil(t, scan("aa", 0))
+	require.Nil(t, scan("abcd", 0))
+	require.Nil(t, scan("d", 0))
+	require.Nil(t, scan("\xff\xff\xff", 0))
+
+	// Returning false stops the scan.
+	require.Equal(t, []string{"a", "ab"}, scan("a", 2))
+	require.Equal(t, []string{"a"}, scan("", 1))
+}
+
+func TestSkiplistCollectPrefix(t *testing.T) {
+	d := &testStorage{}
+	l := newTestSkiplist(d)
+	offsets := make(map[string]uint32)
+	for _, k := range []string{"a", "ab", "abc", "abd", "b", "ba"} {
+		offsets[k] = d.add(k)
+		require.NoError(t, l.Add(offsets[k]))
+	}
+	collect := func(keys ...string) []uint32 {
+		var res []uint32
+		for _, k := range keys {
+			res = append(res, offsets[k])
+		}
+		return res
+	}
+
+	// A non-positive max collects every match.
+	require.Equal(t, collect("a", "ab", "abc", "abd"), l.CollectPrefix(makeKey("a"), 0))
+	require.Equal(t, collect("a", "ab", "abc", "abd"), l.CollectPrefix(makeKey("a"), -1))
+	require.Equal(t, collect("a", "ab", "abc", "abd", "b", "ba"), l.CollectPrefix(nil, 0))
+	// At most max matches are collected.
+	require.Equal(t, collect("a", "ab"), l.CollectPrefix(makeKey("a"), 2))
+	require.Equal(t, collect("ab"), l.CollectPrefix(makeKey("ab"), 1))
+	// Fewer than max matches are all collected.
+	require.Equal(t, collect("b", "ba"), l.CollectPrefix(makeKey("b"), 10))
+	// A prefix without matches collects nothing.
+	require.Nil(t, l.CollectPrefix(makeKey("c"), 0))
+	require.Nil(t, l.CollectPrefix(makeKey("aa"), 10))
+}
+
+func TestSkiplistHeightOf(t *testing.T) {
+	// seedForHeight returns a seed for which the first node added to a skiplist
+	// has the given height.
+	seedForHeight := func(height uint32) uint64 {
+		for seed := uint64(0); ; seed++ {
+			l := Skiplist{probabilities: &probabilities, heightLimit: maxHeight}
+			l.rand.Seed(seed)
+			if l.randomHeight() == height {
+				return seed
+			}
+		}
+	}
+
+	d := &testStorage{}
+	l := newTestSkiplist(d)
+	_, ok := l.HeightOf(makeKey("a"))
+	require.False(t, ok)
+
+	l.rand.Seed(seedForHeight(1))
+	require.NoError(t, l.Add(d.add("a")))
+	l.rand.Seed(seedForHeight(4))
+	require.NoError(t, l.Add(d.add("b")))
+
+	h, ok := l.HeightOf(makeKey("a"))
+	require.True(t, ok)
+	require.Equal(t, 1, h)
+	h, ok = l.HeightOf(makeKey("b"))
+	require.True(t, ok)
+	require.Equal(t, 4, h)
+	_, ok = l.HeightOf(makeKey("aa"))
+	require.False(t, ok)
+	_, ok = l.HeightOf(makeKey("c"))
+	require.False(t, ok)
+}
+
+func TestSkiplistCompact(t *testing.T) {
+	keys := func(l *Skiplist) []string {
+		var res []string
+		it := l.NewIter(nil, nil)
+		for k := it.First(); k != nil; k = it.Next() {
+			res = append(res, k.String())
+		}
+		for k := it.Last(); k != nil; k = it.Prev() {
+			res = append(res, k.String())
+		}
+		return res
+	}
+
+	for _, opts := range [][]Option{nil, {WithRank()}} {
+		d := &testStorage{}
+		l := NewSkiplist(&d.data, base.DefaultComparer.Compare,
+			base.DefaultComparer.AbbreviatedKey, opts...)
+		for i := 0; i < 100; i++ {
+			require.NoError(t, l.Add(d.add(fmt.Sprintf("%05d", (i*37)%100))))
+			// Allocate a node which is never linked into the skiplist.
+			_, err := l.newNode(maxHeight, 0, 0, 0, 0)
+			require.NoError(t, err)
+		}
+		require.NoError(t, l.Add(d.add("00050")))
+		expected := keys(l)
+		size := len(l.nodes)
+
+		c := l.Compact()
+		require.Equal(t, expected, keys(c))
+		require.Less(t, len(c.nodes), size)
+		// The nodes slice was allocated once, leaving only the slack required by
+		// alloc.
+		slack := maxNodeSize
+		if c.opts.rank {
+			slack += spansSize
+			checkSpans(t, c)
+		}
+		require.Equal(t, cap(c.nodes), len(c.nodes)+int(slack))
+
+		// The original skiplist is untouched and the two are independent.
+		require.Equal(t, size, len(l.nodes))
+		require.Equal(t, expected, keys(l))
+		require.NoError(t, c.Add(d.add("00200")))
+		require.Equal(t, 101, length(l))
+		require.Equal(t, 102, length(c))
+	}
+}
+
+func TestSkiplistMultiGet(t *testing.T) {
+	d := &testStorage{}
+	l := newTestSkiplist(d)
+	require.Equal(t, []int{-1}, l.MultiGet([][]byte{makeKey("a")}))
+
+	offsets := make(map[string]int)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("%05d", (i*37)%100*2)
+		offset := d.add(key)
+		// Lookups return the most recently added record for a user key.
+		offsets[key] = int(offset)
+		require.NoError(t, l.Add(offset))
+	}
+	offset := d.add("00010")
+	offsets["00010"] = int(offset)
+	require.NoError(t, l.Add(offset))
+
+	expected := func(keys [][]byte) []int {
+		var res []int
+		for _, k := range keys {
+			if offset, ok := offsets[string(k)]; ok {
+				res = append(res, offset)
+			} else {
+				res = append(res, -1)
+			}
+		}
+		return res
+	}
+
+	var keys [][]byte
+	for i := -1; i <= 200; i++ {
+		keys = append(keys, makeKey(fmt.Sprintf("%05d", i)))
+	}
+	require.Equal(t, expected(keys), l.MultiGet(keys))
+
+	// Repeated and unsorted keys are still looked up correctly.
+	keys = [][]byte{
+		makeKey("00010"), makeKey("00010"), makeKey("00150"), makeKey("00003"),
+		makeKey("00004"), makeKey(""), makeKey("99999"), makeKey("00000"),
+	}
+	require.Equal(t, expected(keys), l.MultiGet(keys))
+	require.Empty(t, l.MultiGet(nil))
+}
+
+func TestSkiplistDeleteByOffset(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithRank()}, {WithSequenceTags(), WithRank()}} {
+		seed := uint64(time.Now().UnixNano())
+		t.Logf("seed: %d", seed)
+		rng := rand.New(rand.NewSource(seed))
+
+		d := &testStorage{}
+		l := NewSkiplist(&d.data, base.DefaultComparer.Compare,
+			base.DefaultComparer.AbbreviatedKey, opts...)
+		require.False(t, l.DeleteByOffset(0))
+
+		var offsets []uint32
+		for i := 0; i < 200; i++ {
+			// Use few distinct keys so that many records share a user key.
+			offset := d.add(fmt.Sprintf("%03d", rng.Intn(50)))
+			offsets = append(offsets, offset)
+			require.NoError(t, l.Add(offset))
+		}
+		require.Equal(t, 200, l.Len())
+		// A record which was never added.
+		require.False(t, l.DeleteByOffset(d.add("000")))
+		// An offset outside of the storage.
+		require.False(t, l.DeleteByOffset(uint32(len(d.data))))
+		require.Equal(t, 200, l.Len())
+
+		rng.Shuffle(len(offsets), func(i, j int) {
+			offsets[i], offsets[j] = offsets[j], offsets[i]
+		})
+		for i, offset := range offsets {
+			require.True(t, l.DeleteByOffset(offset))
+			// Deleting the same record again fails.
+			require.False(t, l.DeleteByOffset(offset))
+			require.Equal(t, len(offsets)-i-1, l.Len())
+			if i%20 == 0 {
+				require.Equal(t, l.Len(), length(l))
+				require.Equal(t, l.Len(), lengthRev(l))
+				it := l.NewIter(nil, nil)
+				for k := it.First(); k != nil; k = it.Next() {
+					o, _, _ := it.KeyInfo()
+					require.NotEqual(t, offset, o)
+				}
+				if l.opts.rank {
+					checkSpans(t, l)
+				}
+			}
+		}
+		require.Equal(t, 0, length(l))
+
+		// The skiplist remains usable.
+		require.NoError(t, l.Add(d.add("foo")))
+		require.Equal(t, 1, l.Len())
+		require.Equal(t, 1, length(l))
+	}
+}
+
+func TestSkiplistPValue(t *testing.T) {
+	averageHeight := func(opts ...Option) float64 {
+		d := &testStorage{}
+		l := NewSkiplist(&d.data, base.DefaultComparer.Compare,
+			base.DefaultComparer.AbbreviatedKey, opts...)
+		l.rand.Seed(1)
+		const n = 10000
+		var sum int
+		for i := 0; i < n; i++ {
+			key := fmt.Sprintf("%05d", i)
+			require.NoError(t, l.Add(d.add(key)))
+			h, ok := l.HeightOf(makeKey(key))
+			require.True(t, ok)
+			sum += h
+		}
+		require.Equal(t, n, length(l))
+		return float64(sum) / n
+	}
+
+	// The expected height is 1/(1-p).
+	defaultHeight := averageHeight()
+	require.InDelta(t, 1/(1-defaultPValue), defaultHeight, 0.05)
+	require.Equal(t, defaultHeight, averageHeight(WithPValue(defaultPValue)))
+	lowHeight := averageHeight(WithPValue(0.25))
+	require.InDelta(t, 1/(1-0.25), lowHeight, 0.05)
+	highHeight := averageHeight(WithPValue(0.5))
+	require.InDelta(t, 1/(1-0.5), highHeight, 0.05)
+	require.Less(t, lowHeight, defaultHeight)
+	require.Less(t, defaultHeight, highHeight)
+
+	for _, p := range []float64{0, 1, -0.5, 1.5, math.NaN()} {
+		require.Panics(t, func() { WithPValue(p) })
+	}
+}
+
+func TestSkiplistGrow(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithRank()}, {WithPValue(0.25)}, {WithPValue(0.75)}} {
+		d := &testStorage{}
+		l := NewSkiplist(&d.data, base.DefaultComparer.Compare,
+			base.DefaultComparer.AbbreviatedKey, opts...)
+		l.rand.Seed(1)
+
+		// Grow before any records have been added.
+		l.Grow(10000)
+		size := cap(l.nodes)
+		// Adding somewhat fewer records than requested does not reallocate.
+		for i := 0; i < 9000; i++ {
+			require.NoError(t, l.Add(d.add(fmt.Sprintf("%05d", i))))
+		}
+		require.Equal(t, size, cap(l.nodes))
+
+		// Grow never shrinks the nodes slice.
+		l.Grow(0)
+		l.Grow(-1)
+		l.Grow(1)
+		require.Equal(t, size, cap(l.nodes))
+
+		// Grow after records have been added retains them.
+		l.Grow(100000)
+		require.Less(t, size, cap(l.nodes))
+		size = cap(l.nodes)
+		for i := 9000; i < 90000; i++ {
+			require.NoError(t, l.Add(d.add(fmt.Sprintf("%05d", i))))
+		}
+		require.Equal(t, size, cap(l.nodes))
+		require.Equal(t, 90000, length(l))
+		require.Equal(t, 90000, lengthRev(l))
+	}
+}
+
+func TestSkiplistEqual(t *testing.T) {
+	build := func(keys []string) *Skiplist {
+		d := &testStorage{}
+		l := newTestSkiplist(d)
+		for _, k := range keys {
+			require.NoError(t, l.Add(d.add(k)))
+		}
+		return l
+	}
+
+	var keys []string
+	for i := 0; i < 100; i++ {
+		keys = append(keys, fmt.Sprintf("%05d", i%80))
+	}
+	a := build(keys)
+	rng := rand.New(rand.NewSource(uint64(time.Now().UnixNano())))
+	rng.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+	// Skiplists built from the same keys in a different order are equal.
+	b := build(keys)
+	require.True(t, a.Equal(b))
+	require.True(t, b.Equal(a))
+	require.True(t, a.Equal(a))
+	require.True(t, build(nil).Equal(build(nil)))
+
+	// Differing key sets are unequal.
+	require.False(t, a.Equal(build(keys[1:])))
+	require.False(t, a.Equal(build(append(keys[1:], "00100"))))
+	require.False(t, a.Equal(build(append(keys, "00000"))))
+	require.False(t, a.Equal(build(nil)))
+	require.False(t, build(nil).Equal(a))
+}
+
+func TestSkiplistTruncate(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithRank()}, {WithSequenceTags(), WithRank()}} {
+		seed := uint64(time.Now().UnixNano())
+		t.Logf("seed: %d", seed)
+		rng := rand.New(rand.NewSource(seed))
+
+		d := &testStorage{}
+		l := NewSkiplist(&d.data, base.DefaultComparer.Compare,
+			base.DefaultComparer.AbbreviatedKey, opts...)
+		keys := func() []string {
+			var res []string
+			it := l.NewIter(nil, nil)
+			for k := it.First(); k != nil; k = it.Next() {
+				res = append(res, k.String())
+			}
+			var rev []string
+			for k := it.Last(); k != nil; k = it.Prev() {
+				rev = append([]string{k.String()}, rev...)
+			}
+			require.Equal(t, res, rev)
+			return res
+		}
+		add := func(n int) {
+			for i := 0; i < n; i++ {
+				require.NoError(t, l.Add(d.add(fmt.Sprintf("%03d", rng.Intn(100)))))
+			}
+		}
+
+		// Truncating to a checkpoint of the empty skiplist removes everything.
+		empty := l.Checkpoint()
+		add(50)
+
+		type state struct {
+			c    Checkpoint
+			keys []string
+			len  int
+		}
+		var states []state
+		for i := 0; i < 5; i++ {
+			states = append(states, state{c: l.Checkpoint(), keys: keys(), len: l.Len()})
+			add(1 + rng.Intn(50))
+		}
+		// Truncate to each checkpoint, newest first, adding records in between.
+		for i := len(states) - 1; i >= 0; i-- {
+			require.NoError(t, l.Truncate(states[i].c))
+			require.Equal(t, states[i].keys, keys())
+			require.Equal(t, states[i].len, l.Len())
+			if l.opts.rank {
+				checkSpans(t, l)
+			}
+			add(rng.Intn(50))
+		}
+		// A checkpoint beyond the current state is invalid.
+		require.NoError(t, l.Truncate(states[0].c))
+		require.Error(t, l.Truncate(states[4].c))
+
+		require.NoError(t, l.Truncate(empty))
+		require.Equal(t, 0, l.Len())
+		require.Empty(t, keys())
+		add(10)
+		require.Equal(t, 10, length(l))
+
+		// A checkpoint taken before the skiplist was reinitialized is
+		// rejected, even though it lies within the new nodes.
+		stale := l.Checkpoint()
+		l.Init(&d.data, base.DefaultComparer.Compare, base.DefaultComparer.AbbreviatedKey, opts...)
+		add(20)
+		require.ErrorContains(t, l.Truncate(stale), "checkpoint taken before the skiplist was reset")
+		require.Equal(t, 20, length(l))
+	}
+}
+
+func TestSkiplistSequenceTags(t *testing.T) {
+	for _, opts := range [][]Option{{WithSequenceTags()}, {WithSequenceTags(), WithRank()}} {
+		seed := uint64(time.Now().UnixNano())
+		t.Logf("seed: %d", seed)
+		rng := rand.New(rand.NewSource(seed))
+
+		d := &testStorage{}
+		l := NewSkiplist(&d.data, base.DefaultComparer.Compare,
+			base.DefaultComparer.AbbreviatedKey, opts...)
+		// versions holds the offsets of the records for each user key, in
+		// insertion order.
+		versions := make(map[string][]uint32)
+		add := func(l *Skiplist, key string) uint32 {
+			offset := d.add(key)
+			require.NoError(t, l.Add(offset))
+			return offset
+		}
+		check := func() {
+			var userKeys []string
+			for k := range versions {
+				userKeys = append(userKeys, k)
+			}
+			sort.Strings(userKeys)
+			var expected []uint32
+			for _, k := range userKeys {
+				expected = append(expected, versions[k]...)
+
+				// Get returns the oldest or the newest version.
+				offset, ok := l.Get([]byte(k), false)
+				require.True(t, ok)
+				require.Equal(t, versions[k][0], offset)
+				offset, ok = l.Get([]byte(k), true)
+				require.True(t, ok)
+				require.Equal(t, versions[k][len(versions[k])-1], offset)
+			}
+			// Equal user keys are iterated in insertion order, newest last.
+			var actual []uint32
+			it := l.NewIter(nil, nil)
+			for k := it.First(); k != nil; k = it.Next() {
+				offset, _, _ := it.KeyInfo()
+				actual = append(actual, offset)
+			}
+			require.Equal(t, expected, actual)
+			require.Equal(t, len(expected), lengthRev(l))
+			if l.opts.rank {
+				checkSpans(t, l)
+			}
+		}
+
+		// Insert records in ascending key order, exercising the fast path, and
+		// then in random order.
+		for i := 0; i < 20; i++ {
+			k := fmt.Sprintf("%03d", i/2)
+			versions[k] = append(versions[k], add(l, k))
+		}
+		for i := 0; i < 200; i++ {
+			k := fmt.Sprintf("%03d", rng.Intn(30))
+			versions[k] = append(versions[k], add(l, k))
+		}
+		check()
+
+		// Records merged from another skiplist are tagged as they are added,
+		// ordering them after the existing versions. Records indexed by both
+		// skiplists are only retained once.
+		other := NewSkiplist(&d.data, base.DefaultComparer.Compare,
+			base.DefaultComparer.AbbreviatedKey)
+		for i := 0; i < 50; i++ {
+			require.NoError(t, other.Add(d.add(fmt.Sprintf("%03d", rng.Intn(40)))))
+		}
+		indexed := make(map[uint32]bool)
+		for _, offsets := range versions {
+			require.NoError(t, other.Add(offsets[0]))
+			for _, offset := range offsets {
+				indexed[offset] = true
+			}
+		}
+		it := other.NewIter(nil, nil)
+		for k := it.First(); k != nil; k = it.Next() {
+			if offset, _, _ := it.KeyInfo(); !indexed[offset] {
+				versions[string(k.UserKey)] = append(versions[string(k.UserKey)], offset)
+			}
+		}
+		require.NoError(t, l.Merge(other))
+		check()
+	}
+
+	// Without sequence tags, Get returns the version with the highest offset
+	// first.
+	d := &testStorage{}
+	l := newTestSkiplist(d)
+	a, b := d.add("a"), d.add("a")
+	require.NoError(t, l.Add(a))
+	require.NoError(t, l.Add(b))
+	offset, ok := l.Get([]byte("a"), false)
+	require.True(t, ok)
+	require.Equal(t, b, offset)
+	offset, ok = l.Get([]byte("a"), true)
+	require.True(t, ok)
+	require.Equal(t, a, offset)
+	_, ok = l.Get([]byte("b"), false)
+	require.False(t, ok)
+	_, ok = l.Get([]byte(""), true)
+	require.False(t, ok)
+}
+
+func TestSkiplistBounds(t *testing.T) {
+	keyAt := func(d *testStorage, offset uint32) string {
+		l := newTestSkiplist(d)
+		keyStart, keyEnd, err := l.decodeKey(offset)
+		require.NoError(t, err)
+		return string(d.data[keyStart:keyEnd])
+	}
+
+	d := &testStorage{}
+	l := newTestSkiplist(d)
+	_, _, ok := l.Bounds()
+	require.False(t, ok)
+
+	require.NoError(t, l.Add(d.add("m")))
+	min, max, ok := l.Bounds()
+	require.True(t, ok)
+	require.Equal(t, min, max)
+	require.Equal(t, "m", keyAt(d, min))
+
+	for _, k := range []string{"q", "c", "z", "a", "n"} {
+		require.NoError(t, l.Add(d.add(k)))
+	}
+	min, max, ok = l.Bounds()
+	require.True(t, ok)
+	require.Equal(t, "a", keyAt(d, min))
+	require.Equal(t, "z", keyAt(d, max))
+
+	// With multiple records for the first or last user key, the bounds follow
+	// the skiplist's ordering: the record with the highest offset comes first.
+	newestA, oldestZ := d.add("a"), d.add("z")
+	require.NoError(t, l.Add(newestA))
+	require.NoError(t, l.Add(oldestZ))
+	min, max, ok = l.Bounds()
+	require.True(t, ok)
+	require.Equal(t, newestA, min)
+	require.NotEqual(t, oldestZ, max)
+	require.Equal(t, "z", keyAt(d, max))
+}
+
+func TestSkiplistAddWithSplice(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithRank()}, {WithSequenceTags()}} {
+		seed := uint64(time.Now().UnixNano())
+		t.Logf("seed: %d", seed)
+		rng := rand.New(rand.NewSource(seed))
+
+		d := &testStorage{}
+		l := NewSkiplist(&d.data, base.DefaultComparer.Compare,
+			base.DefaultComparer.AbbreviatedKey, opts...)
+		// The reference skiplist indexes the same records using Add.
+		ref := NewSkiplist(&d.data, base.DefaultComparer.Compare,
+			base.DefaultComparer.AbbreviatedKey, opts...)
+		check := func() {
+			var expected, actual []uint32
+			refIt, it := ref.NewIter(nil, nil), l.NewIter(nil, nil)
+			for k := refIt.First(); k != nil; k = refIt.Next() {
+				offset, _, _ := refIt.KeyInfo()
+				expected = append(expected, offset)
+			}
+			for k := it.First(); k != nil; k = it.Next() {
+				offset, _, _ := it.KeyInfo()
+				actual = append(actual, offset)
+			}
+			require.Equal(t, expected, actual)
+			require.Equal(t, len(expected), lengthRev(l))
+			if l.opts.rank {
+				checkSpans(t, l)
+			}
+		}
+
+		var sp Splice
+		var offsets []uint32
+		add := func(key string) {
+			offset := d.add(key)
+			offsets = append(offsets, offset)
+			require.NoError(t, l.AddWithSplice(offset, &sp))
+			require.NoError(t, ref.Add(offset))
+		}
+		// Ascending keys, clustered keys and random keys.
+		for i := 0; i < 100; i++ {
+			add(fmt.Sprintf("%05d", i*10))
+		}
+		for i := 0; i < 100; i++ {
+			add(fmt.Sprintf("%05d", 500+rng.Intn(20)))
+		}
+		for i := 0; i < 100; i++ {
+			add(fmt.Sprintf("%05d", rng.Intn(1000)))
+		}
+		check()
+
+		// Records added without the splice leave the cache stale.
+		for i := 0; i < 200; i++ {
+			offset := d.add(fmt.Sprintf("%05d", 500+rng.Intn(20)))
+			offsets = append(offsets, offset)
+			require.NoError(t, l.Add(offset))
+			require.NoError(t, ref.Add(offset))
+			if i%2 == 0 {
+				add(fmt.Sprintf("%05d", 500+rng.Intn(20)))
+			}
+		}
+		check()
+
+		// Removing records invalidates the cache.
+		for i := 0; i < 50; i++ {
+			offset := offsets[rng.Intn(len(offsets))]
+			require.Equal(t, ref.DeleteByOffset(offset), l.DeleteByOffset(offset))
+			add(fmt.Sprintf("%05d", 500+rng.Intn(20)))
+		}
+		check()
+
+		c, refC := l.Checkpoint(), ref.Checkpoint()
+		for i := 0; i < 50; i++ {
+			add(fmt.Sprintf("%05d", 500+rng.Intn(20)))
+		}
+		require.NoError(t, l.Truncate(c))
+		require.NoError(t, ref.Truncate(refC))
+		for i := 0; i < 50; i++ {
+			add(fmt.Sprintf("%05d", 500+rng.Intn(20)))
+		}
+		check()
+
+		// A splice filled by another skiplist is ignored.
+		other := NewSkiplist(&d.data, base.DefaultComparer.Compare,
+			base.DefaultComparer.AbbreviatedKey, opts...)
+		require.NoError(t, other.AddWithSplice(d.add("00000"), &sp))
+		add("00999")
+		check()
+
+		// As is a splice filled before the skiplist was reset.
+		l.Reset()
+		l.Init(&d.data, base.DefaultComparer.Compare, base.DefaultComparer.AbbreviatedKey, opts...)
+		ref.Reset()
+		ref.Init(&d.data, base.DefaultComparer.Compare, base.DefaultComparer.AbbreviatedKey, opts...)
+		add("00500")
+		check()
+	}
+}
+
+func TestSkiplistString(t *testing.T) {
+	var d *testStorage
+	var l *Skiplist
+	datadriven.RunTest(t, "testdata/string", func(t *testing.T, td *datadriven.TestData) string {
+		switch td.Cmd {
+		case "new":
+			var seed uint64
+			td.ScanArgs(t, "seed", &seed)
+			d = &testStorage{}
+			l = newTestSkiplist(d)
+			l.rand.Seed(seed)
+			return ""
+
+		case "add":
+			for _, key := range strings.Fields(td.Input) {
+				require.NoError(t, l.Add(d.add(key)))
+			}
+			return ""
+
+		case "unlink-level":
+			// Unlink the node with the given key from a single level, leaving its
+			// tower inconsistent with its links.
+			var key string
+			var level uint32
+			td.ScanArgs(t, "key", &key)
+			td.ScanArgs(t, "level", &level)
+			it := l.NewIter(nil, nil)
+			require.NotNil(t, it.SeekGE([]byte(key), base.SeekGEFlagsNone))
+			n := l.node(it.nd)
+			l.node(n.links[level].prev).links[level].next = n.links[level].next
+			l.node(n.links[level].next).links[level].prev = n.links[level].prev
+			return ""
+
+		case "string":
+			maxNodes := maxStringNodes
+			td.MaybeScanArgs(t, "max-nodes", &maxNodes)
+			return l.format(maxNodes)
+
+		default:
+			return fmt.Sprintf("unknown command: %s", td.Cmd)
+		}
+	})
+}
+
+func TestSkiplistCompareKeys(t *testing.T) {
+	seed := uint64(time.Now().UnixNano())
+	t.Logf("seed: %d", seed)
+	rng := rand.New(rand.NewSource(seed))
+
+	// Generate keys that frequently share their first 8 bytes, so that their
+	// abbreviated keys tie.
+	prefixes := []string{"", "abcdefgh", "abcdefgi", "zzzzzzzz"}
+	randKey := func() []byte {
+		key := []byte(prefixes[rng.Intn(len(prefixes))])
+		for n := rng.Intn(4); n > 0; n-- {
+			key = append(key, byte('a'+rng.Intn(3)))
+		}
+		return key
+	}
+
+	d := &testStorage{}
+	l := newTestSkiplist(d)
+	for i := 0; i < 200; i++ {
+		require.NoError(t, l.Add(d.addBytes(randKey())))
+	}
+	var keys [][]byte
+	it := l.NewIter(nil, nil)
+	for k := it.First(); k != nil; k = it.Next() {
+		keys = append(keys, k.UserKey)
+	}
+	// CompareKeys agrees with the order in which the records are indexed.
+	for i := 1; i < len(keys); i++ {
+		require.LessOrEqual(t, l.CompareKeys(keys[i-1], keys[i]), 0, "%q %q", keys[i-1], keys[i])
+		require.GreaterOrEqual(t, l.CompareKeys(keys[i], keys[i-1]), 0, "%q %q", keys[i], keys[i-1])
+	}
+	for i := 0; i < 1000; i++ {
+		a, b := keys[rng.Intn(len(keys))], keys[rng.Intn(len(keys))]
+		expected := base.DefaultComparer.Compare(a, b)
+		require.Equal(t, expected, l.CompareKeys(a, b), "%q %q", a, b)
+		// An unindexed key is positioned by SeekGE consistently with CompareKeys.
+		key := randKey()
+		if k := it.SeekGE(key, base.SeekGEFlagsNone); k != nil {
+			require.GreaterOrEqual(t, l.CompareKeys(k.UserKey, key), 0)
+		}
+		if k := it.SeekLT(key); k != nil {
+			require.Less(t, l.CompareKeys(k.UserKey, key), 0)
+		}
+	}
+}
+
+func TestSkiplistKeys(t *testing.T) {
+	d := &testStorage{}
+	l := newTestSkiplist(d)
+	next := l.Keys()
+	_, ok := next()
+	require.False(t, ok)
+
+	var expected []uint32
+	for i := 0; i < 100; i++ {
+		require.NoError(t, l.Add(d.add(fmt.Sprintf("%05d", (i*37)%100))))
+	}
+	it := l.NewIter(nil, nil)
+	for k := it.First(); k != nil; k = it.Next() {
+		offset, _, _ := it.KeyInfo()
+		expected = append(expected, offset)
+	}
+
+	// Iterate fully.
+	var actual []uint32
+	next = l.Keys()
+	for offset, ok := next(); ok; offset, ok = next() {
+		actual = append(actual, offset)
+	}
+	require.Equal(t, expected, actual)
+	// The exhausted iterator stays exhausted.
+	_, ok = next()
+	require.False(t, ok)
+
+	// Stop early; a new iterator starts from the beginning.
+	next = l.Keys()
+	for i := 0; i < 10; i++ {
+		offset, ok := next()
+		require.True(t, ok)
+		require.Equal(t, expected[i], offset)
+	}
+	offset, ok := l.Keys()()
+	require.True(t, ok)
+	require.Equal(t, expected[0], offset)
+
+	// Calls do not allocate.
+	next = l.Keys()
+	require.Equal(t, float64(0), testing.AllocsPerRun(50, func() {
+		_, _ = next()
+	}))
+}
+
+func TestSkiplistSortedOffsets(t *testing.T) {
+	d := &testStorage{}
+	l := newTestSkiplist(d)
+	require.Empty(t, l.SortedOffsets())
+
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, l.Add(d.add(fmt.Sprintf("%05d", (i*7919)%1000))))
+	}
+	// Removed records are excluded.
+	require.True(t, l.DeleteByOffset(0))
+	offsets := l.SortedOffsets()
+	require.Len(t, offsets, 999)
+	require.Equal(t, 999, cap(offsets))
+	for i := 1; i < len(offsets); i++ {
+		prev, cur := offsets[i-1], offsets[i]
+		require.Less(t, string(d.data[prev+2:prev+7]), string(d.data[cur+2:cur+7]))
+	}
+	// The slice is owned by the caller.
+	offsets[0] = 0
+	require.NotEqual(t, uint32(0), l.SortedOffsets()[0])
+}
+
+func TestSkiplistAddNode(t *testing.T) {
+	d := &testStorage{}
+	l := newTestSkiplist(d)
+	keyOffset := d.add("00050")
+	nd, err := l.AddNode(keyOffset)
+	require.NoError(t, err)
+
+	// Add enough records to reallocate the nodes slice several times. The
+	// handle continues to resolve to the same record.
+	initialCap := cap(l.nodes)
+	var otherNodes []uint32
+	for i := 0; i < 1000; i++ {
+		other, err := l.AddNode(d.add(fmt.Sprintf("%05d", 100+i)))
+		require.NoError(t, err)
+		otherNodes = append(otherNodes, other)
+	}
+	require.Greater(t, cap(l.nodes), 4*initialCap)
+	require.Equal(t, keyOffset, l.node(nd).offset)
+	it := l.NewIter(nil, nil)
+	assertKey(t, "00050", it.First())
+	require.Equal(t, nd, it.nd)
+
+	// Retarget the node to a newer record for the same user key.
+	newKeyOffset := d.add("00050")
+	require.NoError(t, l.UpdateKeyOffset(nd, newKeyOffset))
+	offset, ok := l.Get([]byte("00050"), false)
+	require.True(t, ok)
+	require.Equal(t, newKeyOffset, offset)
+	require.Equal(t, 1001, length(l))
+
+	// A record with a different user key is rejected.
+	require.Error(t, l.UpdateKeyOffset(nd, d.add("00051")))
+	// As is a record that would reorder the node relative to other records for
+	// the same user key, which are ordered by descending offset.
+	olderKeyOffset, newerKeyOffset := d.add("00100"), d.add("00100")
+	require.NoError(t, l.Add(newerKeyOffset))
+	require.NoError(t, l.UpdateKeyOffset(otherNodes[0], olderKeyOffset))
+	require.Error(t, l.UpdateKeyOffset(otherNodes[0], d.add("00100")))
+	require.Equal(t, olderKeyOffset, l.node(otherNodes[0]).offset)
+	// Invalid node offsets are rejected.
+	require.Error(t, l.UpdateKeyOffset(l.head, newKeyOffset))
+	require.Error(t, l.UpdateKeyOffset(l.tail, newKeyOffset))
+	require.Error(t, l.UpdateKeyOffset(uint32(len(l.nodes)), newKeyOffset))
+	// The node is unmodified by the failed updates.
+	require.Equal(t, newKeyOffset, l.node(nd).offset)
+
+	// With sequence tags, the record offset does not affect the order.
+	l = NewSkiplist(&d.data, base.DefaultComparer.Compare,
+		base.DefaultComparer.AbbreviatedKey, WithSequenceTags())
+	first, err := l.AddNode(d.add("a"))
+	require.NoError(t, err)
+	second := d.add("a")
+	require.NoError(t, l.Add(second))
+	updated := d.add("a")
+	require.NoError(t, l.UpdateKeyOffset(first, updated))
+	offset, ok = l.Get([]byte("a"), false)
+	require.True(t, ok)
+	require.Equal(t, updated, offset)
+	offset, ok = l.Get([]byte("a"), true)
+	require.True(t, ok)
+	require.Equal(t, second, offset)
+}
+
+// checkAbbreviatedKeyConsistency returns an error if abbreviatedKey is not
+// consistent with cmp for some pair of the given keys, as required by
+// base.AbbreviatedKey.
+func checkAbbreviatedKeyConsistency(
+	cmp base.Compare, abbreviatedKey base.AbbreviatedKey, keys [][]byte,
+) error {
+	for _, a := range keys {
+		for _, b := range keys {
+			aa, ba := abbreviatedKey(a), abbreviatedKey(b)
+			c := cmp(a, b)
+			if (aa < ba && c >= 0) || (aa > ba && c <= 0) || (c == 0 && aa != ba) {
+				return errors.Errorf("%q (%016x) and %q (%016x) compare %d", a, aa, b, ba, c)
+			}
+		}
+	}
+	return nil
+}
+
+func TestSkiplistCaseFoldedAbbreviatedKey(t *testing.T) {
+	seed := uint64(time.Now().UnixNano())
+	t.Logf("seed: %d", seed)
+	rng := rand.New(rand.NewSource(seed))
+
+	caseFoldedCompare := func(a, b []byte) int {
+		return bytes.Compare(bytes.ToLower(a), bytes.ToLower(b))
+	}
+	const alphabet = "aAbBzZ09_"
+	var keys [][]byte
+	for i := 0; i < 200; i++ {
+		key := make([]byte, rng.Intn(11))
+		for j := range key {
+			key[j] = alphabet[rng.Intn(len(alphabet))]
+		}
+		keys = append(keys, key)
+	}
+	keys = append(keys, []byte("abc"), []byte("ABC"), []byte("aBcDeFgHi"), []byte("AbCdEfGhI"))
+
+	require.NoError(t, checkAbbreviatedKeyConsistency(caseFoldedCompare, CaseFoldedAbbreviatedKey, keys))
+	// The abbreviated key of the default comparer is derived from the raw bytes
+	// and so is inconsistent with case-insensitive ordering.
+	require.Error(t, checkAbbreviatedKeyConsistency(
+		caseFoldedCompare, base.DefaultComparer.AbbreviatedKey, keys))
+	require.NoError(t, checkAbbreviatedKeyConsistency(
+		base.DefaultComparer.Compare, base.DefaultComparer.AbbreviatedKey, keys))
+
+	// Records are indexed in case-insensitive order.
+	d := &testStorage{}
+	l := NewSkiplist(&d.data, caseFoldedCompare, CaseFoldedAbbreviatedKey)
+	for _, key := range keys {
+		require.NoError(t, l.Add(d.addBytes(key)))
+	}
+	it := l.NewIter(nil, nil)
+	prev := it.First()
+	for k := it.Next(); k != nil; prev, k = k, it.Next() {
+		require.LessOrEqual(t, caseFoldedCompare(prev.UserKey, k.UserKey), 0)
+	}
+
+	t.Run("inconsistent", func(t *testing.T) {
+		if !invariants.Enabled {
+			t.Skip("requires invariants build")
+		}
+		// With raw abbreviated keys, "a" is positioned after "B" even though it
+		// sorts before it case-insensitively.
+		d := &testStorage{}
+		l := NewSkiplist(&d.data, caseFoldedCompare, base.DefaultComparer.AbbreviatedKey)
+		require.NoError(t, l.Add(d.add("B")))
+		require.Panics(t, func() { _ = l.Add(d.add("a")) })
+	})
+}
+
+func TestSkiplistAbbreviatedKeyValidation(t *testing.T) {
+	// An abbreviated key function that disagrees with the comparer: it orders
+	// keys by their last byte.
+	broken := func(key []byte) uint64 {
+		if len(key) == 0 {
+			return 0
+		}
+		return uint64(key[len(key)-1]) << 56
+	}
+	for _, opts := range [][]Option{{WithAbbreviatedKeyValidation(10)}, {WithAbbreviatedKeyValidation(10), WithRank()}} {
+		d := &testStorage{}
+		l := NewSkiplist(&d.data, base.DefaultComparer.Compare, broken, opts...)
+		require.NoError(t, l.Add(d.add("ab")))
+		require.NoError(t, l.Add(d.add("bc")))
+		// "ba" sorts between "ab" and "bc", but its last byte positions it before
+		// "ab". The violation is detected and the record is not added.
+		err := l.Add(d.add("ba"))
+		require.True(t, errors.Is(err, ErrInconsistentAbbreviatedKey), "%v", err)
+		require.Equal(t, 2, l.Len())
+		require.Equal(t, 2, length(l))
+		require.Equal(t, 2, lengthRev(l))
+		if l.opts.rank {
+			checkSpans(t, l)
+		}
+		// Records consistent with their neighbors are still added.
+		require.NoError(t, l.Add(d.add("cd")))
+		require.Equal(t, 3, length(l))
+	}
+
+	// Validation stops once the skiplist indexes n records.
+	if !invariants.Enabled {
+		d := &testStorage{}
+		l := NewSkiplist(&d.data, base.DefaultComparer.Compare, broken, WithAbbreviatedKeyValidation(2))
+		require.NoError(t, l.Add(d.add("ab")))
+		require.NoError(t, l.Add(d.add("bc")))
+		require.NoError(t, l.Add(d.add("ba")))
+	}
+
+	// A consistent abbreviated key function passes validation.
+	d := &testStorage{}
+	l := NewSkiplist(&d.data, base.DefaultComparer.Compare,
+		base.DefaultComparer.AbbreviatedKey, WithAbbreviatedKeyValidation(1000))
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, l.Add(d.add(fmt.Sprintf("%05d", (i*7919)%1000))))
+	}
+
+	require.Panics(t, func() { WithAbbreviatedKeyValidation(0) })
+}
+
+func TestSkiplistStats(t *testing.T) {
+	d := &testStorage{}
+	// Use a tiny pvalue so that every tower has a height of 1 and searches
+	// walk level 0.
+	l := NewSkiplist(&d.data, base.DefaultComparer.Compare,
+		base.DefaultComparer.AbbreviatedKey, WithStats(), WithPValue(1e-9))
+	var last Stats
+	delta := func() Stats {
+		cur := l.Stats()
+		res := Stats{
+			Comparisons:    cur.Comparisons - last.Comparisons,
+			KeyFetches:     cur.KeyFetches - last.KeyFetches,
+			LinkTraversals: cur.LinkTraversals - last.LinkTraversals,
+		}
+		last = cur
+		return res
+	}
+
+	// In-order adds only compare against the last key.
+	for i := 0; i < 10; i++ {
+		require.NoError(t, l.Add(d.add(fmt.Sprintf("%05d", i))))
+	}
+	require.EqualValues(t, 1, l.height)
+	require.Equal(t, Stats{Comparisons: 9}, delta())
+
+	// Seeking to the sixth key follows the link from the head and five further
+	// links, comparing against each of the six keys. Only the last comparison
+	// has equal abbreviated keys.
+	it := l.NewIter(nil, nil)
+	assertKey(t, "00005", it.SeekGE(makeKey("00005"), base.SeekGEFlagsNone))
+	require.Equal(t, Stats{Comparisons: 6, KeyFetches: 1, LinkTraversals: 6}, delta())
+	assertKey(t, "00004", it.SeekLT(makeKey("00005")))
+	require.Equal(t, Stats{Comparisons: 6, KeyFetches: 1, LinkTraversals: 6}, delta())
+	require.True(t, it.SeekGEWithMatch(makeKey("00003")))
+	require.Equal(t, Stats{Comparisons: 4, KeyFetches: 1, LinkTraversals: 4}, delta())
+	// Seeking past the last key walks to the tail.
+	require.Nil(t, it.SeekGE(makeKey("zzz"), base.SeekGEFlagsNone))
+	require.Equal(t, Stats{Comparisons: 10, LinkTraversals: 11}, delta())
+
+	// An out of order add compares against the last key before searching.
+	require.NoError(t, l.Add(d.add("00002")))
+	require.Equal(t, Stats{Comparisons: 1 + 3, KeyFetches: 1, LinkTraversals: 3}, delta())
+
+	// Iteration is not counted.
+	require.Equal(t, 11, length(l))
+	require.Equal(t, Stats{}, delta())
+
+	// Without WithStats, no counters are maintained.
+	l = newTestSkiplist(d)
+	require.NoError(t, l.Add(d.add("a")))
+	require.NoError(t, l.Add(d.add("b")))
+	it = l.NewIter(nil, nil)
+	it.SeekGE(makeKey("b"), base.SeekGEFlagsNone)
+	require.Equal(t, Stats{}, l.Stats())
+}
+
+func TestSkiplistFilterScan(t *testing.T) {
+	d := &testStorage{}
+	l := newTestSkiplist(d)
+	offsets := make(map[uint32]int)
+	for i := 0; i < 100; i++ {
+		offset := d.add(fmt.Sprintf("%05d", (i*37)%100))
+		offsets[offset] = (i * 37) % 100
+		require.NoError(t, l.Add(offset))
+	}
+	scan := func(pred func(key []byte) bool, limit int) []int {
+		var res []int
+		l.FilterScan(pred, func(offset uint32) bool {
+			res = append(res, offsets[offset])
+			return len(res) < limit
+		})
+		return res
+	}
+	even := func(key []byte) bool { return (key[len(key)-1]-'0')%2 == 0 }
+
+	var expected []int
+	for i := 0; i < 100; i += 2 {
+		expected = append(expected, i)
+	}
+	require.Equal(t, expected, scan(even, math.MaxInt))
+	// Stop early.
+	require.Equal(t, expected[:5], scan(even, 5))
+	require.Equal(t, expected[:1], scan(even, 1))
+	// A predicate that matches nothing.
+	require.Empty(t, scan(func([]byte) bool { return false }, math.MaxInt))
+	// An empty skiplist.
+	l = newTestSkiplist(d)
+	require.Empty(t, scan(func([]byte) bool { return true }, math.MaxInt))
+}
+
+func TestSkiplistNodeOffsetChecks(t *testing.T) {
+	if !invariants.Enabled {
+		t.Skip("node offsets are only checked in invariants builds")
+	}
+	d := &testStorage{}
+	l := newTestSkiplist(d)
+	require.NoError(t, l.Add(d.add("a")))
+	// Some spare capacity remains beyond the allocated nodes.
+	require.Greater(t, cap(l.nodes), len(l.nodes)+int(nodeSize(1)))
+
+	for _, offset := range []uint32{
+		// Beyond the allocated nodes, but within their capacity.
+		uint32(len(l.nodes)) - 4,
+		uint32(len(l.nodes)),
+		// Misaligned.
+		l.tail + 1,
+	} {
+		err := func() (err error) {
+			defer func() { err = recover().(error) }()
+			l.node(offset)
+			return nil
+		}()
+		require.Error(t, err)
+		require.True(t, errors.IsAssertionFailure(err))
+		require.Contains(t, err.Error(), fmt.Sprintf("batchskl: invalid node offset %d", offset))
+	}
+}
+
+func TestSkiplistSuppliedAbbreviatedKey(t *testing.T) {
+	abbreviatedKey := base.DefaultComparer.AbbreviatedKey
+	d := &testStorage{}
+	l, ref := newTestSkiplist(d), newTestSkiplist(d)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("%05d", (i*37)%100)
+		offset := d.add(key)
+		require.NoError(t, l.AddWithAbbreviatedKey(offset, abbreviatedKey([]byte(key))))
+		require.NoError(t, ref.Add(offset))
+	}
+	require.True(t, l.Equal(ref))
+
+	it, refIt := l.NewIter(nil, nil), ref.NewIter(nil, nil)
+	for i := 0; i < 100; i += 7 {
+		key := makeKey(fmt.Sprintf("%05d", i))
+		require.Equal(t, refIt.SeekGE(key, base.SeekGEFlagsNone),
+			it.SeekGEWithAbbreviatedKey(key, abbreviatedKey(key), base.SeekGEFlagsNone))
+		next := makeKey(fmt.Sprintf("%05d", i+2))
+		require.Equal(t, refIt.SeekGE(next, base.SeekGEFlagsNone.EnableTrySeekUsingNext()),
+			it.SeekGEWithAbbreviatedKey(next, abbreviatedKey(next), base.SeekGEFlagsNone.EnableTrySeekUsingNext()))
+	}
+	require.Nil(t, it.SeekGEWithAbbreviatedKey(makeKey("zzz"), abbreviatedKey(makeKey("zzz")), base.SeekGEFlagsNone))
+
+	// An incorrect abbreviated key is detected in invariants builds.
+	if invariants.Enabled {
+		offset := d.add("00050")
+		require.Panics(t, func() { _ = l.AddWithAbbreviatedKey(offset, 0) })
+		require.Panics(t, func() { it.SeekGEWithAbbreviatedKey(makeKey("00050"), 0, base.SeekGEFlagsNone) })
+	}
+}
+
+func TestSkiplistBytesPerKey(t *testing.T) {
+	for _, tc := range []struct {
+		opts      []Option
+		pValue    float64
+		extraBase float64
+		extraLink float64
+	}{
+		{pValue: defaultPValue},
+		{opts: []Option{WithPValue(0.5)}, pValue: 0.5},
+		{opts: []Option{WithRank()}, pValue: defaultPValue, extraLink: 4},
+		{opts: []Option{WithSequenceTags()}, pValue: defaultPValue, extraBase: 4},
+	} {
+		d := &testStorage{}
+		l := NewSkiplist(&d.data, base.DefaultComparer.Compare,
+			base.DefaultComparer.AbbreviatedKey, tc.opts...)
+		require.Zero(t, l.BytesPerKey())
+		l.rand.Seed(1)
+
+		const n = 10000
+		for i := 0; i < n; i++ {
+			require.NoError(t, l.Add(d.add(fmt.Sprintf("%05d", i))))
+		}
+		// A node with a tower of height h occupies the fixed part of the node
+		// plus h links. Tower heights are geometrically distributed with a mean of
+		// 1/(1-p).
+		fixedSize := float64(nodeSize(1)-uint32(linksSize)) + tc.extraBase
+		linkSize := float64(linksSize) + tc.extraLink
+		expected := fixedSize + linkSize/(1-tc.pValue)
+		require.InEpsilon(t, expected, l.BytesPerKey(), 0.02)
+
+		// The value is exact for the tower heights that were chosen.
+		var heights int
+		for nd := l.getNext(l.head, 0); nd != l.tail; nd = l.getNext(nd, 0) {
+			heights += int(l.node(nd).height)
+		}
+		require.InDelta(t, fixedSize+linkSize*float64(heights)/n, l.BytesPerKey(), 1e-9)
+	}
+}
+
+func TestSkiplistMaxHeight(t *testing.T) {
+	for _, height := range []int{0, -1, maxHeight + 1} {
+		require.Panics(t, func() { WithMaxHeight(height) })
+	}
+
+	for _, limit := range []uint32{1, 3, maxHeight} {
+		for _, opts := range [][]Option{nil, {WithRank()}} {
+			d := &testStorage{}
+			l := NewSkiplist(&d.data, base.DefaultComparer.Compare,
+				base.DefaultComparer.AbbreviatedKey, append(opts, WithMaxHeight(int(limit)))...)
+			// The sentinels are only as tall as the limit.
+			require.Equal(t, l.nodeAllocSize(limit), l.tail)
+			require.Equal(t, 2*int(l.nodeAllocSize(limit)), len(l.nodes))
+			require.Equal(t, limit, l.node(l.head).height)
+			require.Equal(t, limit, l.node(l.tail).height)
+
+			// A record that would be given a height above the limit is clamped.
+			if limit < maxHeight {
+				for seed := uint64(0); ; seed++ {
+					u := Skiplist{probabilities: &probabilities, heightLimit: maxHeight}
+					u.rand.Seed(seed)
+					if u.randomHeight() > limit {
+						l.rand.Seed(seed)
+						break
+					}
+				}
+				require.NoError(t, l.Add(d.add("00000")))
+				h, ok := l.HeightOf(makeKey("00000"))
+				require.True(t, ok)
+				require.EqualValues(t, limit, h)
+			}
+
+			rng := rand.New(rand.NewSource(uint64(time.Now().UnixNano())))
+			for i := 0; i < 1000; i++ {
+				require.NoError(t, l.Add(d.add(fmt.Sprintf("%05d", rng.Intn(2000)))))
+			}
+			require.LessOrEqual(t, l.height, limit)
+			for nd := l.getNext(l.head, 0); nd != l.tail; nd = l.getNext(nd, 0) {
+				require.LessOrEqual(t, l.node(nd).height, limit)
+			}
+			if l.opts.rank {
+				checkSpans(t, l)
+			}
+
+			// Operations that seed splices from the head respect the limit.
+			other := newTestSkiplist(d)
+			for i := 0; i < 100; i++ {
+				require.NoError(t, other.Add(d.add(fmt.Sprintf("%05d", rng.Intn(2000)))))
+			}
+			require.NoError(t, l.Merge(other))
+			require.Equal(t, l.Len(), length(l))
+			require.Equal(t, l.Len(), lengthRev(l))
+			require.Equal(t, []int{-1}, l.MultiGet([][]byte{makeKey("zzz")}))
+			c := l.Compact()
+			require.True(t, c.Equal(l))
+			require.Equal(t, limit, c.node(c.head).height)
+		}
+	}
+}
+
+func TestSkiplistSeed(t *testing.T) {
+	// heights returns the tower heights of the nodes of a skiplist indexing the
+	// same records, in order.
+	heights := func(opts ...Option) []uint32 {
+		d := &testStorage{}
+		l := NewSkiplist(&d.data, base.DefaultComparer.Compare,
+			base.DefaultComparer.AbbreviatedKey, opts...)
+		for i := 0; i < 200; i++ {
+			require.NoError(t, l.Add(d.add(fmt.Sprintf("%05d", (i*7919)%200))))
+		}
+		var h []uint32
+		for nd := l.getNext(l.head, 0); nd != l.tail; nd = l.getNext(nd, 0) {
+			h = append(h, l.node(nd).height)
+		}
+
+		// Reinitializing the skiplist reseeds it, reproducing the layout.
+		l.ResetWithCap(&d.data, math.MaxInt)
+		d.data = d.data[:0]
+		for i := 0; i < 200; i++ {
+			require.NoError(t, l.Add(d.add(fmt.Sprintf("%05d", (i*7919)%200))))
+		}
+		var again []uint32
+		for nd := l.getNext(l.head, 0); nd != l.tail; nd = l.getNext(nd, 0) {
+			again = append(again, l.node(nd).height)
+		}
+		if l.opts.seeded {
+			require.Equal(t, h, again)
+		}
+		return h
+	}
+	require.Equal(t, heights(WithSeed(1)), heights(WithSeed(1)))
+	require.Equal(t, heights(WithSeed(1), WithRank()), heights(WithSeed(1)))
+	require.NotEqual(t, heights(WithSeed(1)), heights(WithSeed(2)))
+}
+
+func TestBuildSkiplist(t *testing.T) {
+	for _, tc := range []struct {
+		opts    []Option
+		seqTags bool
+	}{{}, {opts: []Option{WithRank()}}, {opts: []Option{WithSequenceTags()}, seqTags: true}} {
+		d := &testStorage{}
+		var offsets []uint32
+		for i := 0; i < 1000; i++ {
+			offsets = append(offsets, d.add(fmt.Sprintf("%05d", i)))
+		}
+		// Equal user keys ordered by descending offset, or in insertion order with
+		// sequence tags.
+		dup1, dup2 := d.add("01000"), d.add("01000")
+		if tc.seqTags {
+			offsets = append(offsets, dup1, dup2)
+		} else {
+			offsets = append(offsets, dup2, dup1)
+		}
+
+		l, err := BuildSkiplist(&d.data, base.DefaultComparer.Compare,
+			base.DefaultComparer.AbbreviatedKey, offsets, tc.opts...)
+		require.NoError(t, err)
+		require.Equal(t, len(offsets), length(l))
+		// Iteration yields exactly the input order, in both directions.
+		var fwd, rev []uint32
+		it := l.NewIter(nil, nil)
+		for k := it.First(); k != nil; k = it.Next() {
+			offset, _, _ := it.KeyInfo()
+			fwd = append(fwd, offset)
+		}
+		for k := it.Last(); k != nil; k = it.Prev() {
+			offset, _, _ := it.KeyInfo()
+			rev = append([]uint32{offset}, rev...)
+		}
+		require.Equal(t, offsets, fwd)
+		require.Equal(t, offsets, rev)
+		// The skiplist is searchable and accepts further records.
+		for i := 0; i < 1000; i += 97 {
+			key := fmt.Sprintf("%05d", i)
+			require.Equal(t, key, string(it.SeekGE([]byte(key), base.SeekGEFlagsNone).UserKey))
+		}
+		require.NoError(t, l.Add(d.add("00500")))
+		require.Equal(t, len(offsets)+1, length(l))
+	}
+
+	d := &testStorage{}
+	// An empty skiplist.
+	l, err := BuildSkiplist(&d.data, base.DefaultComparer.Compare,
+		base.DefaultComparer.AbbreviatedKey, nil)
+	require.NoError(t, err)
+	require.Equal(t, 0, length(l))
+	// A malformed record.
+	_, err = BuildSkiplist(&d.data, base.DefaultComparer.Compare,
+		base.DefaultComparer.AbbreviatedKey, []uint32{d.add("a"), uint32(len(d.data))})
+	require.Error(t, err)
+	// Records out of order are detected in invariants builds.
+	if invariants.Enabled {
+		offsets := []uint32{d.add("b"), d.add("a")}
+		require.Panics(t, func() {
+			_, _ = BuildSkiplist(&d.data, base.DefaultComparer.Compare,
+				base.DefaultComparer.AbbreviatedKey, offsets)
+		})
+	}
+}
+
+func TestBuildSkiplistWithoutDuplicates(t *testing.T) {
+	for _, keepLast := range []bool{false, true} {
+		for _, opts := range [][]Option{nil, {WithRank()}, {WithSequenceTags()}} {
+			d := &testStorage{}
+			var offsets, want []uint32
+			var wantDropped int
+			// Runs of 1 to 4 records with equal user keys, whose offsets within a run
+			// are not ordered.
+			for i := 0; i < 100; i++ {
+				key := fmt.Sprintf("%03d", i)
+				var run []uint32
+				for j := 0; j <= i%4; j++ {
+					run = append(run, d.add(key))
+				}
+				if i%2 == 0 {
+					slices.Reverse(run)
+				}
+				offsets = append(offsets, run...)
+				if keepLast {
+					want = append(want, run[len(run)-1])
+				} else {
+					want = append(want, run[0])
+				}
+				wantDropped += len(run) - 1
+			}
+
+			l, dropped, err := BuildSkiplistWithoutDuplicates(&d.data, base.DefaultComparer.Compare,
+				base.DefaultComparer.AbbreviatedKey, offsets, keepLast, opts...)
+			require.NoError(t, err)
+			require.Equal(t, wantDropped, dropped)
+			var got []uint32
+			it := l.NewIter(nil, nil)
+			for k := it.First(); k != nil; k = it.Next() {
+				offset, _, _ := it.KeyInfo()
+				got = append(got, offset)
+			}
+			require.Equal(t, want, got)
+			require.Equal(t, len(want), lengthRev(l))
+			if l.opts.rank {
+				for i, offset := range want {
+					require.Equal(t, i, l.Rank(d.data[offset+2:offset+5]))
+				}
+			}
+		}
+	}
+
+	// A malformed record is reported.
+	d := &testStorage{}
+	_, _, err := BuildSkiplistWithoutDuplicates(&d.data, base.DefaultComparer.Compare,
+		base.DefaultComparer.AbbreviatedKey, []uint32{d.add("a"), d.add("a"), uint32(len(d.data))}, false)
+	require.Error(t, err)
+}
+
+func TestSkiplistValues(t *testing.T) {
+	for _, opts := range [][]Option{
+		{WithValues()},
+		{WithValues(), WithRank()},
+		{WithValues(), WithSequenceTags(), WithRank()},
+	} {
+		d := &testStorage{}
+		l := NewSkiplist(&d.data, base.DefaultComparer.Compare,
+			base.DefaultComparer.AbbreviatedKey, opts...)
+		values := make(map[uint32]uint64)
+		for i := 0; i < 1000; i++ {
+			offset := d.add(fmt.Sprintf("%05d", i%100))
+			value := uint64(i)<<32 | uint64(i)
+			require.NoError(t, l.AddWithValue(offset, value))
+			values[offset] = value
+		}
+		// A record added without a value has a value of zero.
+		offset := d.add("00050")
+		require.NoError(t, l.Add(offset))
+		values[offset] = 0
+
+		check := func(l *Skiplist) {
+			t.Helper()
+			n := 0
+			it := l.NewIter(nil, nil)
+			for k := it.First(); k != nil; k = it.Next() {
+				offset, _, _ := it.KeyInfo()
+				require.Equal(t, values[offset], it.Value())
+				n++
+			}
+			require.Equal(t, len(values), n)
+		}
+		check(l)
+		// Overwriting a key adds a newer version with its own value, without
+		// affecting the values of older versions.
+		offset = d.add("00007")
+		require.NoError(t, l.AddWithValue(offset, 7))
+		values[offset] = 7
+		it := l.NewIter(nil, nil)
+		it.SeekGE(makeKey("00007"), base.SeekGEFlagsNone)
+		if l.opts.seqTags {
+			it.SeekLT(makeKey("00008"))
+		}
+		require.Equal(t, uint64(7), it.Value())
+		check(l)
+		// Values are retained by compaction and carried over by merges.
+		check(l.Compact())
+		m := NewSkiplist(&d.data, base.DefaultComparer.Compare,
+			base.DefaultComparer.AbbreviatedKey, opts...)
+		require.NoError(t, m.Merge(l))
+		check(m)
+	}
+
+	d := &testStorage{}
+	l := newTestSkiplist(d)
+	require.Error(t, l.AddWithValue(d.add("a"), 1))
+	require.NoError(t, l.Add(d.add("a")))
+	it := l.NewIter(nil, nil)
+	it.First()
+	require.Equal(t, uint64(0), it.Value())
+}
+
+func TestSkiplistDistance(t *testing.T) {
+	d := &testStorage{}
+	l := NewSkiplist(&d.data, base.DefaultComparer.Compare,
+		base.DefaultComparer.AbbreviatedKey, WithRank())
+	nodes := make(map[string]uint32)
+	for _, key := range []string{"d", "b", "a", "e", "c"} {
+		nd, err := l.AddNode(d.add(key))
+		require.NoError(t, err)
+		nodes[key] = nd
+	}
+	require.Equal(t, 0, mustDistance(t, l, nodes["c"], nodes["c"]))
+	require.Equal(t, 1, mustDistance(t, l, nodes["a"], nodes["b"]))
+	require.Equal(t, 2, mustDistance(t, l, nodes["b"], nodes["d"]))
+	require.Equal(t, 4, mustDistance(t, l, nodes["a"], nodes["e"]))
+	_, ok := l.Distance(nodes["e"], nodes["a"])
+	require.False(t, ok)
+	_, ok = l.Distance(nodes["c"], nodes["b"])
+	require.False(t, ok)
+
+	// The distance spanned by every link matches its span counter.
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, l.Add(d.add(fmt.Sprintf("%05d", (i*7919)%1000))))
+	}
+	for nd := l.getNext(l.head, 0); nd != l.tail; nd = l.getNext(nd, 0) {
+		for level := uint32(0); level < l.node(nd).height; level++ {
+			if next := l.getNext(nd, level); next != l.tail {
+				require.EqualValues(t, l.spans(nd)[level], mustDistance(t, l, nd, next))
+			}
+		}
+	}
+}
+
+func mustDistance(t *testing.T, l *Skiplist, a, b uint32) int {
+	t.Helper()
+	d, ok := l.Distance(a, b)
+	require.True(t, ok)
+	return d
+}
+
+func TestSkiplistResetWithCap(t *testing.T) {
+	d := &testStorage{}
+	l := NewSkiplist(&d.data, base.DefaultComparer.Compare,
+		base.DefaultComparer.AbbreviatedKey, WithRank())
+	fill := func(n int) {
+		for i := 0; i < n; i++ {
+			require.NoError(t, l.Add(d.add(fmt.Sprintf("%05d", i))))
+		}
+	}
+	fill(10000)
+	large := cap(l.nodes)
+
+	// A nodes slice within the cap is retained.
+	other := &testStorage{}
+	l.ResetWithCap(&other.data, large)
+	require.Equal(t, large, cap(l.nodes))
+	require.Equal(t, 0, length(l))
+	d = other
+	fill(100)
+	require.Equal(t, 100, lengthRev(l))
+	// The options are retained.
+	require.Equal(t, 50, l.Rank(makeKey("00050")))
+	checkSpans(t, l)
+
+	// A nodes slice exceeding the cap is released.
+	fill(10000)
+	l.ResetWithCap(&d.data, large/2)
+	require.Less(t, cap(l.nodes), large/2)
+	require.Equal(t, 0, length(l))
+	fill(100)
+	require.Equal(t, 100, length(l))
+}
+
+func TestSkiplistKeyLength(t *testing.T) {
+	// By default any key length is permitted.
+	d := &testStorage{}
+	l := newTestSkiplist(d)
+	require.NoError(t, l.Add(d.add("")))
+	require.NoError(t, l.Add(d.add(strings.Repeat("a", 1000))))
+
+	l = NewSkiplist(&d.data, base.DefaultComparer.Compare,
+		base.DefaultComparer.AbbreviatedKey, WithMaxKeyLength(4), WithoutEmptyKeys())
+	require.NoError(t, l.Add(d.add("a")))
+	require.NoError(t, l.Add(d.add("abcd")))
+	err := l.Add(d.add("abcde"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "exceeding the maximum of 4")
+	err = l.Add(d.add(""))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "empty key")
+	// The limits apply to every means of adding records.
+	require.Error(t, l.AddWithSplice(d.add("abcdef"), &Splice{}))
+	_, err = l.AddNode(d.add(""))
+	require.Error(t, err)
+	other := newTestSkiplist(d)
+	require.NoError(t, other.Add(d.add("toolong")))
+	require.Error(t, l.Merge(other))
+	_, err = BuildSkiplist(&d.data, base.DefaultComparer.Compare,
+		base.DefaultComparer.AbbreviatedKey, []uint32{d.add("toolong")}, WithMaxKeyLength(4))
+	require.Error(t, err)
+	// Violating records are not added.
+	require.Equal(t, 2, length(l))
+	require.Equal(t, 2, lengthRev(l))
+
+	require.Panics(t, func() { WithMaxKeyLength(0) })
+}
+
+func TestSkiplistDescending(t *testing.T) {
+	for _, opts := range [][]Option{{WithDescending()}, {WithDescending(), WithRank()}} {
+		d := &testStorage{}
+		l := NewSkiplist(&d.data, base.DefaultComparer.Compare,
+			base.DefaultComparer.AbbreviatedKey, opts...)
+		rng := rand.New(rand.NewSource(uint64(time.Now().UnixNano())))
+		for i := 0; i < 1000; i++ {
+			key := fmt.Sprintf("%05d", rng.Intn(2000))
+			if i%2 == 0 {
+				require.NoError(t, l.Add(d.add(key)))
+			} else {
+				require.NoError(t, l.AddWithAbbreviatedKey(
+					d.add(key), base.DefaultComparer.AbbreviatedKey(makeKey(key))))
+			}
+		}
+		checkDescending := func(l *Skiplist) {
+			t.Helper()
+			// Forward iteration yields keys in decreasing order, and reverse
+			// iteration in increasing order.
+			it := l.NewIter(nil, nil)
+			prev := string(it.First().UserKey)
+			n := 1
+			for k := it.Next(); k != nil; k = it.Next() {
+				require.GreaterOrEqual(t, prev, string(k.UserKey))
+				prev = string(k.UserKey)
+				n++
+			}
+			require.Equal(t, 1000, n)
+			prev = string(it.Last().UserKey)
+			for k := it.Prev(); k != nil; k = it.Prev() {
+				require.LessOrEqual(t, prev, string(k.UserKey))
+				prev = string(k.UserKey)
+			}
+			if l.opts.rank {
+				checkSpans(t, l)
+			}
+		}
+		checkDescending(l)
+		checkDescending(l.Compact())
+
+		// Distinct keys are strictly decreasing.
+		it := l.NewIter(nil, nil)
+		it.SetSkipDuplicateAbbreviatedKeys(true)
+		prev := string(it.First().UserKey)
+		for k := it.Next(); k != nil; k = it.Next() {
+			require.Greater(t, prev, string(k.UserKey))
+			prev = string(k.UserKey)
+		}
+
+		// SeekGE positions at the first key less than or equal to the sought key,
+		// and SeekLT at the last key greater than it.
+		var keys []string
+		it = l.NewIter(nil, nil)
+		for k := it.First(); k != nil; k = it.Next() {
+			keys = append(keys, string(k.UserKey))
+		}
+		for i := 0; i < 100; i++ {
+			key := fmt.Sprintf("%05d", rng.Intn(2100))
+			j := sort.Search(len(keys), func(j int) bool { return keys[j] <= key })
+			k := it.SeekGE(makeKey(key), base.SeekGEFlagsNone)
+			if j == len(keys) {
+				require.Nil(t, k)
+			} else {
+				assertKey(t, keys[j], k)
+			}
+			k = it.SeekGEWithAbbreviatedKey(makeKey(key),
+				base.DefaultComparer.AbbreviatedKey(makeKey(key)), base.SeekGEFlagsNone)
+			if j == len(keys) {
+				require.Nil(t, k)
+			} else {
+				assertKey(t, keys[j], k)
+			}
+			k = it.SeekLT(makeKey(key))
+			if j == 0 {
+				require.Nil(t, k)
+			} else {
+				assertKey(t, keys[j-1], k)
+			}
+			// Rank counts the keys that precede the key in descending order.
+			require.Equal(t, j, l.Rank(makeKey(key)))
+		}
+
+		// A lower bound excludes larger keys and an upper bound smaller or equal
+		// keys.
+		it = l.NewIter(makeKey("01500"), makeKey("00500"))
+		for k := it.SeekGE(makeKey("01500"), base.SeekGEFlagsNone); k != nil; k = it.Next() {
+			require.LessOrEqual(t, string(k.UserKey), "01500")
+			require.Greater(t, string(k.UserKey), "00500")
+		}
+		for k := it.SeekLT(makeKey("00500")); k != nil; k = it.Prev() {
+			require.LessOrEqual(t, string(k.UserKey), "01500")
+			require.Greater(t, string(k.UserKey), "00500")
+		}
+
+		// Prefix scans visit the keys with the prefix in descending order.
+		var scanned []string
+		l.PrefixScan(makeKey("001"), func(offset uint32) bool {
+			scanned = append(scanned, string(d.data[offset+2:offset+7]))
+			return true
+		})
+		var want []string
+		for _, k := range keys {
+			if strings.HasPrefix(k, "001") {
+				want = append(want, k)
+			}
+		}
+		require.Equal(t, want, scanned)
+
+		// The order is retained by ResetWithCap, and skiplists with different
+		// orders cannot be merged.
+		require.Error(t, l.Merge(newTestSkiplist(d)))
+		l.ResetWithCap(&d.data, 0)
+		for _, k := range []string{"b", "c", "a"} {
+			require.NoError(t, l.Add(d.add(k)))
+		}
+		it = l.NewIter(nil, nil)
+		assertKey(t, "c", it.First())
+		assertKey(t, "b", it.Next())
+		assertKey(t, "a", it.Next())
+	}
+}
+
+func TestConcurrentSkiplist(t *testing.T) {
+	const n = 20000
+	const readers = 4
+	// Every record is written to the storage before the readers start.
+	d := &testStorage{}
+	offsets := make([]uint32, n)
+	for i := range offsets {
+		offsets[i] = d.add(fmt.Sprintf("%06d", i))
+	}
+	rng := rand.New(rand.NewSource(uint64(time.Now().UnixNano())))
+	rng.Shuffle(n, func(i, j int) { offsets[i], offsets[j] = offsets[j], offsets[i] })
+
+	for _, opts := range [][]Option{nil, {WithRank()}, {WithSequenceTags()}} {
+		l := NewConcurrentSkiplist(&d.data, base.DefaultComparer.Compare,
+			base.DefaultComparer.AbbreviatedKey, 4<<20, opts...)
+		var done atomic.Bool
+		var wg sync.WaitGroup
+		errs := make(chan error, readers)
+		for r := 0; r < readers; r++ {
+			wg.Add(1)
+			go func(r int) {
+				defer wg.Done()
+				it := l.NewIter(nil, nil)
+				for last := 0; ; {
+					finished := done.Load()
+					// Forward iteration observes records in ascending order, and
+					// never fewer than on the previous pass.
+					var count int
+					var prev []byte
+					for k := it.First(); k != nil; k = it.Next() {
+						if prev != nil && bytes.Compare(prev, k.UserKey) >= 0 {
+							errs <- errors.Errorf("reader %d: %q follows %q", r, k.UserKey, prev)
+							return
+						}
+						prev = k.UserKey
+						count++
+					}
+					if count < last || (finished && count != n) {
+						errs <- errors.Errorf("reader %d: observed %d records after %d", r, count, last)
+						return
+					}
+					last = count
+					// Backward iteration observes records in descending order.
+					prev = nil
+					for k := it.Last(); k != nil; k = it.Prev() {
+						if prev != nil && bytes.Compare(prev, k.UserKey) <= 0 {
+							errs <- errors.Errorf("reader %d: %q precedes %q", r, k.UserKey, prev)
+							return
+						}
+						prev = k.UserKey
+					}
+					// Seeks land at or after the sought key.
+					key := makeKey(fmt.Sprintf("%06d", r*n/readers+count%(n/readers)))
+					if k := it.SeekGE(key, base.SeekGEFlagsNone); k != nil && bytes.Compare(k.UserKey, key) < 0 {
+						errs <- errors.Errorf("reader %d: SeekGE(%q) = %q", r, key, k.UserKey)
+						return
+					}
+					if finished {
+						return
+					}
+				}
+			}(r)
+		}
+		for _, offset := range offsets {
+			require.NoError(t, l.Add(offset))
+		}
+		done.Store(true)
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			t.Fatal(err)
+		}
+		require.Equal(t, n, length(l))
+		require.Equal(t, n, lengthRev(l))
+		if l.opts.rank {
+			checkSpans(t, l)
+		}
+	}
+
+	// The nodes slice has a fixed size.
+	l := NewConcurrentSkiplist(&d.data, base.DefaultComparer.Compare,
+		base.DefaultComparer.AbbreviatedKey, 4<<10)
+	var err error
+	for i := 0; err == nil; i++ {
+		require.Less(t, i, n)
+		err = l.Add(offsets[i])
+	}
+	require.True(t, errors.Is(err, ErrArenaFull))
+	require.Equal(t, 4<<10, cap(l.nodes))
+	// Operations that would modify nodes visible to readers are rejected.
+	require.Error(t, l.Truncate(l.Checkpoint()))
+	require.Error(t, l.UpdateKeyOffset(l.getNext(l.head, 0), l.node(l.getNext(l.head, 0)).offset))
+	require.Panics(t, func() {
+		NewConcurrentSkiplist(&d.data, base.DefaultComparer.Compare,
+			base.DefaultComparer.AbbreviatedKey, 4<<10, WithStats())
+	})
+	require.Panics(t, func() {
+		NewConcurrentSkiplist(&d.data, base.DefaultComparer.Compare,
+			base.DefaultComparer.AbbreviatedKey, 0)
+	})
+}
+
+func TestSkiplistSentinelKeyChecks(t *testing.T) {
+	if !invariants.Enabled {
+		t.Skip("sentinel keys are only checked in invariants builds")
+	}
+	d := &testStorage{}
+	l := newTestSkiplist(d)
+	require.NoError(t, l.Add(d.add("")))
+
+	expectPanic := func(fn func()) {
+		err := func() (err error) {
+			defer func() { err = recover().(error) }()
+			fn()
+			return nil
+		}()
+		require.Error(t, err)
+		require.True(t, errors.IsAssertionFailure(err))
+	}
+	for _, nd := range []uint32{l.head, l.tail} {
+		require.True(t, l.isSentinel(nd))
+		expectPanic(func() { l.getKey(nd) })
+	}
+	require.False(t, l.isSentinel(l.getNext(l.head, 0)))
+
+	// An unpositioned or exhausted iterator has no key.
+	it := l.NewIter(nil, nil)
+	expectPanic(func() { it.KeyInfo() })
+	assertKey(t, "", it.Last())
+	require.Nil(t, it.Next())
+	expectPanic(func() { it.KeyInfo() })
+	// Moving past the end remains there, rather than reaching the head.
+	require.Nil(t, it.Next())
+	require.True(t, it.AtEnd())
+	assertKey(t, "", it.Prev())
+	require.Nil(t, it.Prev())
+	require.Nil(t, it.Prev())
+	require.True(t, it.AtStart())
+}
+
 // TestIteratorNext tests a basic iteration over all nodes from the beginning.
 func TestIteratorNext(t *testing.T) {
 	const n = 100
@@ -231,6 +2326,92 @@ func TestIteratorSeekGE(t *testing.T) {
 	assertKey(t, "", it.SeekGE(makeKey(""), base.SeekGEFlagsNone))
 }
 
+func TestIteratorSeekGEWithMatch(t *testing.T) {
+	d := &testStorage{}
+	l := newTestSkiplist(d)
+	it := l.NewIter(nil, nil)
+	require.False(t, it.SeekGEWithMatch(makeKey("a")))
+
+	// 01000, 01010, 01020, ..., 01990.
+	for i := 99; i >= 0; i-- {
+		require.NoError(t, l.Add(d.add(fmt.Sprintf("%05d", i*10+1000))))
+	}
+	// Keys that share their abbreviated key.
+	require.NoError(t, l.Add(d.add("longkey-2")))
+	require.NoError(t, l.Add(d.add("longkey-4")))
+
+	// Exact hits.
+	require.True(t, it.SeekGEWithMatch(makeKey("01000")))
+	assertKey(t, "01000", &it.key)
+	require.True(t, it.SeekGEWithMatch(makeKey("01500")))
+	assertKey(t, "01500", &it.key)
+	require.True(t, it.SeekGEWithMatch(makeKey("longkey-4")))
+	assertKey(t, "longkey-4", &it.key)
+	assertKey(t, "longkey-2", it.Prev())
+
+	// Near misses position the iterator at the next key.
+	require.False(t, it.SeekGEWithMatch(makeKey("01505")))
+	assertKey(t, "01510", &it.key)
+	require.False(t, it.SeekGEWithMatch(makeKey("0")))
+	assertKey(t, "01000", &it.key)
+	require.False(t, it.SeekGEWithMatch(makeKey("longkey-3")))
+	assertKey(t, "longkey-4", &it.key)
+	require.False(t, it.SeekGEWithMatch(makeKey("longkey")))
+	assertKey(t, "longkey-2", &it.key)
+
+	// Seeking past the end exhausts the iterator.
+	require.False(t, it.SeekGEWithMatch(makeKey("longkey-5")))
+	assertKey(t, "longkey-4", it.Prev())
+
+	// An exact match at or beyond the upper bound is not reported.
+	it = l.NewIter(nil, makeKey("01500"))
+	require.True(t, it.SeekGEWithMatch(makeKey("01490")))
+	require.False(t, it.SeekGEWithMatch(makeKey("01500")))
+	require.False(t, it.SeekGEWithMatch(makeKey("01600")))
+}
+
+func TestIteratorSeekGEAbbreviatedKey(t *testing.T) {
+	abbreviatedKey := base.DefaultComparer.AbbreviatedKey
+	d := &testStorage{}
+	l := newTestSkiplist(d)
+	it := l.NewIter(nil, nil)
+	require.Nil(t, it.SeekGEAbbreviatedKey(0))
+
+	// With 8-byte keys the abbreviated key is the complete key, so seeks are
+	// exact.
+	var buf [8]byte
+	for i := 0; i < 100; i++ {
+		binary.BigEndian.PutUint64(buf[:], uint64(i*10))
+		require.NoError(t, l.Add(d.addBytes(buf[:])))
+	}
+	for _, tc := range []struct{ target, expected uint64 }{
+		{0, 0}, {1, 10}, {10, 10}, {495, 500}, {990, 990},
+	} {
+		k := it.SeekGEAbbreviatedKey(tc.target)
+		require.NotNil(t, k)
+		require.Equal(t, tc.expected, binary.BigEndian.Uint64(k.UserKey))
+		binary.BigEndian.PutUint64(buf[:], tc.target)
+		require.Equal(t, k, it.SeekGE(buf[:], base.SeekGEFlagsNone))
+	}
+	require.Nil(t, it.SeekGEAbbreviatedKey(991))
+
+	// With longer keys the iterator is positioned at the first key sharing the
+	// abbreviated key, which the caller may then refine.
+	d = &testStorage{}
+	l = newTestSkiplist(d)
+	for _, k := range []string{"aaaaaaaa1", "aaaaaaaa2", "bbbbbbbb1", "bbbbbbbb2"} {
+		require.NoError(t, l.Add(d.add(k)))
+	}
+	it = l.NewIter(nil, makeKey("bbbbbbbb2"))
+	assertKey(t, "aaaaaaaa1", it.SeekGEAbbreviatedKey(abbreviatedKey(makeKey("aaaaaaaa2"))))
+	assertKey(t, "bbbbbbbb1", it.SeekGEAbbreviatedKey(abbreviatedKey(makeKey("aaaaaaab"))))
+	assertKey(t, "bbbbbbbb1", it.SeekGEAbbreviatedKey(abbreviatedKey(makeKey("bbbbbbbb2"))))
+	// The upper bound is respected.
+	assertKey(t, "bbbbbbbb1", it.SeekGEAbbreviatedKey(abbreviatedKey(makeKey("bbbbbbbb"))))
+	require.Nil(t, it.Next())
+	require.Nil(t, it.SeekGEAbbreviatedKey(abbreviatedKey(makeKey("c"))))
+}
+
 func TestIteratorSeekLT(t *testing.T) {
 	const n = 100
 	d := &testStorage{}
@@ -256,7 +2437,6 @@ func TestIteratorSeekLT(t *testing.T) {
 	assertKey(t, "", it.SeekLT(makeKey("\x01")))
 }
 
-// TODO(peter): test First and Last.
 func TestIteratorBounds(t *testing.T) {
 	d := &testStorage{}
 	l := newTestSkiplist(d)
@@ -313,6 +2493,604 @@ func TestIteratorBounds(t *testing.T) {
 	require.Nil(t, it.Prev())
 }
 
+func TestIteratorClone(t *testing.T) {
+	d := &testStorage{}
+	l := newTestSkiplist(d)
+	for i := 1; i < 10; i++ {
+		require.NoError(t, l.Add(d.add(fmt.Sprintf("%05d", i))))
+	}
+
+	it := l.NewIter(nil, makeKey("00007"))
+	assertKey(t, "00003", it.SeekGE(makeKey("00003"), base.SeekGEFlagsNone))
+	clone := it.Clone()
+	assertKey(t, "00003", &it.key)
+	assertKey(t, "00003", &clone.key)
+
+	// Advancing the clone does not move the original.
+	assertKey(t, "00004", clone.Next())
+	assertKey(t, "00005", clone.Next())
+	assertKey(t, "00004", it.Next())
+
+	// The clone retains the upper bound of the original.
+	assertKey(t, "00006", clone.Next())
+	require.Nil(t, clone.Next())
+	assertKey(t, "00005", it.Next())
+}
+
+func TestIteratorInit(t *testing.T) {
+	newList := func(prefix string) *Skiplist {
+		d := &testStorage{}
+		l := newTestSkiplist(d)
+		for i := 1; i < 10; i++ {
+			require.NoError(t, l.Add(d.add(fmt.Sprintf("%s%05d", prefix, i))))
+		}
+		return l
+	}
+	a, b := newList("a"), newList("b")
+
+	// Exhaust an iterator over a with bounds, so that it has noted the node
+	// beyond its upper bound.
+	it := a.NewIter(makeKey("a00003"), makeKey("a00005"))
+	it.SetSkipDuplicateAbbreviatedKeys(true)
+	assertKey(t, "a00003", it.SeekGE(makeKey("a00003"), base.SeekGEFlagsNone))
+	assertKey(t, "a00004", it.Next())
+	require.Nil(t, it.Next())
+	require.Nil(t, it.SeekGE(makeKey("a00006"), base.SeekGEFlagsNone.EnableTrySeekUsingNext()))
+
+	// After Init, the iterator reflects b without any of the bounds or state of
+	// the previous binding.
+	it.Init(b)
+	require.Nil(t, it.lower)
+	require.Nil(t, it.upper)
+	require.False(t, it.skipDuplicateAbbreviatedKeys)
+	var keys []string
+	for k := it.First(); k != nil; k = it.Next() {
+		keys = append(keys, string(k.UserKey))
+	}
+	require.Len(t, keys, 9)
+	require.Equal(t, "b00001", keys[0])
+	require.Equal(t, "b00009", keys[8])
+	assertKey(t, "b00005", it.SeekGE(makeKey("b00005"), base.SeekGEFlagsNone))
+	assertKey(t, "b00006", it.SeekGE(makeKey("b00006"), base.SeekGEFlagsNone.EnableTrySeekUsingNext()))
+	assertKey(t, "b00009", it.Last())
+
+	// Rebinding does not allocate.
+	require.Equal(t, float64(0), testing.AllocsPerRun(10, func() {
+		it.Init(a)
+		it.First()
+		it.Init(b)
+		it.Last()
+	}))
+}
+
+func TestIteratorSnapshot(t *testing.T) {
+	seed := uint64(time.Now().UnixNano())
+	t.Logf("seed: %d", seed)
+	rng := rand.New(rand.NewSource(seed))
+
+	d := &testStorage{}
+	l := newTestSkiplist(d)
+	// ref indexes only the records added before the snapshot is taken.
+	ref := newTestSkiplist(d)
+	randKey := func() string { return fmt.Sprintf("%04d", rng.Intn(200)) }
+	for i := 0; i < 100; i++ {
+		offset := d.add(randKey())
+		require.NoError(t, l.Add(offset))
+		require.NoError(t, ref.Add(offset))
+	}
+
+	lower, upper := makeKey("0050"), makeKey("0150")
+	snap := l.NewSnapshotIter(nil, nil)
+	boundedSnap := l.NewSnapshotIter(lower, upper)
+	// Records added after the snapshot, including records for user keys that
+	// were already present, are linked in among the snapshot's nodes.
+	for i := 0; i < 300; i++ {
+		require.NoError(t, l.Add(d.add(randKey())))
+	}
+	require.Equal(t, 400, length(l))
+
+	collect := func(it *Iterator) (fwd, rev []uint32) {
+		for k := it.First(); k != nil; k = it.Next() {
+			offset, _, _ := it.KeyInfo()
+			fwd = append(fwd, offset)
+		}
+		for k := it.Last(); k != nil; k = it.Prev() {
+			offset, _, _ := it.KeyInfo()
+			rev = append([]uint32{offset}, rev...)
+		}
+		return fwd, rev
+	}
+	refIt := ref.NewIter(nil, nil)
+	expected, _ := collect(&refIt)
+	fwd, rev := collect(&snap)
+	require.Equal(t, expected, fwd)
+	require.Equal(t, expected, rev)
+	// A fresh iterator sees every record.
+	it := l.NewIter(nil, nil)
+	all, _ := collect(&it)
+	require.Len(t, all, 400)
+
+	offsetOf := func(it *Iterator, k *base.InternalKey) int {
+		if k == nil {
+			return -1
+		}
+		offset, _, _ := it.KeyInfo()
+		return int(offset)
+	}
+	// positionOf is offsetOf for the current position, which is a sentinel if
+	// SeekGEWithMatch found no key >= the seek key.
+	positionOf := func(it *Iterator) int {
+		if it.list.isSentinel(it.nd) {
+			return -1
+		}
+		return offsetOf(it, &it.key)
+	}
+	boundedRef := ref.NewIter(lower, upper)
+	for i := 0; i < 200; i++ {
+		key := makeKey(randKey())
+		require.Equal(t, offsetOf(&refIt, refIt.SeekGE(key, base.SeekGEFlagsNone)),
+			offsetOf(&snap, snap.SeekGE(key, base.SeekGEFlagsNone)), "%s", key)
+		require.Equal(t, offsetOf(&refIt, refIt.Next()), offsetOf(&snap, snap.Next()))
+		require.Equal(t, offsetOf(&refIt, refIt.SeekLT(key)), offsetOf(&snap, snap.SeekLT(key)), "%s", key)
+		require.Equal(t, offsetOf(&refIt, refIt.Prev()), offsetOf(&snap, snap.Prev()))
+		require.Equal(t, refIt.SeekGEWithMatch(key), snap.SeekGEWithMatch(key), "%s", key)
+		require.Equal(t, positionOf(&refIt), positionOf(&snap))
+		require.Equal(t, offsetOf(&refIt, refIt.SeekGEAbbreviatedKey(base.DefaultComparer.AbbreviatedKey(key))),
+			offsetOf(&snap, snap.SeekGEAbbreviatedKey(base.DefaultComparer.AbbreviatedKey(key))))
+
+		if base.DefaultComparer.Compare(key, lower) >= 0 {
+			require.Equal(t, offsetOf(&boundedRef, boundedRef.SeekGE(key, base.SeekGEFlagsNone)),
+				offsetOf(&boundedSnap, boundedSnap.SeekGE(key, base.SeekGEFlagsNone)))
+			for j := 0; j < 5; j++ {
+				require.Equal(t, offsetOf(&boundedRef, boundedRef.Next()),
+					offsetOf(&boundedSnap, boundedSnap.Next()))
+			}
+		}
+	}
+}
+
+func TestIteratorPeek(t *testing.T) {
+	d := &testStorage{}
+	l := newTestSkiplist(d)
+	it := l.NewIter(nil, nil)
+	_, ok := it.PeekNext()
+	require.False(t, ok)
+	_, ok = it.PeekPrev()
+	require.False(t, ok)
+
+	var offsets []uint32
+	for i := 0; i < 5; i++ {
+		offset := d.add(fmt.Sprintf("%05d", i))
+		offsets = append(offsets, offset)
+		require.NoError(t, l.Add(offset))
+	}
+	position := func() uint32 {
+		offset, _, _ := it.KeyInfo()
+		return offset
+	}
+
+	// Before the first record.
+	it = l.NewIter(nil, nil)
+	offset, ok := it.PeekNext()
+	require.True(t, ok)
+	require.Equal(t, offsets[0], offset)
+	_, ok = it.PeekPrev()
+	require.False(t, ok)
+
+	for i, k := 0, it.First(); k != nil; i, k = i+1, it.Next() {
+		offset, ok := it.PeekNext()
+		require.Equal(t, i < 4, ok)
+		if ok {
+			require.Equal(t, offsets[i+1], offset)
+		}
+		offset, ok = it.PeekPrev()
+		require.Equal(t, i > 0, ok)
+		if ok {
+			require.Equal(t, offsets[i-1], offset)
+		}
+		// Peeking does not move the iterator.
+		require.Equal(t, offsets[i], position())
+		assertKey(t, fmt.Sprintf("%05d", i), &it.key)
+	}
+
+	// After the last record.
+	require.True(t, it.AtEnd())
+	_, ok = it.PeekNext()
+	require.False(t, ok)
+	offset, ok = it.PeekPrev()
+	require.True(t, ok)
+	require.Equal(t, offsets[4], offset)
+	require.True(t, it.AtEnd())
+
+	// Bounds are not checked.
+	it = l.NewIter(makeKey("00001"), makeKey("00002"))
+	assertKey(t, "00001", it.SeekGE(makeKey("00001"), base.SeekGEFlagsNone))
+	offset, ok = it.PeekNext()
+	require.True(t, ok)
+	require.Equal(t, offsets[2], offset)
+	offset, ok = it.PeekPrev()
+	require.True(t, ok)
+	require.Equal(t, offsets[0], offset)
+
+	// A snapshot iterator only peeks at records visible to it.
+	snap := l.NewSnapshotIter(nil, nil)
+	require.NoError(t, l.Add(d.add("00001a")))
+	assertKey(t, "00001", snap.SeekGE(makeKey("00001"), base.SeekGEFlagsNone))
+	offset, ok = snap.PeekNext()
+	require.True(t, ok)
+	require.Equal(t, offsets[2], offset)
+	assertKey(t, "00002", snap.Next())
+	offset, ok = snap.PeekPrev()
+	require.True(t, ok)
+	require.Equal(t, offsets[1], offset)
+}
+
+func TestIteratorSetNode(t *testing.T) {
+	d := &testStorage{}
+	l := newTestSkiplist(d)
+	var nodes []uint32
+	for i := 0; i < 100; i++ {
+		nd, err := l.AddNode(d.add(fmt.Sprintf("%05d", i)))
+		require.NoError(t, err)
+		nodes = append(nodes, nd)
+	}
+
+	it := l.NewIter(nil, nil)
+	for i := 0; i < 100; i += 7 {
+		assertKey(t, fmt.Sprintf("%05d", i), it.SetNode(nodes[i]))
+		if i < 99 {
+			assertKey(t, fmt.Sprintf("%05d", i+1), it.Next())
+		} else {
+			require.Nil(t, it.Next())
+		}
+		assertKey(t, fmt.Sprintf("%05d", i), it.SetNode(nodes[i]))
+		if i > 0 {
+			assertKey(t, fmt.Sprintf("%05d", i-1), it.Prev())
+		} else {
+			require.Nil(t, it.Prev())
+		}
+	}
+
+	// Node offsets remain valid as the skiplist grows, and Next respects the
+	// upper bound.
+	nd, err := l.AddNode(d.add("00050a"))
+	require.NoError(t, err)
+	it = l.NewIter(nil, makeKey("00051"))
+	assertKey(t, "00050", it.SetNode(nodes[50]))
+	assertKey(t, "00050a", it.Next())
+	require.Nil(t, it.Next())
+	assertKey(t, "00050a", it.SetNode(nd))
+	assertKey(t, "00050", it.Prev())
+
+	if invariants.Enabled {
+		// Offsets of the sentinels, of nodes that have been unlinked and of nodes
+		// invisible to a snapshot are rejected.
+		snap := l.NewSnapshotIter(nil, nil)
+		nd, err := l.AddNode(d.add("00050b"))
+		require.NoError(t, err)
+		require.Panics(t, func() { snap.SetNode(nd) })
+		require.Panics(t, func() { it.SetNode(l.tail) })
+		require.True(t, l.DeleteByOffset(l.node(nodes[10]).offset))
+		require.Panics(t, func() { it.SetNode(nodes[10]) })
+	}
+}
+
+// TestIteratorInitialBounds verifies that the bounds passed to NewIter are
+// respected by the first positioning of the iterator without any call to
+// SetBounds.
+func TestIteratorInitialBounds(t *testing.T) {
+	d := &testStorage{}
+	l := newTestSkiplist(d)
+	for i := 1; i < 10; i++ {
+		require.NoError(t, l.Add(d.add(fmt.Sprintf("%05d", i))))
+	}
+
+	// First only checks the upper bound. It is up to the caller to seek to the
+	// lower bound.
+	it := l.NewIter(makeKey("00003"), makeKey("00005"))
+	assertKey(t, "00001", it.First())
+	it = l.NewIter(nil, makeKey("00003"))
+	assertKey(t, "00001", it.First())
+	assertKey(t, "00002", it.Next())
+	require.Nil(t, it.Next())
+	it = l.NewIter(nil, makeKey("00001"))
+	require.Nil(t, it.First())
+
+	// Last only checks the lower bound. It is up to the caller to seek to the
+	// upper bound.
+	it = l.NewIter(makeKey("00003"), makeKey("00005"))
+	assertKey(t, "00009", it.Last())
+	it = l.NewIter(makeKey("00008"), nil)
+	assertKey(t, "00009", it.Last())
+	assertKey(t, "00008", it.Prev())
+	require.Nil(t, it.Prev())
+	it = l.NewIter(makeKey("00010"), nil)
+	require.Nil(t, it.Last())
+}
+
+func TestIteratorSkipDuplicateAbbreviatedKeys(t *testing.T) {
+	d := &testStorage{}
+	l := newTestSkiplist(d)
+	// The default comparer abbreviates keys to their first 8 bytes, so each of
+	// the groups below shares an abbreviated key.
+	for _, k := range []string{
+		"aaaaaaaa1", "aaaaaaaa2", "aaaaaaaa3",
+		"bbbbbbbb",
+		"cccccccc1", "cccccccc2",
+		"dddddddd1", "dddddddd2", "dddddddd3",
+	} {
+		require.NoError(t, l.Add(d.add(k)))
+	}
+
+	it := l.NewIter(nil, nil)
+	it.SetSkipDuplicateAbbreviatedKeys(true)
+	// Forward iteration surfaces the first key of each group.
+	assertKey(t, "aaaaaaaa1", it.First())
+	assertKey(t, "bbbbbbbb", it.Next())
+	assertKey(t, "cccccccc1", it.Next())
+	assertKey(t, "dddddddd1", it.Next())
+	require.Nil(t, it.Next())
+	// Backward iteration surfaces the last key of each group.
+	assertKey(t, "dddddddd3", it.Last())
+	assertKey(t, "cccccccc2", it.Prev())
+	assertKey(t, "bbbbbbbb", it.Prev())
+	assertKey(t, "aaaaaaaa3", it.Prev())
+	require.Nil(t, it.Prev())
+
+	// Seeks are unaffected, but the following movement skips the rest of the
+	// group.
+	assertKey(t, "aaaaaaaa2", it.SeekGE(makeKey("aaaaaaaa2"), base.SeekGEFlagsNone))
+	assertKey(t, "bbbbbbbb", it.Next())
+	assertKey(t, "aaaaaaaa3", it.Prev())
+
+	// Toggling the mode takes effect from the next movement.
+	it.SetSkipDuplicateAbbreviatedKeys(false)
+	assertKey(t, "aaaaaaaa2", it.Prev())
+	assertKey(t, "aaaaaaaa3", it.Next())
+	assertKey(t, "bbbbbbbb", it.Next())
+	assertKey(t, "cccccccc1", it.Next())
+	it.SetSkipDuplicateAbbreviatedKeys(true)
+	assertKey(t, "dddddddd1", it.Next())
+	it.SetSkipDuplicateAbbreviatedKeys(false)
+	assertKey(t, "dddddddd2", it.Next())
+}
+
+func TestIteratorSkipAbbreviatedKeyGroup(t *testing.T) {
+	d := &testStorage{}
+	l := newTestSkiplist(d)
+	// Fixed-width 8 byte integer keys are their own abbreviated keys. Each key
+	// has several records.
+	var buf [8]byte
+	var skipped []uint32
+	for i := 0; i < 100; i++ {
+		binary.BigEndian.PutUint64(buf[:], uint64(i*i))
+		for j := 0; j <= i%3; j++ {
+			if j < i%3 {
+				// The newest record of a key comes first in the skiplist, so the
+				// records added before it are skipped.
+				skipped = append(skipped, uint32(len(d.data)))
+			}
+			require.NoError(t, l.Add(d.addBytes(buf[:])))
+		}
+	}
+	// The upper bound is respected, and Next is unaffected.
+	var upper [8]byte
+	binary.BigEndian.PutUint64(upper[:], 2*2)
+	it := l.NewIter(nil, upper[:])
+	binary.BigEndian.PutUint64(buf[:], 1)
+	k := it.SeekGE(buf[:], base.SeekGEFlagsNone)
+	require.Equal(t, uint64(1), binary.BigEndian.Uint64(k.UserKey))
+	k = it.Next()
+	require.Equal(t, uint64(1), binary.BigEndian.Uint64(k.UserKey))
+	require.Nil(t, it.SkipAbbreviatedKeyGroup())
+
+	// The keys of the records that are skipped are never retrieved, so
+	// clobbering them in the storage has no effect.
+	for _, offset := range skipped {
+		copy(d.data[offset+2:offset+10], "garbage!")
+	}
+
+	it = l.NewIter(nil, nil)
+	i := 0
+	for k := it.First(); k != nil; k = it.SkipAbbreviatedKeyGroup() {
+		require.Equal(t, uint64(i*i), binary.BigEndian.Uint64(k.UserKey))
+		i++
+	}
+	require.Equal(t, 100, i)
+	require.True(t, it.AtEnd())
+
+	// Distinct keys sharing an abbreviated key are skipped as well.
+	d = &testStorage{}
+	l = newTestSkiplist(d)
+	for _, k := range []string{"aaaaaaaa1", "aaaaaaaa2", "b"} {
+		require.NoError(t, l.Add(d.add(k)))
+	}
+	it = l.NewIter(nil, nil)
+	assertKey(t, "aaaaaaaa1", it.First())
+	assertKey(t, "b", it.SkipAbbreviatedKeyGroup())
+}
+
+func TestIteratorStableKeys(t *testing.T) {
+	d := &testStorage{}
+	l := newTestSkiplist(d)
+	require.NoError(t, l.Add(d.add("a")))
+	it := l.NewIter(nil, nil)
+	require.False(t, it.StableKeys())
+	// Keys returned from a skiplist without stable storage alias the storage and
+	// observe modifications to it.
+	k := it.First()
+	assertKey(t, "a", k)
+	d.data[len(d.data)-1] = 'b'
+	require.Equal(t, "b", string(k.UserKey))
+
+	stable := NewSkiplist(&d.data, base.DefaultComparer.Compare,
+		base.DefaultComparer.AbbreviatedKey, WithStableStorage())
+	require.NoError(t, stable.Add(d.add("c")))
+	it = stable.NewIter(nil, nil)
+	require.True(t, it.StableKeys())
+	k = it.First()
+	assertKey(t, "c", k)
+	// Appending to the storage, even if it is reallocated, does not invalidate
+	// keys retained from a stable storage.
+	key := k.UserKey
+	for i := 0; i < 1000; i++ {
+		d.add(fmt.Sprintf("%05d", i))
+	}
+	require.Equal(t, "c", string(key))
+}
+
+func TestIteratorAtStartAtEnd(t *testing.T) {
+	d := &testStorage{}
+	l := newTestSkiplist(d)
+	it := l.NewIter(nil, nil)
+	require.True(t, it.AtStart())
+	require.False(t, it.AtEnd())
+	require.Nil(t, it.First())
+	require.True(t, it.AtEnd())
+	require.Nil(t, it.Last())
+	require.True(t, it.AtStart())
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, l.Add(d.add(fmt.Sprintf("%05d", i))))
+	}
+	it = l.NewIter(nil, nil)
+	for k := it.First(); k != nil; k = it.Prev() {
+		require.False(t, it.AtStart())
+		require.False(t, it.AtEnd())
+	}
+	require.True(t, it.AtStart())
+	require.False(t, it.AtEnd())
+
+	for k := it.Last(); k != nil; k = it.Next() {
+		require.False(t, it.AtStart())
+		require.False(t, it.AtEnd())
+	}
+	require.False(t, it.AtStart())
+	require.True(t, it.AtEnd())
+
+	require.Nil(t, it.SeekGE(makeKey("99999"), base.SeekGEFlagsNone))
+	require.True(t, it.AtEnd())
+	require.Nil(t, it.SeekLT(makeKey("")))
+	require.True(t, it.AtStart())
+
+	// Stopping at a bound does not run off the skiplist.
+	it = l.NewIter(makeKey("00003"), makeKey("00007"))
+	require.Nil(t, it.SeekGE(makeKey("00007"), base.SeekGEFlagsNone))
+	require.False(t, it.AtEnd())
+	require.Nil(t, it.SeekLT(makeKey("00003")))
+	require.False(t, it.AtStart())
+}
+
+func TestMergingIterator(t *testing.T) {
+	d := &testStorage{}
+	lists := []*Skiplist{newTestSkiplist(d), newTestSkiplist(d), newTestSkiplist(d), newTestSkiplist(d)}
+	// The first three skiplists index overlapping ranges of keys, with some
+	// records indexed by several skiplists and some user keys with several
+	// records. The last skiplist is empty.
+	var all []uint32
+	indexed := make(map[uint32]int)
+	for i := 0; i < 300; i++ {
+		offset := d.add(fmt.Sprintf("%05d", i%150))
+		for j, l := range lists[:3] {
+			if i/100 == j || (i%7 == 0 && (i/100+1)%3 == j) {
+				require.NoError(t, l.Add(offset))
+				indexed[offset]++
+			}
+		}
+		all = append(all, offset)
+	}
+	// The expected order is that of a skiplist indexing every record.
+	merged := newTestSkiplist(d)
+	for _, offset := range all {
+		require.NoError(t, merged.Add(offset))
+	}
+	var want, wantCollapsed []uint32
+	it := merged.NewIter(nil, nil)
+	for k := it.First(); k != nil; k = it.Next() {
+		offset, _, _ := it.KeyInfo()
+		wantCollapsed = append(wantCollapsed, offset)
+		for i := 0; i < indexed[offset]; i++ {
+			want = append(want, offset)
+		}
+	}
+
+	m, err := NewMergingIterator(lists...)
+	require.NoError(t, err)
+	collect := func(k *base.InternalKey) []uint32 {
+		var res []uint32
+		for ; k != nil; k = m.Next() {
+			offset, _, _ := m.KeyInfo()
+			require.Equal(t, d.data[offset+2:offset+7], k.UserKey)
+			res = append(res, offset)
+		}
+		// Exhausted iterators remain exhausted.
+		require.Nil(t, m.Next())
+		return res
+	}
+	require.Equal(t, want, collect(m.First()))
+	m.SetCollapseDuplicates(true)
+	require.Equal(t, wantCollapsed, collect(m.First()))
+	// Seeking positions every skiplist, including those whose records all
+	// precede the key and so are exhausted immediately.
+	got := collect(m.SeekGE(makeKey("00120")))
+	i := slices.IndexFunc(wantCollapsed, func(offset uint32) bool {
+		return string(d.data[offset+2:offset+7]) == "00120"
+	})
+	require.Equal(t, wantCollapsed[i:], got)
+	require.Nil(t, m.SeekGE(makeKey("00150")))
+
+	// Merging no skiplists, or only empty ones, yields nothing.
+	m, err = NewMergingIterator()
+	require.NoError(t, err)
+	require.Nil(t, m.First())
+	m, err = NewMergingIterator(lists[3])
+	require.NoError(t, err)
+	require.Nil(t, m.First())
+
+	_, err = NewMergingIterator(lists[0], newTestSkiplist(&testStorage{}))
+	require.Error(t, err)
+	_, err = NewMergingIterator(lists[0], NewSkiplist(&d.data, base.DefaultComparer.Compare,
+		base.DefaultComparer.AbbreviatedKey, WithSequenceTags()))
+	require.Error(t, err)
+}
+
+func TestNewBoundedIterator(t *testing.T) {
+	d := &testStorage{}
+	l := newTestSkiplist(d)
+	for i := 1; i < 10; i++ {
+		require.NoError(t, l.Add(d.add(fmt.Sprintf("%05d", i))))
+	}
+
+	// The iterator is unpositioned until the first First.
+	it := l.NewBoundedIterator(makeKey("00003"), makeKey("00005"))
+	require.True(t, it.AtStart())
+	require.False(t, it.AtEnd())
+	assertKey(t, "00001", it.First())
+	assertKey(t, "00002", it.Next())
+	assertKey(t, "00003", it.Next())
+	assertKey(t, "00004", it.Next())
+	require.Nil(t, it.Next())
+	require.False(t, it.AtEnd())
+
+	// Seeking to the lower bound is up to the caller.
+	it = l.NewBoundedIterator(makeKey("00003"), makeKey("00005"))
+	assertKey(t, "00003", it.SeekGE(makeKey("00003"), base.SeekGEFlagsNone))
+	assertKey(t, "00004", it.Next())
+	require.Nil(t, it.Next())
+
+	it = l.NewBoundedIterator(nil, makeKey("00001"))
+	require.True(t, it.AtStart())
+	require.Nil(t, it.First())
+	require.Nil(t, it.Next())
+
+	// The bounds are the same as those of an iterator returned by NewIter
+	// and constrained by SetBounds.
+	it = l.NewBoundedIterator(makeKey("00003"), makeKey("00005"))
+	it2 := l.NewIter(nil, nil)
+	it2.SetBounds(makeKey("00003"), makeKey("00005"))
+	require.Equal(t, it2, it)
+}
+
 func randomKey(rng *rand.Rand, b []byte) []byte {
 	key := rng.Uint32()
 	key2 := rng.Uint32()
@@ -365,6 +3143,109 @@ func BenchmarkOrderedWrite(b *testing.B) {
 	}
 }
 
+// BenchmarkClusteredWrite adds keys which are clustered near the previously
+// added key, but which mostly descend and so miss the fast path of Add for
+// in-order insertion.
+func BenchmarkClusteredWrite(b *testing.B) {
+	for _, withSplice := range []bool{false, true} {
+		b.Run(fmt.Sprintf("splice=%t", withSplice), func(b *testing.B) {
+			var buf [8]byte
+			d := &testStorage{
+				data: make([]byte, 0, b.N*10),
+			}
+			l := newTestSkiplist(d)
+			rng := rand.New(rand.NewSource(uint64(time.Now().UnixNano())))
+			var sp Splice
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				binary.BigEndian.PutUint64(buf[:], uint64((b.N-i)*16+rng.Intn(64)))
+				offset := d.addBytes(buf[:])
+				if withSplice {
+					_ = l.AddWithSplice(offset, &sp)
+				} else {
+					_ = l.Add(offset)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkBuildSkiplist(b *testing.B) {
+	const n = 100000
+	d := &testStorage{}
+	var buf [8]byte
+	offsets := make([]uint32, n)
+	for i := range offsets {
+		binary.BigEndian.PutUint64(buf[:], uint64(i))
+		offsets[i] = d.addBytes(buf[:])
+	}
+
+	b.Run("build", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, _ = BuildSkiplist(&d.data, base.DefaultComparer.Compare,
+				base.DefaultComparer.AbbreviatedKey, offsets)
+		}
+	})
+	b.Run("add", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			l := newTestSkiplist(d)
+			for _, offset := range offsets {
+				_ = l.Add(offset)
+			}
+		}
+	})
+}
+
+func BenchmarkMultiGet(b *testing.B) {
+	const n = 1000
+	d := &testStorage{}
+	l := newTestSkiplist(d)
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = makeKey(fmt.Sprintf("%08d", i))
+	}
+	for i := 0; i < 100*n; i++ {
+		require.NoError(b, l.Add(d.add(fmt.Sprintf("%08d", i))))
+	}
+
+	b.Run("MultiGet", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_ = l.MultiGet(keys)
+		}
+	})
+	b.Run("SeekGE", func(b *testing.B) {
+		it := l.NewIter(nil, nil)
+		for i := 0; i < b.N; i++ {
+			for _, k := range keys {
+				_ = it.SeekGE(k, base.SeekGEFlagsNone)
+			}
+		}
+	})
+}
+
+func BenchmarkGrow(b *testing.B) {
+	const n = 100000
+	d := &testStorage{}
+	var offsets []uint32
+	for i := 0; i < n; i++ {
+		offsets = append(offsets, d.add(fmt.Sprintf("%08d", i)))
+	}
+	for _, grow := range []bool{false, true} {
+		b.Run(fmt.Sprintf("grow=%t", grow), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				l := newTestSkiplist(d)
+				if grow {
+					l.Grow(n)
+				}
+				for _, offset := range offsets {
+					_ = l.Add(offset)
+				}
+			}
+		})
+	}
+}
+
 func BenchmarkIterNext(b *testing.B) {
 	var buf [8]byte
 	d := &testStorage{
@@ -98,6 +98,20 @@ type IteratorMetrics struct {
 	ReadAmp int
 }
 
+// ReadTrace records the blocks read, and so the sstables touched, by the
+// reads performed with a context returned by WithReadTrace.
+type ReadTrace = sstable.ReadTrace
+
+// BlockRead describes a block read recorded by a ReadTrace.
+type BlockRead = sstable.BlockRead
+
+// WithReadTrace returns a context that records into t the blocks read by
+// iterators created with it through NewIterWithContext. Tracing is opt-in and
+// per-iterator, and is intended for diagnosing individual slow reads.
+func WithReadTrace(ctx context.Context, t *ReadTrace) context.Context {
+	return sstable.WithReadTrace(ctx, t)
+}
+
 // IteratorStatsKind describes the two kind of iterator stats.
 type IteratorStatsKind int8
 
@@ -240,6 +254,10 @@ type Iterator struct {
 	readSampling        readSampling
 	stats               IteratorStats
 	externalReaders     [][]*sstable.Reader
+	// onBounds, if non-nil, is called with the iterator's new bounds whenever
+	// they change. A Transaction uses it to record the key spans its
+	// iterators may read.
+	onBounds func(lower, upper []byte)
 
 	// Following fields used when constructing an iterator stack, eg, in Clone
 	// and SetOptions or when re-fragmenting a batch's range keys/range dels.
@@ -2535,6 +2553,9 @@ func (i *Iterator) processBounds(lower, upper []byte) {
 	}
 	i.boundsBuf[i.boundsBufIdx] = buf
 	i.boundsBufIdx = 1 - i.boundsBufIdx
+	if i.onBounds != nil {
+		i.onBounds(i.opts.LowerBound, i.opts.UpperBound)
+	}
 }
 
 // SetOptions sets new iterator options for the iterator. Note that the lower
@@ -2865,6 +2886,7 @@ func (i *Iterator) CloneWithContext(ctx context.Context, opts CloneOptions) (*It
 		newIters:            i.newIters,
 		newIterRangeKey:     i.newIterRangeKey,
 		seqNum:              i.seqNum,
+		onBounds:            i.onBounds,
 	}
 	dbi.processBounds(dbi.opts.LowerBound, dbi.opts.UpperBound)
 
@@ -12,6 +12,7 @@ import (
 	"fmt"
 	"io"
 	"runtime"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -662,6 +663,66 @@ func (i *iterSeekOptWrapper) SeekPrefixGE(
 	return i.internalIterator.SeekPrefixGE(prefix, key, flags)
 }
 
+func TestIteratorReadTrace(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer d.Close()
+	for _, k := range []string{"a", "b"} {
+		require.NoError(t, d.Set([]byte(k), []byte(k), nil))
+		require.NoError(t, d.Flush())
+	}
+	tables, err := d.SSTables()
+	require.NoError(t, err)
+	var files []base.DiskFileNum
+	for _, info := range tables[0] {
+		files = append(files, info.BackingSSTNum)
+	}
+	slices.Sort(files)
+
+	scan := func() []BlockRead {
+		var trace ReadTrace
+		iter, err := d.NewIterWithContext(WithReadTrace(context.Background(), &trace), nil)
+		require.NoError(t, err)
+		for valid := iter.First(); valid; valid = iter.Next() {
+		}
+		require.NoError(t, iter.Close())
+		require.Equal(t, files, trace.Files())
+		return trace.Blocks()
+	}
+	// The first scan reads each table's blocks from storage, or finds those
+	// loaded when the tables were opened in the cache. The second scan finds
+	// all of them in the cache.
+	require.NotEmpty(t, scan())
+	for _, b := range scan() {
+		require.True(t, b.CacheHit)
+		require.Zero(t, b.Duration)
+	}
+
+	// An iterator records into the trace of the context it was created with,
+	// and not into one attached to any other context.
+	var trace, other ReadTrace
+	_ = WithReadTrace(context.Background(), &other)
+	iter, err := d.NewIterWithContext(WithReadTrace(context.Background(), &trace), nil)
+	require.NoError(t, err)
+	require.True(t, iter.First())
+	require.NoError(t, iter.Close())
+	require.Equal(t, files[:1], trace.Files())
+	require.Empty(t, other.Blocks())
+
+	// An iterator without a trace records nothing, until it is given a
+	// context with one.
+	iter, err = d.NewIter(nil)
+	require.NoError(t, err)
+	require.True(t, iter.First())
+	require.Equal(t, files[:1], trace.Files())
+	require.Empty(t, other.Blocks())
+	iter.SetContext(WithReadTrace(context.Background(), &other))
+	require.True(t, iter.SeekGE([]byte("b")))
+	require.NoError(t, iter.Close())
+	require.Equal(t, files[:1], trace.Files())
+	require.Equal(t, files[1:], other.Files())
+}
+
 func TestIteratorSeekOpt(t *testing.T) {
 	var d *DB
 	defer func() {
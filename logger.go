@@ -9,6 +9,10 @@ import "github.com/cockroachdb/pebble/internal/base"
 // Logger defines an interface for writing log messages.
 type Logger = base.Logger
 
+// StructuredLogger is a Logger that also accepts messages with structured
+// key-value fields. See MakeLoggingEventListener.
+type StructuredLogger = base.StructuredLogger
+
 // DefaultLogger logs to the Go stdlib logs.
 var DefaultLogger = base.DefaultLogger
 
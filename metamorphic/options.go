@@ -611,6 +611,9 @@ func RandomOptions(
 
 	opts.BytesPerSync = 1 << uint(rng.Intn(28))     // 1B - 256MB
 	opts.Cache = cache.New(1 << uint(rng.Intn(30))) // 1B - 1GB
+	if rng.Intn(2) == 0 {
+		opts.Checksum = pebble.ChecksumTypeXXHash64
+	}
 	opts.DisableWAL = rng.Intn(2) == 0
 	opts.FlushDelayDeleteRange = time.Millisecond * time.Duration(5*rng.Intn(245)) // 5-250ms
 	opts.FlushDelayRangeKey = time.Millisecond * time.Duration(5*rng.Intn(245))    // 5-250ms
@@ -733,6 +736,10 @@ func RandomOptions(
 		lopts.Compression = func() sstable.Compression { return pebble.NoCompression }
 	case 1:
 		lopts.Compression = func() sstable.Compression { return pebble.ZstdCompression }
+		// 50% of the time, compress with dictionaries.
+		if rng.Intn(2) == 0 {
+			lopts.CompressionDictSize = 1 << uint(8+rng.Intn(9)) // 256B - 64KB
+		}
 	default:
 		lopts.Compression = func() sstable.Compression { return pebble.SnappyCompression }
 	}
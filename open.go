@@ -358,6 +358,7 @@ func Open(dirname string, opts *Options) (db *DB, err error) {
 		BytesPerSync:         opts.WALBytesPerSync,
 		PreallocateSize:      d.walPreallocateSize,
 		MinSyncInterval:      opts.WALMinSyncInterval,
+		Compression:          d.walCompression,
 		FsyncLatency:         d.mu.log.metrics.fsyncLatency,
 		QueueSemChan:         d.commit.logSyncQSem,
 		Logger:               opts.Logger,
@@ -840,6 +841,12 @@ func (d *DB) replayWAL(
 		}
 	}()
 
+	skipInvalidRecord := func(err error) {
+		d.opts.Logger.Infof("pebble: skipping invalid record in WAL %s: %s",
+			errors.Safe(base.DiskFileNum(ll.Num)), err)
+		buf.Reset()
+	}
+
 	for {
 		r, offset, err := rr.NextRecord()
 		if err == nil {
@@ -853,15 +860,38 @@ func (d *DB) replayWAL(
 			// to otherwise treat them like EOF.
 			if err == io.EOF {
 				break
-			} else if record.IsInvalidRecord(err) && !strictWALTail {
+			} else if d.opts.WALRecoveryMode == WALRecoverySkipAnyCorruptedRecords {
+				// Zeroed space, as left by WAL preallocation, and a chunk written to
+				// a previous instance of a recycled WAL both mark the end of the
+				// WAL's contents, so there is nothing left to recover.
+				if errors.Is(err, record.ErrZeroedChunk) || errors.Is(err, record.ErrRecycledChunk) {
+					break
+				}
+				// A record too short to hold a batch header was read intact, so
+				// the reader is already positioned at the next record. Any other
+				// invalid record is skipped along with the rest of its block.
+				if errors.Is(err, wal.ErrShortRecord) || record.IsInvalidRecord(err) {
+					if record.IsInvalidRecord(err) {
+						rr.Recover()
+					}
+					skipInvalidRecord(err)
+					continue
+				}
+			} else if record.IsInvalidRecord(err) && !strictWALTail &&
+				walTailTolerated(d.opts.WALRecoveryMode, err) {
 				break
 			}
 			return nil, 0, errors.Wrap(err, "pebble: error when replaying WAL")
 		}
 
 		if buf.Len() < batchrepr.HeaderLen {
-			return nil, 0, base.CorruptionErrorf("pebble: corrupt wal %s (offset %s)",
+			err := base.CorruptionErrorf("pebble: corrupt wal %s (offset %s)",
 				errors.Safe(base.DiskFileNum(ll.Num)), offset)
+			if d.opts.WALRecoveryMode == WALRecoverySkipAnyCorruptedRecords {
+				skipInvalidRecord(err)
+				continue
+			}
+			return nil, 0, err
 		}
 
 		if d.opts.ErrorIfNotPristine {
@@ -1256,6 +1286,13 @@ var ErrDBAlreadyExists = errors.New("pebble: database already exists")
 // Note that errors can be wrapped with more details; use errors.Is().
 var ErrDBNotPristine = errors.New("pebble: database already exists and is not pristine")
 
+// walTailTolerated returns true if the invalid record err, encountered at the
+// tail of the most recent WAL, is treated as the end of the WAL under the given
+// recovery mode.
+func walTailTolerated(mode WALRecoveryMode, err error) bool {
+	return mode != WALRecoveryAbsoluteConsistency || errors.Is(err, record.ErrZeroedChunk)
+}
+
 // IsCorruptionError returns true if the given error indicates database
 // corruption.
 func IsCorruptionError(err error) bool {
@@ -1318,3 +1355,11 @@ func (l walEventListenerAdaptor) LogCreated(ci wal.CreateInfo) {
 	}
 	l.l.WALCreated(wci)
 }
+
+func (l walEventListenerAdaptor) LogSynced(si wal.SyncInfo) {
+	l.l.WALSynced(WALSyncInfo{
+		FileNum:  base.DiskFileNum(si.Num),
+		Duration: si.Duration,
+		Err:      si.Err,
+	})
+}
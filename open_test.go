@@ -30,14 +30,17 @@ import (
 	"github.com/cockroachdb/pebble/objstorage"
 	"github.com/cockroachdb/pebble/objstorage/objstorageprovider"
 	"github.com/cockroachdb/pebble/objstorage/remote"
+	"github.com/cockroachdb/pebble/record"
 	"github.com/cockroachdb/pebble/sstable"
 	"github.com/cockroachdb/pebble/vfs"
 	"github.com/cockroachdb/pebble/vfs/atomicfs"
+	"github.com/cockroachdb/pebble/vfs/encryptedfs"
 	"github.com/cockroachdb/pebble/vfs/errorfs"
 	"github.com/cockroachdb/pebble/wal"
 	"github.com/cockroachdb/redact"
 	"github.com/ghemawat/stream"
 	"github.com/kr/pretty"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/require"
 )
 
@@ -325,7 +328,7 @@ func TestNewDBFilenames(t *testing.T) {
 			"LOCK",
 			"MANIFEST-000001",
 			"OPTIONS-000003",
-			"marker.format-version.000004.017",
+			"marker.format-version.000006.019",
 			"marker.manifest.000001.MANIFEST-000001",
 		},
 	}
@@ -919,6 +922,414 @@ func TestTwoWALReplayCorrupt(t *testing.T) {
 	require.Error(t, err, "pebble: corruption")
 }
 
+// TestWALRecoveryMode tests the handling of an invalid record in the
+// middle of the most recent WAL by each WAL recovery mode.
+func TestWALRecoveryMode(t *testing.T) {
+	largeValue := bytes.Repeat([]byte("a"), 40<<10)
+	makeDB := func(t *testing.T, corrupt bool) *vfs.MemFS {
+		mem := vfs.NewMem()
+		d, err := Open("", &Options{FS: mem})
+		require.NoError(t, err)
+		// The record for a spans the first two 32KiB blocks of the WAL.
+		require.NoError(t, d.Set([]byte("a"), largeValue, nil))
+		require.NoError(t, d.Set([]byte("b"), []byte("b"), nil))
+		require.NoError(t, d.Set([]byte("c"), largeValue, nil))
+		require.NoError(t, d.Set([]byte("d"), []byte("d"), nil))
+		require.NoError(t, d.Close())
+		if !corrupt {
+			return mem
+		}
+
+		ls, err := mem.List("")
+		require.NoError(t, err)
+		var logs []string
+		for _, name := range ls {
+			if filepath.Ext(name) == ".log" {
+				logs = append(logs, name)
+			}
+		}
+		require.Len(t, logs, 1)
+		f, err := mem.Open(logs[0])
+		require.NoError(t, err)
+		data, err := io.ReadAll(f)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		// Corrupt the payload of the first chunk of the record for a.
+		data[100] ^= 0xff
+		f, err = mem.Create(logs[0], vfs.WriteCategoryUnspecified)
+		require.NoError(t, err)
+		_, err = f.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		return mem
+	}
+	keys := func(t *testing.T, d *DB) []string {
+		iter, err := d.NewIter(nil)
+		require.NoError(t, err)
+		keys := []string{}
+		for valid := iter.First(); valid; valid = iter.Next() {
+			keys = append(keys, string(iter.Key()))
+		}
+		require.NoError(t, iter.Close())
+		return keys
+	}
+
+	testCases := []struct {
+		mode WALRecoveryMode
+		// keys is nil if Open is expected to fail.
+		keys []string
+	}{
+		{mode: WALRecoveryTolerateCorruptedTailRecords, keys: []string{}},
+		{mode: WALRecoveryAbsoluteConsistency},
+		{mode: WALRecoverySkipAnyCorruptedRecords, keys: []string{"b", "c", "d"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.mode.String(), func(t *testing.T) {
+			// Every mode replays an intact WAL in its entirety.
+			d, err := Open("", &Options{FS: makeDB(t, false), WALRecoveryMode: tc.mode})
+			require.NoError(t, err)
+			require.Equal(t, []string{"a", "b", "c", "d"}, keys(t, d))
+			require.NoError(t, d.Close())
+
+			d, err = Open("", &Options{FS: makeDB(t, true), WALRecoveryMode: tc.mode})
+			if tc.keys == nil {
+				require.Error(t, err)
+				require.True(t, IsCorruptionError(err), "%v", err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.keys, keys(t, d))
+			require.NoError(t, d.Close())
+		})
+	}
+}
+
+// TestWALRecoverySkipAnyCorruptedRecords tests that
+// WALRecoverySkipAnyCorruptedRecords ends the replay of a WAL at zeroed space
+// or at a chunk from a previous instance of a recycled WAL without skipping
+// them as invalid records, and that it skips intact records too short to hold
+// a batch.
+func TestWALRecoverySkipAnyCorruptedRecords(t *testing.T) {
+	const blockSize = 32 << 10
+	mem := vfs.NewMem()
+	d, err := Open("", &Options{FS: mem})
+	require.NoError(t, err)
+	require.NoError(t, d.Set([]byte("a"), []byte("a"), nil))
+	require.NoError(t, d.Set([]byte("b"), []byte("b"), nil))
+	// The record for c spans the first two 32KiB blocks of the WAL.
+	require.NoError(t, d.Set([]byte("c"), bytes.Repeat([]byte("c"), 40<<10), nil))
+	require.NoError(t, d.Close())
+
+	ls, err := mem.List("")
+	require.NoError(t, err)
+	var logName string
+	for _, name := range ls {
+		if filepath.Ext(name) == ".log" {
+			logName = name
+		}
+	}
+	num, _, ok := wal.ParseLogFilename(logName)
+	require.True(t, ok)
+	logNum := base.DiskFileNum(num)
+	f, err := mem.Open(logName)
+	require.NoError(t, err)
+	var records [][]byte
+	rr := record.NewReader(f, logNum)
+	for {
+		r, err := rr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		rec, err := io.ReadAll(r)
+		require.NoError(t, err)
+		records = append(records, rec)
+	}
+	require.NoError(t, f.Close())
+	require.Len(t, records, 3)
+
+	// writeWAL encodes the given records as an instance of the WAL with the
+	// given log number.
+	writeWAL := func(logNum base.DiskFileNum, records ...[]byte) []byte {
+		var buf bytes.Buffer
+		w := record.NewLogWriter(&buf, logNum, record.LogWriterConfig{
+			WALFsyncLatency: prometheus.NewHistogram(prometheus.HistogramOpts{}),
+		})
+		for _, rec := range records {
+			_, err := w.WriteRecord(rec)
+			require.NoError(t, err)
+		}
+		require.NoError(t, w.Close())
+		return buf.Bytes()
+	}
+	open := func(t *testing.T, data []byte) (keys []string, log string) {
+		fs := vfs.NewMem()
+		for _, name := range ls {
+			require.NoError(t, vfs.CopyAcrossFS(mem, name, fs, name))
+		}
+		f, err := fs.Create(logName, vfs.WriteCategoryUnspecified)
+		require.NoError(t, err)
+		_, err = f.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+
+		logger := &base.InMemLogger{}
+		d, err := Open("", &Options{
+			FS:              fs,
+			Logger:          logger,
+			WALRecoveryMode: WALRecoverySkipAnyCorruptedRecords,
+		})
+		require.NoError(t, err)
+		iter, err := d.NewIter(nil)
+		require.NoError(t, err)
+		for valid := iter.First(); valid; valid = iter.Next() {
+			keys = append(keys, string(iter.Key()))
+		}
+		require.NoError(t, iter.Close())
+		require.NoError(t, d.Close())
+		return keys, logger.String()
+	}
+
+	t.Run("zeroed", func(t *testing.T) {
+		// Replace the EOF trailer with the zeroed space left by preallocation.
+		data := writeWAL(logNum, records[0], records[1])
+		data = append(data[:len(data)-11], make([]byte, 4*blockSize)...)
+		keys, log := open(t, data)
+		require.Equal(t, []string{"a", "b"}, keys)
+		require.NotContains(t, log, "skipping invalid record")
+	})
+	t.Run("recycled", func(t *testing.T) {
+		// Replace the second block with that of a previous instance of the WAL,
+		// as if the process crashed after writing the first block.
+		data := writeWAL(logNum, records...)
+		copy(data[blockSize:], writeWAL(logNum-1, records...)[blockSize:])
+		keys, log := open(t, data)
+		require.Equal(t, []string{"a", "b"}, keys)
+		require.NotContains(t, log, "skipping invalid record")
+	})
+	t.Run("short", func(t *testing.T) {
+		keys, log := open(t, writeWAL(logNum, records[0], []byte("short"), records[1], records[2]))
+		require.Equal(t, []string{"a", "b", "c"}, keys)
+		require.Equal(t, 1, strings.Count(log, "skipping invalid record"), "%s", log)
+	})
+}
+
+func TestWALCompression(t *testing.T) {
+	value := bytes.Repeat([]byte("compressible"), 1<<10)
+	for _, tc := range []struct {
+		compression Compression
+		vers        FormatMajorVersion
+		compressed  bool
+	}{
+		{compression: NoCompression, vers: FormatWALCompression},
+		{compression: SnappyCompression, vers: FormatWALCompression, compressed: true},
+		{compression: ZstdCompression, vers: FormatWALCompression, compressed: true},
+		// WALCompression is ignored before FormatWALCompression.
+		{compression: ZstdCompression, vers: FormatNewest},
+	} {
+		t.Run(fmt.Sprintf("%s/%s", tc.compression, tc.vers), func(t *testing.T) {
+			mem := vfs.NewMem()
+			opts := &Options{
+				FS:                 mem,
+				FormatMajorVersion: tc.vers,
+				WALCompression:     tc.compression,
+			}
+			d, err := Open("", opts)
+			require.NoError(t, err)
+			// The WAL of a new store is created before Open ratchets its format
+			// major version. Flush to switch to a WAL created at tc.vers.
+			require.NoError(t, d.Flush())
+			for i := 0; i < 10; i++ {
+				require.NoError(t, d.Set([]byte(fmt.Sprint(i)), value, nil))
+			}
+			require.NoError(t, d.Close())
+
+			ls, err := mem.List("")
+			require.NoError(t, err)
+			var logs []string
+			for _, name := range ls {
+				if filepath.Ext(name) == ".log" {
+					logs = append(logs, name)
+				}
+			}
+			// Older WALs may be retained for recycling. The newest holds the sets.
+			slices.Sort(logs)
+			stat, err := mem.Stat(logs[len(logs)-1])
+			require.NoError(t, err)
+			require.Equal(t, tc.compressed, stat.Size() < int64(len(value)), "WAL size %d", stat.Size())
+
+			// The compressed records are replayed by Open.
+			d, err = Open("", opts)
+			require.NoError(t, err)
+			for i := 0; i < 10; i++ {
+				verifyGet(t, d, []byte(fmt.Sprint(i)), value)
+			}
+			require.NoError(t, d.Close())
+		})
+	}
+}
+
+func TestSSTableChecksum(t *testing.T) {
+	mem := vfs.NewMem()
+	checksumNames := func(d *DB) map[string]bool {
+		tables, err := d.SSTables(WithProperties())
+		require.NoError(t, err)
+		names := make(map[string]bool)
+		for _, level := range tables {
+			for _, info := range level {
+				names[info.Properties.ChecksumName] = true
+			}
+		}
+		return names
+	}
+
+	// Write an sstable with each checksum, reopening the DB with the other
+	// checksum in between, and verify both sstables remain readable.
+	for i, checksum := range []ChecksumType{ChecksumTypeXXHash64, ChecksumTypeCRC32c} {
+		d, err := Open("", &Options{FS: mem, Checksum: checksum})
+		require.NoError(t, err)
+		require.NoError(t, d.Set([]byte(fmt.Sprint(i)), []byte("value"), nil))
+		require.NoError(t, d.Flush())
+		for j := 0; j <= i; j++ {
+			verifyGet(t, d, []byte(fmt.Sprint(j)), []byte("value"))
+		}
+		require.NoError(t, d.Close())
+	}
+
+	d, err := Open("", &Options{FS: mem})
+	require.NoError(t, err)
+	// CRC32c, the default, is not recorded in the sstable properties.
+	require.Equal(t, map[string]bool{"xxhash64": true, "": true}, checksumNames(d))
+	require.NoError(t, d.Compact([]byte("0"), []byte("2"), false /* parallelize */))
+	require.Equal(t, map[string]bool{"": true}, checksumNames(d))
+	verifyGet(t, d, []byte("0"), []byte("value"))
+	verifyGet(t, d, []byte("1"), []byte("value"))
+	require.NoError(t, d.Close())
+}
+
+func TestEncryptedFS(t *testing.T) {
+	mem := vfs.NewMem()
+	keys, err := encryptedfs.NewKeyRing(encryptedfs.Key{ID: "k1", Secret: bytes.Repeat([]byte{1}, 32)})
+	require.NoError(t, err)
+	opts := &Options{FS: encryptedfs.New(mem, keys)}
+	value := []byte("secret-value")
+
+	// Write to an sstable, then rotate the key and write to a WAL created
+	// after the rotation by reopening the DB.
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	require.NoError(t, d.Set([]byte("a"), value, nil))
+	require.NoError(t, d.Flush())
+	require.NoError(t, d.Close())
+	require.NoError(t, keys.Rotate(encryptedfs.Key{ID: "k2", Secret: bytes.Repeat([]byte{2}, 32)}))
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	require.NoError(t, d.Set([]byte("b"), value, nil))
+	require.NoError(t, d.Close())
+	ids, err := opts.FS.(*encryptedfs.FS).KeyIDs("")
+	require.NoError(t, err)
+	require.Contains(t, ids, "k1")
+	require.Contains(t, ids, "k2")
+
+	// No file holds the value in plaintext.
+	ls, err := mem.List("")
+	require.NoError(t, err)
+	for _, name := range ls {
+		f, err := mem.Open(name)
+		require.NoError(t, err)
+		data, err := io.ReadAll(f)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		require.False(t, bytes.Contains(data, value), "%s holds the value in plaintext", name)
+	}
+
+	// The sstable written under the old key, and the WAL written under the
+	// new one, are both readable.
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	verifyGet(t, d, []byte("a"), value)
+	verifyGet(t, d, []byte("b"), value)
+	require.NoError(t, d.Close())
+}
+
+// zeroPreallocFS is a vfs.FS whose files are preallocated by durably
+// extending them with zeros, as on filesystems that cannot preallocate without
+// changing a file's size.
+type zeroPreallocFS struct {
+	vfs.FS
+}
+
+func (fs zeroPreallocFS) Create(name string, category vfs.DiskWriteCategory) (vfs.File, error) {
+	f, err := fs.FS.Create(name, category)
+	if err != nil {
+		return nil, err
+	}
+	return zeroPreallocFile{f}, nil
+}
+
+type zeroPreallocFile struct {
+	vfs.File
+}
+
+// Fd returns a valid file descriptor, as files without one are not
+// preallocated.
+func (f zeroPreallocFile) Fd() uintptr {
+	return 0
+}
+
+func (f zeroPreallocFile) Preallocate(offset, length int64) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	end := offset + length
+	if size := info.Size(); end > size {
+		offset = max(offset, size)
+		if _, err = f.WriteAt(make([]byte, end-offset), offset); err == nil {
+			// The preallocated extent survives a crash.
+			err = f.Sync()
+		}
+	}
+	return err
+}
+
+// TestEncryptedFSCrashRecovery tests that WALs written through an encryptedfs
+// are recovered with WALRecoveryAbsoluteConsistency after a crash, even when
+// the WALs are recycled and the underlying filesystem would preallocate them
+// by extending them with zeros.
+func TestEncryptedFSCrashRecovery(t *testing.T) {
+	mem := vfs.NewStrictMem()
+	keys, err := encryptedfs.NewKeyRing(encryptedfs.Key{ID: "k1", Secret: bytes.Repeat([]byte{1}, 32)})
+	require.NoError(t, err)
+	opts := &Options{
+		FS:              encryptedfs.New(zeroPreallocFS{mem}, keys),
+		WALRecoveryMode: WALRecoveryAbsoluteConsistency,
+	}
+
+	d, err := Open("", opts)
+	require.NoError(t, err)
+	// Recycle a WAL, and write twice to the last WAL, since a WAL is first
+	// preallocated on its second write.
+	userKeys := []string{"a", "b", "c", "d"}
+	for i, k := range userKeys {
+		require.NoError(t, d.Set([]byte(k), []byte(k), Sync))
+		if i < 2 {
+			require.NoError(t, d.Flush())
+		}
+	}
+	mem.SetIgnoreSyncs(true)
+	require.NoError(t, d.Close())
+	mem.ResetToSyncedState()
+	mem.SetIgnoreSyncs(false)
+
+	d, err = Open("", opts)
+	require.NoError(t, err)
+	for _, k := range userKeys {
+		verifyGet(t, d, []byte(k), []byte(k))
+	}
+	require.NoError(t, d.Close())
+}
+
 // TestCrashOpenCrashAfterWALCreation tests a database that exits
 // ungracefully, begins recovery, creates the new WAL but promptly exits
 // ungracefully again.
@@ -25,6 +25,7 @@ import (
 	"github.com/cockroachdb/pebble/objstorage/remote"
 	"github.com/cockroachdb/pebble/rangekey"
 	"github.com/cockroachdb/pebble/sstable"
+	"github.com/cockroachdb/pebble/sstable/block"
 	"github.com/cockroachdb/pebble/vfs"
 	"github.com/cockroachdb/pebble/wal"
 )
@@ -45,6 +46,15 @@ const (
 	ZstdCompression    = sstable.ZstdCompression
 )
 
+// ChecksumType exports the block.ChecksumType type.
+type ChecksumType = block.ChecksumType
+
+// Exported ChecksumType constants.
+const (
+	ChecksumTypeCRC32c   = block.ChecksumTypeCRC32c
+	ChecksumTypeXXHash64 = block.ChecksumTypeXXHash64
+)
+
 // FilterType exports the base.FilterType type.
 type FilterType = base.FilterType
 
@@ -406,6 +416,25 @@ type LevelOptions struct {
 	// The default value (DefaultCompression) uses snappy compression.
 	Compression func() Compression
 
+	// ZstdLevel is the Zstandard compression level, between 1 and
+	// sstable.MaxZstdLevel, used when Compression is ZstdCompression. Higher
+	// levels compress better but more slowly, which for example suits the
+	// bottommost level, where most of the data resides and which is rewritten
+	// least often.
+	//
+	// The default value is sstable.DefaultZstdLevel.
+	ZstdLevel int
+
+	// CompressionDictSize is the maximum size of the compression dictionary
+	// built for each sstable written to the level. When non-zero and
+	// Compression is ZstdCompression, each sstable's data blocks are compressed
+	// with a dictionary sampled from its first data blocks, which helps small
+	// blocks of similar values compress well. Dictionaries are only built once
+	// the DB's format major version is at least FormatCompressionDictionaries.
+	//
+	// The default value (0) disables compression dictionaries.
+	CompressionDictSize int
+
 	// FilterPolicy defines a filter algorithm (such as a Bloom filter) that can
 	// reduce disk reads for Get calls.
 	//
@@ -458,6 +487,9 @@ func (o *LevelOptions) EnsureDefaults() *LevelOptions {
 	if o.Compression == nil {
 		o.Compression = func() Compression { return DefaultCompression }
 	}
+	if o.ZstdLevel <= 0 {
+		o.ZstdLevel = sstable.DefaultZstdLevel
+	}
 	if o.IndexBlockSize <= 0 {
 		o.IndexBlockSize = o.BlockSize
 	}
@@ -467,6 +499,46 @@ func (o *LevelOptions) EnsureDefaults() *LevelOptions {
 	return o
 }
 
+// WALRecoveryMode determines how Open handles invalid records, such as those
+// with checksum mismatches or that are truncated, when replaying the WAL. See
+// Options.WALRecoveryMode.
+type WALRecoveryMode int8
+
+const (
+	// WALRecoveryTolerateCorruptedTailRecords ends the replay of the most
+	// recent WAL at the first invalid record, treating it and everything after
+	// it as the unwritten tail of the WAL. An invalid record in any other WAL
+	// is an error.
+	WALRecoveryTolerateCorruptedTailRecords WALRecoveryMode = iota
+	// WALRecoveryAbsoluteConsistency treats an invalid record in any WAL as an
+	// error, including at the tail of the most recent WAL. Zeroed space, as
+	// left by WAL preallocation, is treated as the end of a WAL. This mode is
+	// intended for tests that expect every write to have completed.
+	WALRecoveryAbsoluteConsistency
+	// WALRecoverySkipAnyCorruptedRecords skips invalid records in all WALs,
+	// along with the rest of the 32KiB block containing them, and continues the
+	// replay at the next intact block. Writes in the skipped blocks are lost,
+	// while later writes are recovered. Intact records too short to hold a
+	// batch are skipped individually. Zeroed space, as left by WAL
+	// preallocation, and chunks left by a previous instance of a recycled WAL
+	// are treated as the end of a WAL.
+	WALRecoverySkipAnyCorruptedRecords
+)
+
+// String implements fmt.Stringer.
+func (m WALRecoveryMode) String() string {
+	switch m {
+	case WALRecoveryTolerateCorruptedTailRecords:
+		return "tolerate-corrupted-tail-records"
+	case WALRecoveryAbsoluteConsistency:
+		return "absolute-consistency"
+	case WALRecoverySkipAnyCorruptedRecords:
+		return "skip-any-corrupted-records"
+	default:
+		return fmt.Sprintf("WALRecoveryMode(%d)", int8(m))
+	}
+}
+
 // Options holds the optional parameters for configuring pebble. These options
 // apply to the DB at large; per-query options are defined by the IterOptions
 // and WriteOptions types.
@@ -490,6 +562,14 @@ type Options struct {
 	// unit from the semaphore for the duration of the read.
 	LoadBlockSema *fifo.Semaphore
 
+	// Checksum is the algorithm with which the blocks of new sstables are
+	// checksummed: ChecksumTypeCRC32c or ChecksumTypeXXHash64. The algorithm
+	// is recorded in each sstable's footer, so changing it does not affect
+	// reading existing sstables.
+	//
+	// The default value is ChecksumTypeCRC32c.
+	Checksum ChecksumType
+
 	// Cleaner cleans obsolete files.
 	//
 	// The default cleaner uses the DeleteCleaner.
@@ -853,6 +933,20 @@ type Options struct {
 	// The default value uses the underlying operating system's file system.
 	FS vfs.FS
 
+	// DiskSlowThreshold is the duration after which a write-oriented operation
+	// on an FS wrapped by WithFSDefaults is reported to EventListener.DiskSlow.
+	// The event is repeated for as long as the operation remains outstanding.
+	//
+	// The default value is 5 seconds.
+	DiskSlowThreshold time.Duration
+
+	// MaxDiskStallDuration, if positive, is the duration after which an
+	// outstanding operation on an FS wrapped by WithFSDefaults is considered
+	// stalled, and the process exits through Logger.Fatalf. Exiting allows the
+	// store to be failed over, rather than hanging indefinitely on a disk that
+	// has stopped responding. It should be well above DiskSlowThreshold.
+	MaxDiskStallDuration time.Duration
+
 	// Lock, if set, must be a database lock acquired through LockDirectory for
 	// the same directory passed to Open. If provided, Open will skip locking
 	// the directory. Closing the database will not release the lock, and it's
@@ -1020,6 +1114,16 @@ type Options struct {
 	// default behaviour in RocksDB.
 	WALBytesPerSync int
 
+	// WALCompression is the algorithm with which the payloads of WAL records are
+	// compressed. Records that do not compress well are written uncompressed.
+	// Compressed WALs cannot be read by versions of Pebble that predate
+	// FormatWALCompression, so WALCompression is ignored until the DB's format
+	// major version is at least FormatWALCompression.
+	//
+	// The default value, DefaultCompression, and NoCompression both disable
+	// WAL compression.
+	WALCompression Compression
+
 	// WALDir specifies the directory to store write-ahead logs (WALs) in. If
 	// empty (the default), WALs will be stored in the same directory as sstables
 	// (i.e. the directory passed to pebble.Open).
@@ -1043,6 +1147,13 @@ type Options struct {
 	// is not a corresponding entry in WALRecoveryDirs, Open will error.
 	WALRecoveryDirs []wal.Dir
 
+	// WALRecoveryMode determines how invalid records encountered while replaying
+	// the WAL during Open are handled. The default,
+	// WALRecoveryTolerateCorruptedTailRecords, tolerates an invalid record at
+	// the tail of the most recent WAL, consistent with a write in flight at the
+	// time of a crash.
+	WALRecoveryMode WALRecoveryMode
+
 	// WALMinSyncInterval is the minimum duration between syncs of the WAL. If
 	// WAL syncs are requested faster than this interval, they will be
 	// artificially delayed. Introducing a small artificial delay (500us) between
@@ -1148,6 +1259,9 @@ func (o *Options) EnsureDefaults() *Options {
 	if o.BytesPerSync <= 0 {
 		o.BytesPerSync = 512 << 10 // 512 KB
 	}
+	if o.Checksum == block.ChecksumTypeNone {
+		o.Checksum = ChecksumTypeCRC32c
+	}
 	if o.Cleaner == nil {
 		o.Cleaner = DeleteCleaner{}
 	}
@@ -1292,13 +1406,27 @@ func (o *Options) WithFSDefaults() *Options {
 	if o.FS == nil {
 		o.FS = vfs.Default
 	}
-	o.FS, o.private.fsCloser = vfs.WithDiskHealthChecks(o.FS, 5*time.Second, nil,
-		func(info vfs.DiskSlowInfo) {
-			o.EventListener.DiskSlow(info)
-		})
+	threshold := o.DiskSlowThreshold
+	if threshold <= 0 {
+		threshold = 5 * time.Second
+	}
+	o.FS, o.private.fsCloser = vfs.WithDiskHealthChecks(o.FS, threshold, nil, o.onDiskSlow)
 	return o
 }
 
+// onDiskSlow is invoked by the disk-health checking installed by
+// WithFSDefaults when an operation exceeds DiskSlowThreshold.
+func (o *Options) onDiskSlow(info vfs.DiskSlowInfo) {
+	o.EventListener.DiskSlow(info)
+	if o.MaxDiskStallDuration > 0 && info.Duration >= o.MaxDiskStallDuration {
+		logger := o.Logger
+		if logger == nil {
+			logger = DefaultLogger
+		}
+		logger.Fatalf("disk stall detected, exceeding MaxDiskStallDuration of %s: %s", o.MaxDiskStallDuration, info)
+	}
+}
+
 // AddEventListener adds the provided event listener to the Options, in addition
 // to any existing event listener.
 func (o *Options) AddEventListener(l EventListener) {
@@ -1367,6 +1495,7 @@ func (o *Options) String() string {
 	fmt.Fprintf(&buf, "[Options]\n")
 	fmt.Fprintf(&buf, "  bytes_per_sync=%d\n", o.BytesPerSync)
 	fmt.Fprintf(&buf, "  cache_size=%d\n", cacheSize)
+	fmt.Fprintf(&buf, "  checksum=%s\n", o.Checksum)
 	fmt.Fprintf(&buf, "  cleaner=%s\n", o.Cleaner)
 	fmt.Fprintf(&buf, "  compaction_debt_concurrency=%d\n", o.Experimental.CompactionDebtConcurrency)
 	fmt.Fprintf(&buf, "  comparer=%s\n", o.Comparer.Name)
@@ -1406,6 +1535,7 @@ func (o *Options) String() string {
 	fmt.Fprintf(&buf, "  validate_on_ingest=%t\n", o.Experimental.ValidateOnIngest)
 	fmt.Fprintf(&buf, "  wal_dir=%s\n", o.WALDir)
 	fmt.Fprintf(&buf, "  wal_bytes_per_sync=%d\n", o.WALBytesPerSync)
+	fmt.Fprintf(&buf, "  wal_compression=%s\n", o.WALCompression)
 	fmt.Fprintf(&buf, "  max_writer_concurrency=%d\n", o.Experimental.MaxWriterConcurrency)
 	fmt.Fprintf(&buf, "  force_writer_parallelism=%t\n", o.Experimental.ForceWriterParallelism)
 	fmt.Fprintf(&buf, "  secondary_cache_size_bytes=%d\n", o.Experimental.SecondaryCacheSizeBytes)
@@ -1448,10 +1578,12 @@ func (o *Options) String() string {
 		fmt.Fprintf(&buf, "  block_size=%d\n", l.BlockSize)
 		fmt.Fprintf(&buf, "  block_size_threshold=%d\n", l.BlockSizeThreshold)
 		fmt.Fprintf(&buf, "  compression=%s\n", resolveDefaultCompression(l.Compression()))
+		fmt.Fprintf(&buf, "  compression_dict_size=%d\n", l.CompressionDictSize)
 		fmt.Fprintf(&buf, "  filter_policy=%s\n", filterPolicyName(l.FilterPolicy))
 		fmt.Fprintf(&buf, "  filter_type=%s\n", l.FilterType)
 		fmt.Fprintf(&buf, "  index_block_size=%d\n", l.IndexBlockSize)
 		fmt.Fprintf(&buf, "  target_file_size=%d\n", l.TargetFileSize)
+		fmt.Fprintf(&buf, "  zstd_level=%d\n", l.ZstdLevel)
 	}
 
 	return buf.String()
@@ -1561,6 +1693,15 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 				}
 				// We avoid calling cache.New in parsing because it makes it
 				// too easy to leak a cache.
+			case "checksum":
+				switch value {
+				case "crc32c":
+					o.Checksum = ChecksumTypeCRC32c
+				case "xxhash64":
+					o.Checksum = ChecksumTypeXXHash64
+				default:
+					return errors.Errorf("pebble: unknown checksum: %q", errors.Safe(value))
+				}
 			case "cleaner":
 				switch value {
 				case "archive":
@@ -1732,6 +1873,19 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 				o.WALDir = value
 			case "wal_bytes_per_sync":
 				o.WALBytesPerSync, err = strconv.Atoi(value)
+			case "wal_compression":
+				switch value {
+				case "Default":
+					o.WALCompression = DefaultCompression
+				case "NoCompression":
+					o.WALCompression = NoCompression
+				case "Snappy":
+					o.WALCompression = SnappyCompression
+				case "ZSTD":
+					o.WALCompression = ZstdCompression
+				default:
+					return errors.Errorf("pebble: unknown compression: %q", errors.Safe(value))
+				}
 			case "max_writer_concurrency":
 				o.Experimental.MaxWriterConcurrency, err = strconv.Atoi(value)
 			case "force_writer_parallelism":
@@ -1823,6 +1977,8 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 				default:
 					return errors.Errorf("pebble: unknown compression: %q", errors.Safe(value))
 				}
+			case "compression_dict_size":
+				l.CompressionDictSize, err = strconv.Atoi(value)
 			case "filter_policy":
 				if hooks != nil && hooks.NewFilterPolicy != nil {
 					l.FilterPolicy, err = hooks.NewFilterPolicy(value)
@@ -1838,6 +1994,8 @@ func (o *Options) Parse(s string, hooks *ParseHooks) error {
 				l.IndexBlockSize, err = strconv.Atoi(value)
 			case "target_file_size":
 				l.TargetFileSize, err = strconv.ParseInt(value, 10, 64)
+			case "zstd_level":
+				l.ZstdLevel, err = strconv.Atoi(value)
 			default:
 				if hooks != nil && hooks.SkipUnknown != nil && hooks.SkipUnknown(section+"."+key, value) {
 					return nil
@@ -1938,9 +2096,19 @@ func (o *Options) Validate() error {
 			o.FormatMajorVersion, FormatMinForSharedObjects)
 
 	}
+	if o.Checksum != ChecksumTypeCRC32c && o.Checksum != ChecksumTypeXXHash64 {
+		fmt.Fprintf(&buf, "Checksum (%d) must be %s or %s\n",
+			o.Checksum, ChecksumTypeCRC32c, ChecksumTypeXXHash64)
+	}
 	if o.TableCache != nil && o.Cache != o.TableCache.cache {
 		fmt.Fprintf(&buf, "underlying cache in the TableCache and the Cache dont match\n")
 	}
+	for i := range o.Levels {
+		if o.Levels[i].ZstdLevel > sstable.MaxZstdLevel {
+			fmt.Fprintf(&buf, "Levels[%d].ZstdLevel (%d) must be <= %d\n",
+				i, o.Levels[i].ZstdLevel, sstable.MaxZstdLevel)
+		}
+	}
 	if buf.Len() == 0 {
 		return nil
 	}
@@ -1977,6 +2145,7 @@ func (o *Options) MakeWriterOptions(level int, format sstable.TableFormat) sstab
 			writerOpts.MergerName = o.Merger.Name
 		}
 		writerOpts.BlockPropertyCollectors = o.BlockPropertyCollectors
+		writerOpts.Checksum = o.Checksum
 	}
 	if format >= sstable.TableFormatPebblev3 {
 		writerOpts.ShortAttributeExtractor = o.Experimental.ShortAttributeExtractor
@@ -1990,6 +2159,8 @@ func (o *Options) MakeWriterOptions(level int, format sstable.TableFormat) sstab
 	writerOpts.BlockSize = levelOpts.BlockSize
 	writerOpts.BlockSizeThreshold = levelOpts.BlockSizeThreshold
 	writerOpts.Compression = resolveDefaultCompression(levelOpts.Compression())
+	writerOpts.ZstdLevel = levelOpts.ZstdLevel
+	writerOpts.CompressionDictSize = levelOpts.CompressionDictSize
 	writerOpts.FilterPolicy = levelOpts.FilterPolicy
 	writerOpts.FilterType = levelOpts.FilterType
 	writerOpts.IndexBlockSize = levelOpts.IndexBlockSize
@@ -77,6 +77,7 @@ func TestOptionsString(t *testing.T) {
 [Options]
   bytes_per_sync=524288
   cache_size=8388608
+  checksum=crc32c
   cleaner=delete
   compaction_debt_concurrency=1073741824
   comparer=leveldb.BytewiseComparator
@@ -106,6 +107,7 @@ func TestOptionsString(t *testing.T) {
   validate_on_ingest=false
   wal_dir=
   wal_bytes_per_sync=0
+  wal_compression=Default
   max_writer_concurrency=0
   force_writer_parallelism=false
   secondary_cache_size_bytes=0
@@ -116,10 +118,12 @@ func TestOptionsString(t *testing.T) {
   block_size=4096
   block_size_threshold=90
   compression=Snappy
+  compression_dict_size=0
   filter_policy=none
   filter_type=table
   index_block_size=4096
   target_file_size=2097152
+  zstd_level=3
 `
 
 	var opts *Options
@@ -289,6 +293,7 @@ func TestOptionsParse(t *testing.T) {
 			opts.Experimental.MaxWriterConcurrency = 1
 			opts.Experimental.ForceWriterParallelism = true
 			opts.Experimental.SecondaryCacheSizeBytes = 1024
+			opts.WALCompression = SnappyCompression
 			opts.EnsureDefaults()
 			str := opts.String()
 
@@ -301,6 +306,7 @@ func TestOptionsParse(t *testing.T) {
 			}
 			require.Nil(t, parsedOptions.Cache)
 			require.NotEqual(t, newCacheSize, 0)
+			require.Equal(t, SnappyCompression, parsedOptions.WALCompression)
 		})
 	}
 }
@@ -336,6 +342,13 @@ func TestOptionsValidate(t *testing.T) {
 `,
 			`MemTableStopWritesThreshold .* must be >= 2`,
 		},
+		{`
+[Level "6"]
+  compression=ZSTD
+  zstd_level=23
+`,
+			`Levels\[6\]\.ZstdLevel \(23\) must be <= 22`,
+		},
 	}
 
 	for _, c := range testCases {
@@ -371,3 +384,27 @@ func TestOptionsValidateCache(t *testing.T) {
 		t.Errorf("Unexpected error message")
 	}
 }
+
+func TestOptionsDiskStall(t *testing.T) {
+	var slow []time.Duration
+	logger := &base.InMemLogger{}
+	opts := (&Options{
+		FS:                   vfs.NewMem(),
+		Logger:               logger,
+		EventListener:        &EventListener{DiskSlow: func(info DiskSlowInfo) { slow = append(slow, info.Duration) }},
+		MaxDiskStallDuration: 20 * time.Second,
+	}).WithFSDefaults()
+	defer opts.private.fsCloser.Close()
+
+	info := DiskSlowInfo{Path: "000001.log", OpType: vfs.OpTypeSync, Duration: 10 * time.Second}
+	opts.onDiskSlow(info)
+	require.Equal(t, []time.Duration{10 * time.Second}, slow)
+	require.Empty(t, logger.String())
+
+	// Once the operation has been outstanding for MaxDiskStallDuration, the
+	// stall is fatal.
+	info.Duration = 20 * time.Second
+	opts.onDiskSlow(info)
+	require.Len(t, slow, 2)
+	require.Contains(t, logger.String(), "FATAL: disk stall detected, exceeding MaxDiskStallDuration of 20s")
+}
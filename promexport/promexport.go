@@ -0,0 +1,234 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+// Package promexport exports the metrics of a Pebble DB as Prometheus
+// metrics, so that embedders share a single, stable mapping.
+//
+// All metric names are prefixed with "pebble_". Per-level metrics carry a
+// "level" label with values "0" through "6". The names are stable: new
+// metrics may be added, but existing ones are not renamed or removed.
+//
+// To export the metrics of a DB:
+//
+//	prometheus.MustRegister(promexport.NewCollector(db, nil))
+package promexport
+
+import (
+	"strconv"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// namespace prefixes the names of all exported metrics.
+const namespace = "pebble"
+
+// MetricsSource is the source of the metrics exported by a Collector. It is
+// implemented by *pebble.DB.
+type MetricsSource interface {
+	Metrics() *pebble.Metrics
+}
+
+// Collector is a prometheus.Collector that exports the metrics of a DB.
+// Each collection takes a single snapshot of the metrics, so that the
+// exported values are mutually consistent.
+type Collector struct {
+	source       MetricsSource
+	metrics      []metric
+	levelMetrics []levelMetric
+}
+
+var _ prometheus.Collector = (*Collector)(nil)
+
+// NewCollector returns a Collector exporting the metrics of source. The
+// constLabels, which may be nil, are attached to every exported metric and
+// can be used to distinguish multiple DBs in one process.
+func NewCollector(source MetricsSource, constLabels prometheus.Labels) *Collector {
+	c := &Collector{source: source}
+	for _, d := range metricDefs {
+		c.metrics = append(c.metrics, metric{
+			desc:      prometheus.NewDesc(namespace+"_"+d.name, d.help, nil, constLabels),
+			valueType: d.valueType,
+			value:     d.value,
+		})
+	}
+	for _, d := range levelMetricDefs {
+		c.levelMetrics = append(c.levelMetrics, levelMetric{
+			desc:      prometheus.NewDesc(namespace+"_level_"+d.name, d.help, []string{"level"}, constLabels),
+			valueType: d.valueType,
+			value:     d.value,
+		})
+	}
+	return c
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for i := range c.metrics {
+		ch <- c.metrics[i].desc
+	}
+	for i := range c.levelMetrics {
+		ch <- c.levelMetrics[i].desc
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	m := c.source.Metrics()
+	for i := range c.metrics {
+		cm := &c.metrics[i]
+		ch <- prometheus.MustNewConstMetric(cm.desc, cm.valueType, cm.value(m))
+	}
+	for level := range m.Levels {
+		label := strconv.Itoa(level)
+		for i := range c.levelMetrics {
+			lm := &c.levelMetrics[i]
+			ch <- prometheus.MustNewConstMetric(lm.desc, lm.valueType, lm.value(&m.Levels[level]), label)
+		}
+	}
+}
+
+type metric struct {
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+	value     func(*pebble.Metrics) float64
+}
+
+type levelMetric struct {
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+	value     func(*pebble.LevelMetrics) float64
+}
+
+const (
+	gauge   = prometheus.GaugeValue
+	counter = prometheus.CounterValue
+)
+
+// metricDefs defines the DB-wide metrics. Counters are suffixed with
+// "_total", and sizes with "_bytes", following the Prometheus conventions.
+var metricDefs = []struct {
+	name      string
+	help      string
+	valueType prometheus.ValueType
+	value     func(*pebble.Metrics) float64
+}{
+	{"read_amp", "Current read amplification: the number of L0 sublevels plus non-empty lower levels.", gauge,
+		func(m *pebble.Metrics) float64 { return float64(m.ReadAmp()) }},
+	{"disk_usage_bytes", "Disk space used by the DB, including obsolete files.", gauge,
+		func(m *pebble.Metrics) float64 { return float64(m.DiskSpaceUsage()) }},
+	{"uptime_seconds", "Time since the DB was opened.", gauge,
+		func(m *pebble.Metrics) float64 { return m.Uptime.Seconds() }},
+
+	{"block_cache_size_bytes", "Bytes in use by the block cache.", gauge,
+		func(m *pebble.Metrics) float64 { return float64(m.BlockCache.Size) }},
+	{"block_cache_entries", "Number of blocks in the block cache.", gauge,
+		func(m *pebble.Metrics) float64 { return float64(m.BlockCache.Count) }},
+	{"block_cache_hits_total", "Number of block cache hits.", counter,
+		func(m *pebble.Metrics) float64 { return float64(m.BlockCache.Hits) }},
+	{"block_cache_misses_total", "Number of block cache misses.", counter,
+		func(m *pebble.Metrics) float64 { return float64(m.BlockCache.Misses) }},
+	{"table_cache_size_bytes", "Bytes in use by the table cache.", gauge,
+		func(m *pebble.Metrics) float64 { return float64(m.TableCache.Size) }},
+	{"table_cache_entries", "Number of tables in the table cache.", gauge,
+		func(m *pebble.Metrics) float64 { return float64(m.TableCache.Count) }},
+	{"table_cache_hits_total", "Number of table cache hits.", counter,
+		func(m *pebble.Metrics) float64 { return float64(m.TableCache.Hits) }},
+	{"table_cache_misses_total", "Number of table cache misses.", counter,
+		func(m *pebble.Metrics) float64 { return float64(m.TableCache.Misses) }},
+	{"table_iterators", "Number of open sstable iterators.", gauge,
+		func(m *pebble.Metrics) float64 { return float64(m.TableIters) }},
+
+	{"compactions_total", "Number of compactions.", counter,
+		func(m *pebble.Metrics) float64 { return float64(m.Compact.Count) }},
+	{"compactions_in_progress", "Number of compactions in progress.", gauge,
+		func(m *pebble.Metrics) float64 { return float64(m.Compact.NumInProgress) }},
+	{"compaction_in_progress_bytes", "Bytes in sstables being written by in-progress compactions.", gauge,
+		func(m *pebble.Metrics) float64 { return float64(m.Compact.InProgressBytes) }},
+	{"compaction_estimated_debt_bytes", "Estimated bytes that must be compacted for the LSM to reach a stable state.", gauge,
+		func(m *pebble.Metrics) float64 { return float64(m.Compact.EstimatedDebt) }},
+	{"compaction_marked_files", "Number of files marked for compaction.", gauge,
+		func(m *pebble.Metrics) float64 { return float64(m.Compact.MarkedFiles) }},
+	{"compaction_duration_seconds_total", "Cumulative duration of compactions.", counter,
+		func(m *pebble.Metrics) float64 { return m.Compact.Duration.Seconds() }},
+	{"flushes_total", "Number of flushes.", counter,
+		func(m *pebble.Metrics) float64 { return float64(m.Flush.Count) }},
+	{"flushes_in_progress", "Number of flushes in progress.", gauge,
+		func(m *pebble.Metrics) float64 { return float64(m.Flush.NumInProgress) }},
+	{"ingestions_total", "Number of ingestions.", counter,
+		func(m *pebble.Metrics) float64 { return float64(m.Ingest.Count) }},
+
+	{"memtable_size_bytes", "Bytes allocated by memtables and large batches.", gauge,
+		func(m *pebble.Metrics) float64 { return float64(m.MemTable.Size) }},
+	{"memtables", "Number of memtables.", gauge,
+		func(m *pebble.Metrics) float64 { return float64(m.MemTable.Count) }},
+	{"memtable_zombie_size_bytes", "Bytes in memtables no longer referenced by the current DB state.", gauge,
+		func(m *pebble.Metrics) float64 { return float64(m.MemTable.ZombieSize) }},
+	{"memtable_zombies", "Number of memtables no longer referenced by the current DB state.", gauge,
+		func(m *pebble.Metrics) float64 { return float64(m.MemTable.ZombieCount) }},
+
+	{"wal_files", "Number of live WAL files.", gauge,
+		func(m *pebble.Metrics) float64 { return float64(m.WAL.Files) }},
+	{"wal_obsolete_files", "Number of obsolete WAL files.", gauge,
+		func(m *pebble.Metrics) float64 { return float64(m.WAL.ObsoleteFiles) }},
+	{"wal_size_bytes", "Size of the live data in WAL files.", gauge,
+		func(m *pebble.Metrics) float64 { return float64(m.WAL.Size) }},
+	{"wal_physical_size_bytes", "On-disk size of WAL files.", gauge,
+		func(m *pebble.Metrics) float64 { return float64(m.WAL.PhysicalSize) }},
+	{"wal_bytes_in_total", "Logical bytes written to the WAL.", counter,
+		func(m *pebble.Metrics) float64 { return float64(m.WAL.BytesIn) }},
+	{"wal_bytes_written_total", "Physical bytes written to the WAL.", counter,
+		func(m *pebble.Metrics) float64 { return float64(m.WAL.BytesWritten) }},
+
+	{"table_obsolete_size_bytes", "Bytes in tables no longer referenced by the DB or any iterator.", gauge,
+		func(m *pebble.Metrics) float64 { return float64(m.Table.ObsoleteSize) }},
+	{"table_zombie_size_bytes", "Bytes in tables no longer referenced by the DB but still in use by an iterator.", gauge,
+		func(m *pebble.Metrics) float64 { return float64(m.Table.ZombieSize) }},
+	{"tombstones", "Approximate number of point and range tombstones.", gauge,
+		func(m *pebble.Metrics) float64 { return float64(m.Keys.TombstoneCount) }},
+	{"snapshots", "Number of open snapshots.", gauge,
+		func(m *pebble.Metrics) float64 { return float64(m.Snapshots.Count) }},
+	{"snapshot_pinned_keys_total", "Keys written that would have been elided if not for open snapshots.", counter,
+		func(m *pebble.Metrics) float64 { return float64(m.Snapshots.PinnedKeys) }},
+}
+
+// levelMetricDefs defines the per-level metrics, which are exported with the
+// "pebble_level_" prefix and a "level" label.
+var levelMetricDefs = []struct {
+	name      string
+	help      string
+	valueType prometheus.ValueType
+	value     func(*pebble.LevelMetrics) float64
+}{
+	{"files", "Number of files in the level.", gauge,
+		func(l *pebble.LevelMetrics) float64 { return float64(l.NumFiles) }},
+	{"size_bytes", "Total size of the files in the level.", gauge,
+		func(l *pebble.LevelMetrics) float64 { return float64(l.Size) }},
+	{"sublevels", "Number of sublevels in the level, contributing to read amplification.", gauge,
+		func(l *pebble.LevelMetrics) float64 { return float64(l.Sublevels) }},
+	{"score", "Compaction score of the level.", gauge,
+		func(l *pebble.LevelMetrics) float64 { return l.Score }},
+	{"write_amp", "Write amplification of compactions into the level.", gauge,
+		func(l *pebble.LevelMetrics) float64 { return l.WriteAmp() }},
+	{"bytes_in_total", "Bytes written into the level by flushes or compactions of higher levels.", counter,
+		func(l *pebble.LevelMetrics) float64 { return float64(l.BytesIn) }},
+	{"bytes_read_total", "Bytes read from the level by compactions.", counter,
+		func(l *pebble.LevelMetrics) float64 { return float64(l.BytesRead) }},
+	{"bytes_compacted_total", "Bytes written to the level by compactions.", counter,
+		func(l *pebble.LevelMetrics) float64 { return float64(l.BytesCompacted) }},
+	{"bytes_flushed_total", "Bytes written to the level by flushes.", counter,
+		func(l *pebble.LevelMetrics) float64 { return float64(l.BytesFlushed) }},
+	{"bytes_ingested_total", "Bytes ingested into the level.", counter,
+		func(l *pebble.LevelMetrics) float64 { return float64(l.BytesIngested) }},
+	{"bytes_moved_total", "Bytes moved into the level by move compactions.", counter,
+		func(l *pebble.LevelMetrics) float64 { return float64(l.BytesMoved) }},
+	{"tables_compacted_total", "Tables written to the level by compactions.", counter,
+		func(l *pebble.LevelMetrics) float64 { return float64(l.TablesCompacted) }},
+	{"tables_flushed_total", "Tables written to the level by flushes.", counter,
+		func(l *pebble.LevelMetrics) float64 { return float64(l.TablesFlushed) }},
+	{"tables_ingested_total", "Tables ingested into the level.", counter,
+		func(l *pebble.LevelMetrics) float64 { return float64(l.TablesIngested) }},
+	{"tables_moved_total", "Tables moved into the level by move compactions.", counter,
+		func(l *pebble.LevelMetrics) float64 { return float64(l.TablesMoved) }},
+}
@@ -0,0 +1,53 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package promexport
+
+import (
+	"testing"
+
+	"github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollector(t *testing.T) {
+	d, err := pebble.Open("", &pebble.Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer d.Close()
+	require.NoError(t, d.Set([]byte("a"), []byte("b"), nil))
+	require.NoError(t, d.Flush())
+
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(NewCollector(d, prometheus.Labels{"store": "1"})))
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	require.Len(t, families, len(metricDefs)+len(levelMetricDefs))
+
+	values := make(map[string]float64)
+	for _, f := range families {
+		for _, m := range f.GetMetric() {
+			name := f.GetName()
+			labels := m.GetLabel()
+			require.Equal(t, "store", labels[len(labels)-1].GetName())
+			if len(labels) == 2 {
+				require.Equal(t, "level", labels[0].GetName())
+				name += "{level=" + labels[0].GetValue() + "}"
+			}
+			switch {
+			case m.GetCounter() != nil:
+				values[name] = m.GetCounter().GetValue()
+			case m.GetGauge() != nil:
+				values[name] = m.GetGauge().GetValue()
+			}
+		}
+	}
+	require.Equal(t, float64(1), values["pebble_flushes_total"])
+	require.Equal(t, float64(1), values["pebble_level_files{level=0}"])
+	require.Equal(t, float64(1), values["pebble_level_tables_flushed_total{level=0}"])
+	require.Equal(t, float64(0), values["pebble_level_files{level=6}"])
+	require.Equal(t, float64(1), values["pebble_read_amp"])
+	require.Greater(t, values["pebble_level_size_bytes{level=0}"], float64(0))
+}
@@ -0,0 +1,123 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package record
+
+import (
+	"encoding/binary"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is the algorithm with which a LogWriter compresses the payloads
+// of the records it writes. See LogWriterConfig.Compression.
+//
+// A compressed record is written with the recyclableCompressedFullChunkType
+// or recyclableCompressedFirstChunkType chunk type in the header of its first
+// chunk. Its payload is a one byte Compression, followed by the uvarint
+// length of the decompressed payload and the compressed payload.
+type Compression uint8
+
+// These constants are part of the wire format and should not be changed.
+const (
+	// NoCompression writes records uncompressed.
+	NoCompression Compression = iota
+	// SnappyCompression compresses records with snappy.
+	SnappyCompression
+	// ZstdCompression compresses records with Zstandard, at the default level.
+	ZstdCompression
+)
+
+// String implements fmt.Stringer.
+func (c Compression) String() string {
+	switch c {
+	case NoCompression:
+		return "NoCompression"
+	case SnappyCompression:
+		return "Snappy"
+	case ZstdCompression:
+		return "ZSTD"
+	default:
+		return "Unknown"
+	}
+}
+
+// zstdCodec returns the zstd encoder and decoder shared by all LogWriters and
+// Readers. Both are safe for concurrent use through EncodeAll and DecodeAll.
+var zstdCodec = sync.OnceValues(func() (*zstd.Encoder, *zstd.Decoder) {
+	encoder, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+	decoder, _ := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	return encoder, decoder
+})
+
+// minCompressedRecordSize is the size below which records are not compressed,
+// as compression would be unlikely to save more than it costs.
+const minCompressedRecordSize = 64
+
+// compressRecord appends the compressed encoding of the payload p to
+// buf[:0] using the compression algorithm c, returning false if compression
+// would not shrink the payload by at least 1/8th.
+func compressRecord(c Compression, buf, p []byte) ([]byte, bool) {
+	if len(p) < minCompressedRecordSize {
+		return buf, false
+	}
+	buf = append(buf[:0], byte(c))
+	buf = binary.AppendUvarint(buf, uint64(len(p)))
+	switch c {
+	case SnappyCompression:
+		n := len(buf)
+		if m := n + snappy.MaxEncodedLen(len(p)); cap(buf) < m {
+			buf = append(make([]byte, 0, m), buf...)
+		}
+		buf = buf[:n+len(snappy.Encode(buf[n:cap(buf)], p))]
+	case ZstdCompression:
+		encoder, _ := zstdCodec()
+		buf = encoder.EncodeAll(p, buf)
+	default:
+		return buf, false
+	}
+	if len(buf) >= len(p)-len(p)/8 {
+		return buf, false
+	}
+	return buf, true
+}
+
+// decompressRecord appends the payload encoded by compressRecord in
+// compressed to buf[:0]. It returns ErrInvalidChunk if compressed is not a
+// valid encoding.
+func decompressRecord(buf, compressed []byte) ([]byte, error) {
+	if len(compressed) == 0 {
+		return nil, ErrInvalidChunk
+	}
+	c := Compression(compressed[0])
+	length, n := binary.Uvarint(compressed[1:])
+	if n <= 0 || length > maxDecompressedRecordSize {
+		return nil, ErrInvalidChunk
+	}
+	compressed = compressed[1+n:]
+	if uint64(cap(buf)) < length {
+		buf = make([]byte, 0, length)
+	}
+	var err error
+	switch c {
+	case SnappyCompression:
+		buf, err = snappy.Decode(buf[:length], compressed)
+	case ZstdCompression:
+		_, decoder := zstdCodec()
+		buf, err = decoder.DecodeAll(compressed, buf[:0])
+	default:
+		return nil, ErrInvalidChunk
+	}
+	if err != nil || uint64(len(buf)) != length {
+		return nil, ErrInvalidChunk
+	}
+	return buf, nil
+}
+
+// maxDecompressedRecordSize bounds the decompressed length a compressed
+// record may claim, so that a corrupt length cannot cause an arbitrarily large
+// allocation. Batches, the largest records written, are limited to 4 GiB.
+const maxDecompressedRecordSize = 4 << 30
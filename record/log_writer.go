@@ -454,6 +454,7 @@ type LogWriter struct {
 		// minSyncInterval is the minimum duration between syncs.
 		minSyncInterval durationFunc
 		fsyncLatency    prometheus.Histogram
+		syncCallback    SyncCallback
 		pending         []*block
 		// Pushing and popping from pendingSyncs does not require flusher mutex to
 		// be held.
@@ -471,6 +472,12 @@ type LogWriter struct {
 	pendingSyncsBackingIndex pendingSyncsWithHighestSyncIndex
 
 	pendingSyncForSyncQueueBacking pendingSyncForSyncQueue
+
+	// compression is the algorithm with which record payloads are compressed,
+	// and compressBuf holds the compressed payload of the record being
+	// written.
+	compression Compression
+	compressBuf []byte
 }
 
 // LogWriterConfig is a struct used for configuring new LogWriters
@@ -495,8 +502,25 @@ type LogWriterConfig struct {
 	// package) precede the lower layer locks (in the record package). These
 	// callbacks are serialized since they are invoked from the flushLoop.
 	ExternalSyncQueueCallback ExternalSyncQueueCallback
+
+	// Compression is the algorithm with which the payloads of records are
+	// compressed. Records that do not compress well are written uncompressed.
+	// Compressed records can only be read by a Reader that supports the
+	// compressed chunk types, so compression must only be enabled once every
+	// reader of the log is known to support them.
+	Compression Compression
+
+	// WALSyncCallback is an optional callback invoked after every sync of the
+	// log, successful or not.
+	WALSyncCallback SyncCallback
 }
 
+// SyncCallback is run after a sync of the log, with the duration of the sync
+// and any error it returned. It is invoked from the goroutine performing the
+// sync without any mutex held, and delays the completion of the sync it
+// reports, so it must return quickly.
+type SyncCallback func(duration time.Duration, err error)
+
 // ExternalSyncQueueCallback is to be run when a PendingSync has been
 // processed, either successfully or with an error.
 type ExternalSyncQueueCallback func(doneSync PendingSyncIndex, err error)
@@ -534,6 +558,7 @@ func NewLogWriter(
 		afterFunc: func(d time.Duration, f func()) syncTimer {
 			return time.AfterFunc(d, f)
 		},
+		compression: logWriterConfig.Compression,
 	}
 	m := &LogWriterMetrics{}
 	if logWriterConfig.ExternalSyncQueueCallback != nil {
@@ -557,6 +582,7 @@ func NewLogWriter(
 	f := &r.flusher
 	f.minSyncInterval = logWriterConfig.WALMinSyncInterval
 	f.fsyncLatency = logWriterConfig.WALFsyncLatency
+	f.syncCallback = logWriterConfig.WALSyncCallback
 
 	go func() {
 		pprof.Do(context.Background(), walSyncLabels, r.flushLoop)
@@ -775,6 +801,9 @@ func (w *LogWriter) syncWithLatency() (time.Duration, error) {
 	start := time.Now()
 	err := w.s.Sync()
 	syncLatency := time.Since(start)
+	if w.flusher.syncCallback != nil {
+		w.flusher.syncCallback(syncLatency, err)
+	}
 	return syncLatency, err
 }
 
@@ -923,8 +952,15 @@ func (w *LogWriter) SyncRecordGeneralized(p []byte, ps PendingSync) (logSize int
 	// possibly be generated for VersionEdits stored in the MANIFEST. While the
 	// MANIFEST is currently written using Writer, it is good to support the same
 	// semantics with LogWriter.
+	compressed := false
+	if w.compression != NoCompression {
+		w.compressBuf, compressed = compressRecord(w.compression, w.compressBuf, p)
+		if compressed {
+			p = w.compressBuf
+		}
+	}
 	for i := 0; i == 0 || len(p) > 0; i++ {
-		p = w.emitFragment(i, p)
+		p = w.emitFragment(i, p, compressed)
 	}
 
 	if ps.syncRequested() {
@@ -964,20 +1000,24 @@ func (w *LogWriter) emitEOFTrailer() {
 	b.written.Store(i + int32(recyclableHeaderSize))
 }
 
-func (w *LogWriter) emitFragment(n int, p []byte) (remainingP []byte) {
+func (w *LogWriter) emitFragment(n int, p []byte, compressed bool) (remainingP []byte) {
 	b := w.block
 	i := b.written.Load()
 	first := n == 0
 	last := blockSize-i-recyclableHeaderSize >= int32(len(p))
 
 	if last {
-		if first {
+		if first && compressed {
+			b.buf[i+6] = recyclableCompressedFullChunkType
+		} else if first {
 			b.buf[i+6] = recyclableFullChunkType
 		} else {
 			b.buf[i+6] = recyclableLastChunkType
 		}
 	} else {
-		if first {
+		if first && compressed {
+			b.buf[i+6] = recyclableCompressedFirstChunkType
+		} else if first {
 			b.buf[i+6] = recyclableFirstChunkType
 		} else {
 			b.buf[i+6] = recyclableMiddleChunkType
@@ -105,6 +105,7 @@ package record
 // instead of "chunk", but "chunk" is shorter and less confusing.
 
 import (
+	"bytes"
 	"encoding/binary"
 	"io"
 
@@ -124,6 +125,12 @@ const (
 	recyclableFirstChunkType  = 6
 	recyclableMiddleChunkType = 7
 	recyclableLastChunkType   = 8
+
+	// The first chunk of a record whose payload is compressed (see
+	// Compression) has one of these types. The remaining chunks of the record
+	// have the recyclableMiddleChunkType and recyclableLastChunkType types.
+	recyclableCompressedFullChunkType  = 9
+	recyclableCompressedFirstChunkType = 10
 )
 
 const (
@@ -142,19 +149,33 @@ var (
 
 	// ErrZeroedChunk is returned if a chunk is encountered that is zeroed. This
 	// usually occurs due to log file preallocation.
-	ErrZeroedChunk = base.CorruptionErrorf("pebble/record: zeroed chunk")
+	ErrZeroedChunk = markChunkError(errors.New("pebble/record: zeroed chunk"))
 
 	// ErrInvalidChunk is returned if a chunk is encountered with an invalid
 	// header, length, or checksum. This usually occurs when a log is recycled,
 	// but can also occur due to corruption.
-	ErrInvalidChunk = base.CorruptionErrorf("pebble/record: invalid chunk")
+	ErrInvalidChunk = markChunkError(errors.New("pebble/record: invalid chunk"))
+
+	// ErrRecycledChunk is returned if a chunk written to a previous instance of a
+	// recycled log is encountered in the middle of a record. This usually occurs
+	// when the record was only partially written, and the chunk marks the end of
+	// the log's contents.
+	ErrRecycledChunk = markChunkError(errors.New("pebble/record: chunk from a recycled log"))
 )
 
+// markChunkError marks err as a corruption error, and then with err itself.
+// Every corruption error is otherwise equivalent under errors.Is, which would
+// not distinguish the errors returned for invalid chunks from each other.
+func markChunkError(err error) error {
+	return errors.Mark(base.MarkCorruptionError(err), err)
+}
+
 // IsInvalidRecord returns true if the error matches one of the error types
 // returned for invalid records. These are treated in a way similar to io.EOF
 // in recovery code.
 func IsInvalidRecord(err error) bool {
-	return err == ErrZeroedChunk || err == ErrInvalidChunk || err == io.ErrUnexpectedEOF
+	return err == ErrZeroedChunk || err == ErrInvalidChunk || err == ErrRecycledChunk ||
+		err == io.ErrUnexpectedEOF
 }
 
 // Reader reads records from an underlying io.Reader.
@@ -178,6 +199,14 @@ type Reader struct {
 	recovering bool
 	// last is whether the current chunk is the last chunk of the record.
 	last bool
+	// compressed is whether the current record's payload is compressed.
+	compressed bool
+	// compressedBuf and decompressedBuf hold the payload of the current
+	// record, if it is compressed, before and after decompression.
+	// decompressed reads decompressedBuf.
+	compressedBuf   bytes.Buffer
+	decompressedBuf []byte
+	decompressed    bytes.Reader
 	// err is any accumulated error.
 	err error
 	// buf is the buffer.
@@ -224,7 +253,7 @@ func (r *Reader) nextChunk(wantFirst bool) error {
 			}
 
 			headerSize := legacyHeaderSize
-			if chunkType >= recyclableFullChunkType && chunkType <= recyclableLastChunkType {
+			if chunkType >= recyclableFullChunkType && chunkType <= recyclableCompressedFirstChunkType {
 				headerSize = recyclableHeaderSize
 				if r.end+headerSize > r.n {
 					return ErrInvalidChunk
@@ -239,10 +268,19 @@ func (r *Reader) nextChunk(wantFirst bool) error {
 					}
 					// Otherwise, treat this chunk as invalid in order to prevent reading
 					// of a partial record.
-					return ErrInvalidChunk
+					return ErrRecycledChunk
 				}
 
-				chunkType -= (recyclableFullChunkType - 1)
+				switch chunkType {
+				case recyclableCompressedFullChunkType:
+					chunkType = fullChunkType
+					r.compressed = r.compressed || wantFirst
+				case recyclableCompressedFirstChunkType:
+					chunkType = firstChunkType
+					r.compressed = r.compressed || wantFirst
+				default:
+					chunkType -= (recyclableFullChunkType - 1)
+				}
 			}
 
 			r.begin = r.end + headerSize
@@ -301,13 +339,33 @@ func (r *Reader) Next() (io.Reader, error) {
 		return nil, r.err
 	}
 	r.begin = r.end
+	r.compressed = false
 	r.err = r.nextChunk(true)
 	if r.err != nil {
 		return nil, r.err
 	}
+	if r.compressed {
+		return r.decompress()
+	}
 	return singleReader{r, r.seq}, nil
 }
 
+// decompress reads the entirety of the current record, which must be
+// compressed, and returns a reader for its decompressed payload.
+func (r *Reader) decompress() (io.Reader, error) {
+	r.compressedBuf.Reset()
+	if _, err := r.compressedBuf.ReadFrom(singleReader{r, r.seq}); err != nil {
+		r.err = err
+		return nil, err
+	}
+	r.decompressedBuf, r.err = decompressRecord(r.decompressedBuf, r.compressedBuf.Bytes())
+	if r.err != nil {
+		return nil, r.err
+	}
+	r.decompressed.Reset(r.decompressedBuf)
+	return &r.decompressed, nil
+}
+
 // Offset returns the current offset within the file. If called immediately
 // before a call to Next(), Offset() will return the record offset.
 func (r *Reader) Offset() int64 {
@@ -327,6 +385,7 @@ func (r *Reader) recover() {
 		return
 	}
 	r.recovering = true
+	r.compressed = false
 	r.err = nil
 	// Discard the rest of the current block.
 	r.begin, r.end, r.last = r.n, r.n, false
@@ -334,6 +393,15 @@ func (r *Reader) recover() {
 	r.seq++
 }
 
+// Recover clears any errors read so far, so that calling Next will start
+// reading from the next good 32KiB block. If there are no such blocks, Next
+// will return io.EOF. Recover also marks the current reader, the one most
+// recently returned by Next, as stale. If Recover is called without any prior
+// error, then Recover is a no-op.
+func (r *Reader) Recover() {
+	r.recover()
+}
+
 // seekRecord seeks in the underlying io.Reader such that calling r.Next
 // returns the record whose first chunk header starts at the provided offset.
 // Its behavior is undefined if the argument given is not such an offset, as
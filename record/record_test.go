@@ -12,10 +12,12 @@ import (
 	"math"
 	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"github.com/cockroachdb/errors"
 	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/crc"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/exp/rand"
@@ -863,6 +865,18 @@ func (w *limitedWriter) Write(p []byte) (n int, err error) {
 	return w.Writer.Write(p)
 }
 
+func TestInvalidChunkErrors(t *testing.T) {
+	errs := []error{ErrZeroedChunk, ErrInvalidChunk, ErrRecycledChunk}
+	for i, err := range errs {
+		require.True(t, errors.Is(err, base.ErrCorruption))
+		require.True(t, IsInvalidRecord(err))
+		for j, other := range errs {
+			require.Equal(t, i == j, errors.Is(errors.Wrap(err, "wrapped"), other), "%v, %v", err, other)
+		}
+		require.False(t, errors.Is(base.CorruptionErrorf("pebble: corruption"), err))
+	}
+}
+
 func TestRecycleLog(t *testing.T) {
 	const min = 16
 	const max = 4096
@@ -911,16 +925,20 @@ func TestRecycleLog(t *testing.T) {
 		for j := range sizes {
 			rr, err := r.Next()
 			if err != nil {
-				// If we limited output then an EOF, zeroed, or invalid chunk is expected.
-				if limitedBuf.limit < 0 && (err == io.EOF || err == ErrZeroedChunk || err == ErrInvalidChunk) {
+				// If we limited output then an EOF, zeroed, invalid, or recycled chunk
+				// is expected.
+				if limitedBuf.limit < 0 && (err == io.EOF || err == ErrZeroedChunk ||
+					err == ErrInvalidChunk || err == ErrRecycledChunk) {
 					break
 				}
 				t.Fatalf("%d/%d: %v", i, j, err)
 			}
 			x, err := io.ReadAll(rr)
 			if err != nil {
-				// If we limited output then an EOF, zeroed, or invalid chunk is expected.
-				if limitedBuf.limit < 0 && (err == io.EOF || err == ErrZeroedChunk || err == ErrInvalidChunk) {
+				// If we limited output then an EOF, zeroed, invalid, or recycled chunk
+				// is expected.
+				if limitedBuf.limit < 0 && (err == io.EOF || err == ErrZeroedChunk ||
+					err == ErrInvalidChunk || err == ErrRecycledChunk) {
 					break
 				}
 				t.Fatalf("%d/%d: %v", i, j, err)
@@ -929,7 +947,8 @@ func TestRecycleLog(t *testing.T) {
 				t.Fatalf("%d/%d: expected record %d, but found %d", i, j, sizes[j], len(x))
 			}
 		}
-		if _, err := r.Next(); err != io.EOF && err != ErrZeroedChunk && err != ErrInvalidChunk {
+		if _, err := r.Next(); err != io.EOF && err != ErrZeroedChunk && err != ErrInvalidChunk &&
+			err != ErrRecycledChunk {
 			t.Fatalf("%d: expected EOF, but found %v", i, err)
 		}
 	}
@@ -1040,7 +1059,87 @@ func TestRecycleLogWithPartialRecord(t *testing.T) {
 	require.NoError(t, err)
 
 	_, err = io.ReadAll(rr)
-	require.Equal(t, err, ErrInvalidChunk)
+	require.Equal(t, err, ErrRecycledChunk)
+}
+
+func TestCompressedRecords(t *testing.T) {
+	rnd := rand.New(rand.NewSource(uint64(time.Now().UnixNano())))
+	incompressible := make([]byte, 3*blockSize)
+	for i := range incompressible {
+		incompressible[i] = byte(rnd.Uint32())
+	}
+	// halfCompressible repeats every random 8 bytes once, so that its
+	// compressed payload still spans several blocks.
+	halfCompressible := make([]byte, 5*blockSize)
+	for i := 0; i < len(halfCompressible); i += 16 {
+		binary.LittleEndian.PutUint64(halfCompressible[i:], rnd.Uint64())
+		copy(halfCompressible[i+8:i+16], halfCompressible[i:i+8])
+	}
+	records := [][]byte{
+		[]byte(big("compressible", 1000)),
+		[]byte("short"),
+		halfCompressible,
+		incompressible[:100],
+		incompressible,
+		nil,
+		[]byte(big("spans blocks", 5*blockSize)),
+	}
+	total := 0
+	for _, rec := range records {
+		total += len(rec)
+	}
+
+	writeRecords := func(t *testing.T, c Compression) []byte {
+		var buf bytes.Buffer
+		w := NewLogWriter(&buf, base.DiskFileNum(1), LogWriterConfig{
+			WALFsyncLatency: prometheus.NewHistogram(prometheus.HistogramOpts{}),
+			Compression:     c,
+		})
+		for _, rec := range records {
+			_, err := w.WriteRecord(rec)
+			require.NoError(t, err)
+		}
+		require.NoError(t, w.Close())
+		return buf.Bytes()
+	}
+
+	for _, c := range []Compression{NoCompression, SnappyCompression, ZstdCompression} {
+		t.Run(c.String(), func(t *testing.T) {
+			data := writeRecords(t, c)
+			if c == NoCompression {
+				require.Greater(t, len(data), total)
+			} else {
+				require.Less(t, len(data), total-len(halfCompressible)/4)
+			}
+
+			r := NewReader(bytes.NewReader(data), base.DiskFileNum(1))
+			for i, rec := range records {
+				rr, err := r.Next()
+				require.NoError(t, err)
+				// Read the record one byte at a time, to exercise partial reads of
+				// the decompressed payload.
+				got, err := io.ReadAll(iotest.OneByteReader(rr))
+				require.NoError(t, err)
+				require.True(t, bytes.Equal(rec, got), "record %d", i)
+			}
+			_, err := r.Next()
+			require.Equal(t, io.EOF, err)
+		})
+	}
+
+	t.Run("corrupt", func(t *testing.T) {
+		data := writeRecords(t, SnappyCompression)
+		// Change the compression algorithm of the first record, recomputing the
+		// chunk's checksum so that only decompression fails.
+		require.Equal(t, byte(recyclableCompressedFullChunkType), data[6])
+		data[recyclableHeaderSize] = 0xff
+		n := int(binary.LittleEndian.Uint16(data[4:6]))
+		binary.LittleEndian.PutUint32(data[0:4], crc.New(data[6:recyclableHeaderSize+n]).Value())
+
+		r := NewReader(bytes.NewReader(data), base.DiskFileNum(1))
+		_, err := r.Next()
+		require.Equal(t, ErrInvalidChunk, err)
+	})
 }
 
 func BenchmarkRecordWrite(b *testing.B) {
@@ -6,6 +6,7 @@ package sstable
 
 import (
 	"cmp"
+	"context"
 	"slices"
 	"sync"
 	"time"
@@ -155,14 +156,18 @@ type iterStatsAccumulator struct {
 	QoSLevel
 	stats     CategoryStats
 	collector *CategoryStatsCollector
+	// trace is the ReadTrace attached to the iterator's context, if any. See
+	// readTraceFor.
+	trace *ReadTrace
 }
 
 func (accum *iterStatsAccumulator) init(
-	categoryAndQoS CategoryAndQoS, collector *CategoryStatsCollector,
+	ctx context.Context, categoryAndQoS CategoryAndQoS, collector *CategoryStatsCollector,
 ) {
 	accum.Category = categoryAndQoS.Category
 	accum.QoSLevel = categoryAndQoS.QoSLevel
 	accum.collector = collector
+	accum.trace = readTraceFromContext(ctx)
 }
 
 func (accum *iterStatsAccumulator) reportStats(
@@ -20,7 +20,7 @@ func decompressedLen(blockType blockType, b []byte) (int, int, error) {
 	case snappyCompressionBlockType:
 		l, err := snappy.DecodedLen(b)
 		return l, 0, err
-	case zstdCompressionBlockType:
+	case zstdCompressionBlockType, zstdDictCompressionBlockType:
 		// This will also be used by zlib, bzip2 and lz4 to retrieve the decodedLen
 		// if we implement these algorithms in the future.
 		decodedLenU64, varIntLen := binary.Uvarint(b)
@@ -34,8 +34,10 @@ func decompressedLen(blockType blockType, b []byte) (int, int, error) {
 }
 
 // decompressInto decompresses compressed into buf. The buf slice must have the
-// exact size as the decompressed value.
-func decompressInto(blockType blockType, compressed []byte, buf []byte) error {
+// exact size as the decompressed value. The dict is the table's compression
+// dictionary, which is required to decompress blocks of type
+// zstdDictCompressionBlockType.
+func decompressInto(blockType blockType, compressed []byte, buf []byte, dict *zstdDecompressionDict) error {
 	var result []byte
 	var err error
 	switch blockType {
@@ -43,6 +45,11 @@ func decompressInto(blockType blockType, compressed []byte, buf []byte) error {
 		result, err = snappy.Decode(buf, compressed)
 	case zstdCompressionBlockType:
 		result, err = decodeZstd(buf, compressed)
+	case zstdDictCompressionBlockType:
+		if dict == nil {
+			return base.CorruptionErrorf("pebble/table: block compressed with a missing compression dictionary")
+		}
+		result, err = dict.decode(buf, compressed)
 	default:
 		return base.CorruptionErrorf("pebble/table: unknown block compression: %d", errors.Safe(blockType))
 	}
@@ -59,7 +66,7 @@ func decompressInto(blockType blockType, compressed []byte, buf []byte) error {
 // decompressBlock decompresses an SST block, with manually-allocated space.
 // NB: If decompressBlock returns (nil, nil), no decompression was necessary and
 // the caller may use `b` directly.
-func decompressBlock(blockType blockType, b []byte) (*cache.Value, error) {
+func decompressBlock(blockType blockType, b []byte, dict *zstdDecompressionDict) (*cache.Value, error) {
 	if blockType == noCompressionBlockType {
 		return nil, nil
 	}
@@ -72,16 +79,18 @@ func decompressBlock(blockType blockType, b []byte) (*cache.Value, error) {
 	// Allocate sufficient space from the cache.
 	decoded := cache.Alloc(decodedLen)
 	decodedBuf := decoded.Buf()
-	if err := decompressInto(blockType, b, decodedBuf); err != nil {
+	if err := decompressInto(blockType, b, decodedBuf, dict); err != nil {
 		cache.Free(decoded)
 		return nil, err
 	}
 	return decoded, nil
 }
 
-// compressBlock compresses an SST block, using compressBuf as the desired destination.
+// compressBlock compresses an SST block, using compressBuf as the desired
+// destination. zstdLevel is the compression level used by ZstdCompression. If
+// dict is non-nil, ZstdCompression compresses the block using dict.
 func compressBlock(
-	compression Compression, b []byte, compressedBuf []byte,
+	compression Compression, zstdLevel int, dict *zstdDict, b []byte, compressedBuf []byte,
 ) (blockType blockType, compressed []byte) {
 	switch compression {
 	case SnappyCompression:
@@ -96,7 +105,10 @@ func compressBlock(
 	varIntLen := binary.PutUvarint(compressedBuf, uint64(len(b)))
 	switch compression {
 	case ZstdCompression:
-		return zstdCompressionBlockType, encodeZstd(compressedBuf, varIntLen, b)
+		if dict != nil {
+			return zstdDictCompressionBlockType, encodeZstd(compressedBuf, varIntLen, b, zstdLevel, dict)
+		}
+		return zstdCompressionBlockType, encodeZstd(compressedBuf, varIntLen, b, zstdLevel, nil)
 	default:
 		return noCompressionBlockType, b
 	}
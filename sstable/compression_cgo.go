@@ -9,10 +9,31 @@ package sstable
 
 import (
 	"bytes"
+	"slices"
 
 	"github.com/DataDog/zstd"
+	"github.com/cockroachdb/errors"
 )
 
+// zstdDict is a raw content dictionary prepared for compressing blocks, so
+// that the dictionary is digested once per Writer rather than once per block.
+// It is safe for concurrent use. Readers decompress with a
+// zstdDecompressionDict instead.
+type zstdDict struct {
+	raw  []byte
+	bulk *zstd.BulkProcessor
+}
+
+// newZstdDict prepares the raw content dictionary raw for compression at the
+// given level.
+func newZstdDict(raw []byte, level int) (*zstdDict, error) {
+	bulk, err := zstd.NewBulkProcessor(raw, level)
+	if err != nil {
+		return nil, errors.Wrap(err, "pebble/table: preparing compression dictionary")
+	}
+	return &zstdDict{raw: raw, bulk: bulk}, nil
+}
+
 // decodeZstd decompresses src with the Zstandard algorithm. The destination
 // buffer must already be sufficiently sized, otherwise decodeZstd may error.
 func decodeZstd(dst, src []byte) ([]byte, error) {
@@ -24,14 +45,26 @@ func decodeZstd(dst, src []byte) ([]byte, error) {
 	return dst[:n], nil
 }
 
-// encodeZstd compresses b with the Zstandard algorithm at default compression
-// level (level 3). It reuses the preallocated capacity of compressedBuf if it
-// is sufficient. The subslice `compressedBuf[:varIntLen]` should already encode
-// the length of `b` before calling encodeZstd. It returns the encoded byte
-// slice, including the `compressedBuf[:varIntLen]` prefix.
-func encodeZstd(compressedBuf []byte, varIntLen int, b []byte) []byte {
+// encodeZstd compresses b with the Zstandard algorithm at the given
+// compression level, using the dictionary dict if non-nil, in which case the
+// level the dictionary was prepared with is used instead. It reuses the
+// preallocated capacity of compressedBuf if it is sufficient. The subslice
+// `compressedBuf[:varIntLen]` should already encode the length of `b` before
+// calling encodeZstd. It returns the encoded byte slice, including the
+// `compressedBuf[:varIntLen]` prefix.
+func encodeZstd(compressedBuf []byte, varIntLen int, b []byte, level int, dict *zstdDict) []byte {
+	if dict != nil {
+		// Compress writes in place only if the destination can hold the
+		// worst-case compressed size.
+		compressedBuf = slices.Grow(compressedBuf[:varIntLen], zstd.CompressBound(len(b)))
+		compressed, err := dict.bulk.Compress(compressedBuf[varIntLen:varIntLen], b)
+		if err != nil {
+			panic(errors.Wrap(err, "pebble/table: compressing block with dictionary"))
+		}
+		return compressedBuf[:varIntLen+len(compressed)]
+	}
 	buf := bytes.NewBuffer(compressedBuf[:varIntLen])
-	writer := zstd.NewWriterLevel(buf, 3)
+	writer := zstd.NewWriterLevel(buf, level)
 	writer.Write(b)
 	writer.Close()
 	return buf.Bytes()
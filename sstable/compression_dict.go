@@ -0,0 +1,40 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"github.com/cockroachdb/errors"
+	"github.com/klauspost/compress/zstd"
+)
+
+// zstdDecompressionDict is a raw content dictionary prepared for decompressing
+// blocks. A Reader holds one for as long as its table is open, so it holds no
+// compression state, and it is prepared with klauspost/compress regardless of
+// cgo so that the dictionary's memory is accounted for in the Go heap. It is
+// safe for concurrent use.
+type zstdDecompressionDict struct {
+	raw     []byte
+	decoder *zstd.Decoder
+}
+
+// newZstdDecompressionDict prepares the raw content dictionary raw for
+// decompression.
+func newZstdDecompressionDict(raw []byte) (*zstdDecompressionDict, error) {
+	decoder, err := zstd.NewReader(nil, zstd.WithDecoderDictRaw(0, raw), zstd.WithDecoderLowmem(true))
+	if err != nil {
+		return nil, errors.Wrap(err, "pebble/table: preparing compression dictionary")
+	}
+	return &zstdDecompressionDict{raw: raw, decoder: decoder}, nil
+}
+
+// decode decompresses src into dst, which must already be sufficiently sized.
+func (d *zstdDecompressionDict) decode(dst, src []byte) ([]byte, error) {
+	return d.decoder.DecodeAll(src, dst[:0])
+}
+
+// close releases the resources held by the dictionary.
+func (d *zstdDecompressionDict) close() {
+	d.decoder.Close()
+}
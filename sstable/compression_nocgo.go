@@ -7,7 +7,30 @@
 
 package sstable
 
-import "github.com/klauspost/compress/zstd"
+import (
+	"github.com/cockroachdb/errors"
+	"github.com/klauspost/compress/zstd"
+)
+
+// zstdDict is a raw content dictionary prepared for compressing blocks, so
+// that the dictionary is digested once per Writer rather than once per block.
+// It is safe for concurrent use. Readers decompress with a
+// zstdDecompressionDict instead.
+type zstdDict struct {
+	raw     []byte
+	encoder *zstd.Encoder
+}
+
+// newZstdDict prepares the raw content dictionary raw for compression at the
+// given level, mapped to the closest level supported by klauspost/compress.
+func newZstdDict(raw []byte, level int) (*zstdDict, error) {
+	encoder, err := zstd.NewWriter(nil,
+		zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)), zstd.WithEncoderDictRaw(0, raw))
+	if err != nil {
+		return nil, errors.Wrap(err, "pebble/table: preparing compression dictionary")
+	}
+	return &zstdDict{raw: raw, encoder: encoder}, nil
+}
 
 // decodeZstd decompresses src with the Zstandard algorithm. The destination
 // buffer must already be sufficiently sized, otherwise decodeZstd may error.
@@ -17,13 +40,19 @@ func decodeZstd(dst, src []byte) ([]byte, error) {
 	return decoder.DecodeAll(src, dst[:0])
 }
 
-// encodeZstd compresses b with the Zstandard algorithm at default compression
-// level (level 3). It reuses the preallocated capacity of compressedBuf if it
-// is sufficient. The subslice `compressedBuf[:varIntLen]` should already encode
-// the length of `b` before calling encodeZstd. It returns the encoded byte
-// slice, including the `compressedBuf[:varIntLen]` prefix.
-func encodeZstd(compressedBuf []byte, varIntLen int, b []byte) []byte {
-	encoder, _ := zstd.NewWriter(nil)
+// encodeZstd compresses b with the Zstandard algorithm at the given
+// compression level, mapped to the closest level supported by
+// klauspost/compress, using the dictionary dict if non-nil, in which case the
+// level the dictionary was prepared with is used instead. It reuses the
+// preallocated capacity of compressedBuf if it is sufficient. The subslice
+// `compressedBuf[:varIntLen]` should already encode the length of `b` before
+// calling encodeZstd. It returns the encoded byte slice, including the
+// `compressedBuf[:varIntLen]` prefix.
+func encodeZstd(compressedBuf []byte, varIntLen int, b []byte, level int, dict *zstdDict) []byte {
+	if dict != nil {
+		return dict.encoder.EncodeAll(b, compressedBuf[:varIntLen])
+	}
+	encoder, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
 	defer encoder.Close()
 	return encoder.EncodeAll(b, compressedBuf[:varIntLen])
 }
@@ -6,6 +6,7 @@ package sstable
 
 import (
 	"encoding/binary"
+	"fmt"
 	"math/rand"
 	"testing"
 	"time"
@@ -27,8 +28,8 @@ func TestCompressionRoundtrip(t *testing.T) {
 			// not sufficient, compressBlock should allocate one that is.
 			compressedBuf := make([]byte, rng.Intn(1<<10 /* 1 KiB */))
 
-			btyp, compressed := compressBlock(compression, payload, compressedBuf)
-			v, err := decompressBlock(btyp, compressed)
+			btyp, compressed := compressBlock(compression, DefaultZstdLevel, nil /* dict */, payload, compressedBuf)
+			v, err := decompressBlock(btyp, compressed, nil /* dict */)
 			require.NoError(t, err)
 			got := payload
 			if v != nil {
@@ -40,6 +41,29 @@ func TestCompressionRoundtrip(t *testing.T) {
 	}
 }
 
+func TestZstdLevelRoundtrip(t *testing.T) {
+	seed := time.Now().UnixNano()
+	t.Logf("seed %d", seed)
+	rng := rand.New(rand.NewSource(seed))
+
+	// A payload drawn from a small alphabet compresses at every level.
+	payload := make([]byte, 32<<10)
+	for i := range payload {
+		payload[i] = 'a' + byte(rng.Intn(4))
+	}
+	for _, level := range []int{1, DefaultZstdLevel, 9, MaxZstdLevel} {
+		t.Run(fmt.Sprint(level), func(t *testing.T) {
+			btyp, compressed := compressBlock(ZstdCompression, level, nil /* dict */, payload, nil)
+			require.Equal(t, zstdCompressionBlockType, btyp)
+			require.Less(t, len(compressed), len(payload)/2)
+			v, err := decompressBlock(btyp, compressed, nil /* dict */)
+			require.NoError(t, err)
+			require.Equal(t, payload, v.Buf())
+			cache.Free(v)
+		})
+	}
+}
+
 // TestDecompressionError tests that a decompressing a value that does not
 // decompress returns an error.
 func TestDecompressionError(t *testing.T) {
@@ -53,7 +77,7 @@ func TestDecompressionError(t *testing.T) {
 	fauxCompressed = fauxCompressed[:n+compressedPayloadLen]
 	rng.Read(fauxCompressed[n:])
 
-	v, err := decompressBlock(zstdCompressionBlockType, fauxCompressed)
+	v, err := decompressBlock(zstdCompressionBlockType, fauxCompressed, nil /* dict */)
 	t.Log(err)
 	require.Error(t, err)
 	require.Nil(t, v)
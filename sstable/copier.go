@@ -66,7 +66,17 @@ func CopySpan(
 		o.FilterPolicy = nil
 	}
 	o.TableFormat = r.tableFormat
+	// The copied data blocks keep their checksums, so the output must use the
+	// input's checksum algorithm.
+	o.Checksum = r.checksumType
 	w := NewWriter(output, o)
+	// The copied data blocks may have been compressed with the input's
+	// compression dictionary, which the output must then include too. The
+	// copier compresses no blocks itself, so the dictionary is not prepared
+	// for compression.
+	if r.compressionDict != nil {
+		w.layout.compressionDict = &zstdDict{raw: r.compressionDict.raw}
+	}
 
 	// We don't want the writer to attempt to write out block property data in
 	// index blocks. This data won't be valid since we're not passing the actual
@@ -25,6 +25,7 @@ const (
 	TableFormatPebblev2 // Range keys.
 	TableFormatPebblev3 // Value blocks.
 	TableFormatPebblev4 // DELSIZED tombstones.
+	TableFormatPebblev5 // Compression dictionaries.
 	NumTableFormats
 
 	TableFormatMax = NumTableFormats - 1
@@ -208,6 +209,11 @@ const (
 //     RANGEDELs when a Pebble-external writer is trying to construct a strict
 //     obsolete sstable.
 
+// TableFormatPebblev5 introduces compression dictionaries. A table may contain
+// a zstd dictionary in a meta block, with which its data blocks are compressed
+// (see WriterOptions.CompressionDictSize). Such data blocks use a block type
+// that readers of earlier formats do not understand.
+
 // ParseTableFormat parses the given magic bytes and version into its
 // corresponding internal TableFormat.
 func ParseTableFormat(magic []byte, version uint32) (TableFormat, error) {
@@ -231,6 +237,8 @@ func ParseTableFormat(magic []byte, version uint32) (TableFormat, error) {
 			return TableFormatPebblev3, nil
 		case 4:
 			return TableFormatPebblev4, nil
+		case 5:
+			return TableFormatPebblev5, nil
 		default:
 			return TableFormatUnspecified, base.CorruptionErrorf(
 				"pebble/table: unsupported pebble format version %d", errors.Safe(version),
@@ -258,6 +266,8 @@ func (f TableFormat) AsTuple() (string, uint32) {
 		return pebbleDBMagic, 3
 	case TableFormatPebblev4:
 		return pebbleDBMagic, 4
+	case TableFormatPebblev5:
+		return pebbleDBMagic, 5
 	default:
 		panic("sstable: unknown table format version tuple")
 	}
@@ -278,6 +288,8 @@ func (f TableFormat) String() string {
 		return "(Pebble,v3)"
 	case TableFormatPebblev4:
 		return "(Pebble,v4)"
+	case TableFormatPebblev5:
+		return "(Pebble,v5)"
 	default:
 		panic("sstable: unknown table format version tuple")
 	}
@@ -28,18 +28,19 @@ type Layout struct {
 	// ValidateBlockChecksums, which validates a static list of BlockHandles
 	// referenced in this struct.
 
-	Data       []BlockHandleWithProperties
-	Index      []block.Handle
-	TopIndex   block.Handle
-	Filter     block.Handle
-	RangeDel   block.Handle
-	RangeKey   block.Handle
-	ValueBlock []block.Handle
-	ValueIndex block.Handle
-	Properties block.Handle
-	MetaIndex  block.Handle
-	Footer     block.Handle
-	Format     TableFormat
+	Data            []BlockHandleWithProperties
+	Index           []block.Handle
+	TopIndex        block.Handle
+	Filter          block.Handle
+	RangeDel        block.Handle
+	RangeKey        block.Handle
+	ValueBlock      []block.Handle
+	ValueIndex      block.Handle
+	CompressionDict block.Handle
+	Properties      block.Handle
+	MetaIndex       block.Handle
+	Footer          block.Handle
+	Format          TableFormat
 }
 
 // Describe returns a description of the layout. If the verbose parameter is
@@ -78,6 +79,9 @@ func (l *Layout) Describe(
 	if l.ValueIndex.Length != 0 {
 		blocks = append(blocks, namedBlockHandle{l.ValueIndex, "value-index"})
 	}
+	if l.CompressionDict.Length != 0 {
+		blocks = append(blocks, namedBlockHandle{l.CompressionDict, "compression-dict"})
+	}
 	if l.Properties.Length != 0 {
 		blocks = append(blocks, namedBlockHandle{l.Properties, "properties"})
 	}
@@ -108,7 +112,7 @@ func (l *Layout) Describe(
 		if !verbose {
 			continue
 		}
-		if b.name == "filter" {
+		if b.name == "filter" || b.name == "compression-dict" {
 			continue
 		}
 
@@ -302,7 +306,12 @@ type layoutWriter struct {
 	cache        *cache.Cache
 	tableFormat  TableFormat
 	compression  Compression
+	zstdLevel    int
 	checksumType block.ChecksumType
+	// compressionDict is the dictionary with which data blocks are compressed,
+	// if any. It's set by the Writer once it has built the dictionary and is
+	// written to the table by WriteCompressionDictBlock.
+	compressionDict *zstdDict
 	// lastIndexBlockHandle holds the handle to the most recently-written index
 	// block.  It's updated by writeIndexBlock. When writing sstables with a
 	// single-level index, this field will be updated once. When writing
@@ -321,6 +330,7 @@ func makeLayoutWriter(w objstorage.Writable, opts WriterOptions) layoutWriter {
 		cache:        opts.Cache,
 		tableFormat:  opts.TableFormat,
 		compression:  opts.Compression,
+		zstdLevel:    opts.ZstdLevel,
 		checksumType: opts.Checksum,
 		buf: blockBuf{
 			checksummer: block.Checksummer{Type: opts.Checksum},
@@ -345,7 +355,7 @@ func (w *layoutWriter) Abort() {
 // WriteDataBlock constructs a trailer for the provided data block and writes
 // the block and trailer to the writer. It returns the block's handle.
 func (w *layoutWriter) WriteDataBlock(b []byte, buf *blockBuf) (block.Handle, error) {
-	return w.writeBlock(b, w.compression, buf)
+	return w.writeBlock(b, w.compression, w.compressionDict, buf)
 }
 
 // WritePrecompressedDataBlock writes a pre-compressed data block and its
@@ -371,7 +381,7 @@ func (w *layoutWriter) WritePrecompressedDataBlock(
 // the last-written index block's handle and adds it to the file's meta index
 // when the writer is finished.
 func (w *layoutWriter) WriteIndexBlock(b []byte) (block.Handle, error) {
-	h, err := w.writeBlock(b, w.compression, &w.buf)
+	h, err := w.writeBlock(b, w.compression, nil, &w.buf)
 	if err == nil {
 		w.lastIndexBlockHandle = h
 	}
@@ -411,8 +421,18 @@ func (w *layoutWriter) WriteRangeDeletionBlock(b []byte) (block.Handle, error) {
 	return w.writeNamedBlock(b, metaRangeDelV2Name)
 }
 
+// WriteCompressionDictBlock writes the dictionary with which data blocks were
+// compressed, if any, to the writer. It automatically adds the dictionary
+// block to the file's meta index when the writer is finished.
+func (w *layoutWriter) WriteCompressionDictBlock() (block.Handle, error) {
+	if w.compressionDict == nil {
+		return block.Handle{}, nil
+	}
+	return w.writeNamedBlock(w.compressionDict.raw, metaCompressionDictName)
+}
+
 func (w *layoutWriter) writeNamedBlock(b []byte, name string) (bh block.Handle, err error) {
-	bh, err = w.writeBlock(b, NoCompression, &w.buf)
+	bh, err = w.writeBlock(b, NoCompression, nil, &w.buf)
 	if err == nil {
 		w.recordToMetaindex(name, bh)
 	}
@@ -459,9 +479,9 @@ func (w *layoutWriter) WriteValueIndexBlock(
 }
 
 func (w *layoutWriter) writeBlock(
-	b []byte, compression Compression, buf *blockBuf,
+	b []byte, compression Compression, dict *zstdDict, buf *blockBuf,
 ) (block.Handle, error) {
-	blk, trailer := compressAndChecksum(b, compression, buf)
+	blk, trailer := compressAndChecksum(b, compression, w.zstdLevel, dict, buf)
 	bh := block.Handle{Offset: w.offset, Length: uint64(len(blk))}
 	w.clearFromCache(bh.Offset)
 
@@ -526,7 +546,7 @@ func (w *layoutWriter) Finish() (size uint64, err error) {
 	for _, h := range w.handles {
 		bw.AddRaw(unsafe.Slice(unsafe.StringData(h.key), len(h.key)), h.encodedBlockHandle)
 	}
-	metaIndexHandle, err := w.writeBlock(bw.Finish(), NoCompression, &w.buf)
+	metaIndexHandle, err := w.writeBlock(bw.Finish(), NoCompression, nil, &w.buf)
 	if err != nil {
 		return 0, err
 	}
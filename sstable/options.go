@@ -27,6 +27,13 @@ const (
 	NCompression
 )
 
+// DefaultZstdLevel is the Zstandard compression level used when
+// WriterOptions.ZstdLevel is unset.
+const DefaultZstdLevel = 3
+
+// MaxZstdLevel is the highest supported Zstandard compression level.
+const MaxZstdLevel = 22
+
 var ignoredInternalProperties = map[string]struct{}{
 	"rocksdb.column.family.id":             {},
 	"rocksdb.fixed.key.length":             {},
@@ -186,6 +193,25 @@ type WriterOptions struct {
 	// The default value (DefaultCompression) uses snappy compression.
 	Compression Compression
 
+	// ZstdLevel is the Zstandard compression level, between 1 and MaxZstdLevel,
+	// used when Compression is ZstdCompression. Higher levels compress better
+	// but more slowly. The level does not affect decompression.
+	//
+	// The default value is DefaultZstdLevel.
+	ZstdLevel int
+
+	// CompressionDictSize is the maximum size of the compression dictionary
+	// built for the table's data blocks. When non-zero, the Writer samples the
+	// first data blocks of the table to build a dictionary that all of the
+	// table's data blocks are compressed with, and stores it in the table. The
+	// dictionary is raw content taken from the sampled blocks rather than a
+	// trained zstd dictionary. A dictionary helps small blocks of similar
+	// values compress well. It's only used when Compression is ZstdCompression
+	// and TableFormat is at least TableFormatPebblev5.
+	//
+	// The default value (0) disables compression dictionaries.
+	CompressionDictSize int
+
 	// FilterPolicy defines a filter algorithm (such as a Bloom filter) that can
 	// reduce disk reads for Get calls.
 	//
@@ -291,6 +317,15 @@ func (o WriterOptions) ensureDefaults() WriterOptions {
 	if o.Compression <= DefaultCompression || o.Compression >= NCompression {
 		o.Compression = SnappyCompression
 	}
+	if o.ZstdLevel <= 0 {
+		o.ZstdLevel = DefaultZstdLevel
+	} else if o.ZstdLevel > MaxZstdLevel {
+		o.ZstdLevel = MaxZstdLevel
+	}
+	if o.CompressionDictSize < 0 || o.Compression != ZstdCompression ||
+		o.TableFormat < TableFormatPebblev5 {
+		o.CompressionDictSize = 0
+	}
 	if o.IndexBlockSize <= 0 {
 		o.IndexBlockSize = o.BlockSize
 	}
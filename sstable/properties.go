@@ -130,6 +130,9 @@ type Properties struct {
 	// fields of CommonProperties in Properties.
 	CommonProperties `prop:"pebble.embbeded_common_properties"`
 
+	// The name of the checksum algorithm used for the table's blocks. Only
+	// serialized if the algorithm is not crc32c.
+	ChecksumName string `prop:"pebble.checksum"`
 	// The name of the comparer used in this table.
 	ComparerName string `prop:"rocksdb.comparator"`
 	// The total size of all data blocks.
@@ -331,6 +334,9 @@ func (p *Properties) save(tblFormat TableFormat, w *rowblk.Writer) {
 		m[k] = []byte(v)
 	}
 
+	if p.ChecksumName != "" {
+		p.saveString(m, unsafe.Offsetof(p.ChecksumName), p.ChecksumName)
+	}
 	if p.ComparerName != "" {
 		p.saveString(m, unsafe.Offsetof(p.ComparerName), p.ComparerName)
 	}
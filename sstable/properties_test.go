@@ -68,6 +68,7 @@ var testProps = Properties{
 		CompressionName:    "compression name",
 		CompressionOptions: "compression option",
 	},
+	ChecksumName:           "checksum name",
 	ComparerName:           "comparator name",
 	DataSize:               3,
 	FilterPolicyName:       "filter policy name",
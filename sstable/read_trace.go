@@ -0,0 +1,93 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package sstable
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/pebble/internal/base"
+)
+
+// BlockRead describes a block read by an operation traced with a ReadTrace.
+type BlockRead struct {
+	// FileNum is the backing file from which the block was read.
+	FileNum base.DiskFileNum
+	// Offset and Length locate the block within the file, excluding its
+	// trailer.
+	Offset, Length uint64
+	// CacheHit is true if the block was found in the block cache.
+	CacheHit bool
+	// Duration is the time spent reading the block from storage. It is zero
+	// for cache hits.
+	Duration time.Duration
+}
+
+// ReadTrace records the blocks read, and so the files touched, by operations
+// performed with a context returned by WithReadTrace. It is intended for
+// diagnosing individual slow reads, and is safe for concurrent use.
+type ReadTrace struct {
+	mu     sync.Mutex
+	blocks []BlockRead
+}
+
+type readTraceKey struct{}
+
+// WithReadTrace returns a context that records the blocks read by the sstable
+// reads performed with it, for example by an iterator created with
+// DB.NewIterWithContext, into t.
+func WithReadTrace(ctx context.Context, t *ReadTrace) context.Context {
+	return context.WithValue(ctx, readTraceKey{}, t)
+}
+
+// readTraceFromContext returns the ReadTrace attached to ctx by WithReadTrace,
+// or nil.
+func readTraceFromContext(ctx context.Context) *ReadTrace {
+	if ctx == nil {
+		return nil
+	}
+	t, _ := ctx.Value(readTraceKey{}).(*ReadTrace)
+	return t
+}
+
+// readTraceFor returns the ReadTrace into which to record a block read with
+// ctx on behalf of the iterator owning iterStats, if any. An iterator's trace
+// is resolved once, when its context is set, as looking up a context value is
+// too expensive for every block read.
+func readTraceFor(ctx context.Context, iterStats *iterStatsAccumulator) *ReadTrace {
+	if iterStats != nil {
+		return iterStats.trace
+	}
+	return readTraceFromContext(ctx)
+}
+
+func (t *ReadTrace) record(b BlockRead) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.blocks = append(t.blocks, b)
+}
+
+// Blocks returns the blocks read so far, in the order in which they were
+// read.
+func (t *ReadTrace) Blocks() []BlockRead {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return slices.Clone(t.blocks)
+}
+
+// Files returns the backing files from which blocks have been read so far, in
+// increasing order.
+func (t *ReadTrace) Files() []base.DiskFileNum {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	files := make([]base.DiskFileNum, 0, len(t.blocks))
+	for i := range t.blocks {
+		files = append(files, t.blocks[i].FileNum)
+	}
+	slices.Sort(files)
+	return slices.Compact(files)
+}
@@ -185,6 +185,7 @@ type Reader struct {
 	rangeDelBH   block.Handle
 	rangeKeyBH   block.Handle
 	valueBIH     valueBlocksIndexHandle
+	dictBH       block.Handle
 	propertiesBH block.Handle
 	metaIndexBH  block.Handle
 	footerBH     block.Handle
@@ -194,6 +195,10 @@ type Reader struct {
 	FormatKey    base.FormatKey
 	Split        Split
 	tableFilter  *tableFilterReader
+	// compressionDict is the dictionary with which the table's data blocks were
+	// compressed, if any, prepared once for decompressing all of them. See
+	// TableFormatPebblev5.
+	compressionDict *zstdDecompressionDict
 	// Keep types that are not multiples of 8 bytes at the end and with
 	// decreasing size.
 	Properties    Properties
@@ -216,6 +221,9 @@ var _ CommonReader = (*Reader)(nil)
 // Close the reader and the underlying objstorage.Readable.
 func (r *Reader) Close() error {
 	r.opts.Cache.Unref()
+	if r.compressionDict != nil {
+		r.compressionDict.close()
+	}
 
 	if r.readable != nil {
 		r.err = firstError(r.err, r.readable.Close())
@@ -517,6 +525,9 @@ func (r *Reader) readBlock(
 		if iterStats != nil {
 			iterStats.reportStats(bh.Length, bh.Length, 0)
 		}
+		if t := readTraceFor(ctx, iterStats); t != nil {
+			t.record(BlockRead{FileNum: r.fileNum, Offset: bh.Offset, Length: bh.Length, CacheHit: true})
+		}
 		// This block is already in the cache; return a handle to existing vlaue
 		// in the cache.
 		return block.CacheBufferHandle(h), nil
@@ -557,6 +568,9 @@ func (r *Reader) readBlock(
 		stats.BlockBytes += bh.Length
 		stats.BlockReadDuration += readDuration
 	}
+	if t := readTraceFor(ctx, iterStats); t != nil {
+		t.record(BlockRead{FileNum: r.fileNum, Offset: bh.Offset, Length: bh.Length, Duration: readDuration})
+	}
 	if err != nil {
 		compressed.Release()
 		return block.BufferHandle{}, err
@@ -581,7 +595,7 @@ func (r *Reader) readBlock(
 		}
 
 		decompressed = block.Alloc(decodedLen, bufferPool)
-		if err := decompressInto(typ, compressed.Get()[prefixLen:], decompressed.Get()); err != nil {
+		if err := decompressInto(typ, compressed.Get()[prefixLen:], decompressed.Get(), r.compressionDict); err != nil {
 			compressed.Release()
 			return block.BufferHandle{}, err
 		}
@@ -699,6 +713,21 @@ func (r *Reader) readMetaindex(metaindexBH block.Handle, readHandle objstorage.R
 		r.rangeKeyBH = bh
 	}
 
+	if bh, ok := meta[metaCompressionDictName]; ok {
+		b, err = r.readBlock(
+			context.Background(), bh, nil /* transform */, readHandle, nil, /* stats */
+			nil /* iterStats */, &r.metaBufferPool)
+		if err != nil {
+			return err
+		}
+		r.dictBH = bh
+		r.compressionDict, err = newZstdDecompressionDict(slices.Clone(b.Get()))
+		b.Release()
+		if err != nil {
+			return err
+		}
+	}
+
 	for name, fp := range r.opts.Filters {
 		types := []struct {
 			ftype  FilterType
@@ -736,15 +765,16 @@ func (r *Reader) Layout() (*Layout, error) {
 	}
 
 	l := &Layout{
-		Data:       make([]BlockHandleWithProperties, 0, r.Properties.NumDataBlocks),
-		Filter:     r.filterBH,
-		RangeDel:   r.rangeDelBH,
-		RangeKey:   r.rangeKeyBH,
-		ValueIndex: r.valueBIH.h,
-		Properties: r.propertiesBH,
-		MetaIndex:  r.metaIndexBH,
-		Footer:     r.footerBH,
-		Format:     r.tableFormat,
+		Data:            make([]BlockHandleWithProperties, 0, r.Properties.NumDataBlocks),
+		Filter:          r.filterBH,
+		RangeDel:        r.rangeDelBH,
+		RangeKey:        r.rangeKeyBH,
+		ValueIndex:      r.valueBIH.h,
+		CompressionDict: r.dictBH,
+		Properties:      r.propertiesBH,
+		MetaIndex:       r.metaIndexBH,
+		Footer:          r.footerBH,
+		Format:          r.tableFormat,
 	}
 
 	indexH, err := r.readIndex(context.Background(), nil, nil, nil)
@@ -854,7 +884,7 @@ func (r *Reader) ValidateBlockChecksums() error {
 		blocks[i] = l.Data[i].Handle
 	}
 	blocks = append(blocks, l.Index...)
-	blocks = append(blocks, l.TopIndex, l.Filter, l.RangeDel, l.RangeKey, l.Properties, l.MetaIndex)
+	blocks = append(blocks, l.TopIndex, l.Filter, l.RangeDel, l.RangeKey, l.CompressionDict, l.Properties, l.MetaIndex)
 
 	// Sorting by offset ensures we are performing a sequential scan of the
 	// file.
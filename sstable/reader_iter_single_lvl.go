@@ -198,7 +198,7 @@ func (i *singleLevelIterator) init(
 	if r.err != nil {
 		return r.err
 	}
-	i.iterStats.init(categoryAndQoS, statsCollector)
+	i.iterStats.init(ctx, categoryAndQoS, statsCollector)
 	i.indexFilterRH = objstorageprovider.UsePreallocatedReadHandle(
 		ctx, r.readable, objstorage.ReadBeforeForIndexAndFilter, &i.indexFilterRHPrealloc)
 	indexH, err := r.readIndex(ctx, i.indexFilterRH, stats, &i.iterStats)
@@ -410,6 +410,7 @@ func (i *singleLevelIterator) SetBounds(lower, upper []byte) {
 
 func (i *singleLevelIterator) SetContext(ctx context.Context) {
 	i.ctx = ctx
+	i.iterStats.trace = readTraceFromContext(ctx)
 }
 
 // loadBlock loads the block at the current index position and leaves i.data
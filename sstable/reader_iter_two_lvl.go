@@ -154,7 +154,7 @@ func (i *twoLevelIterator) init(
 	if r.err != nil {
 		return r.err
 	}
-	i.iterStats.init(categoryAndQoS, statsCollector)
+	i.iterStats.init(ctx, categoryAndQoS, statsCollector)
 	i.indexFilterRH = objstorageprovider.UsePreallocatedReadHandle(
 		ctx, r.readable, objstorage.ReadBeforeForIndexAndFilter, &i.indexFilterRHPrealloc)
 	topLevelIndexH, err := r.readIndex(ctx, i.indexFilterRH, stats, &i.iterStats)
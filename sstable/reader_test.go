@@ -585,6 +585,7 @@ func TestReaderStats(t *testing.T) {
 			TableFormatPebblev2:    "testdata/readerstats_LevelDB",
 			TableFormatPebblev3:    "testdata/readerstats_Pebblev3",
 			TableFormatPebblev4:    "testdata/readerstats_Pebblev3",
+			TableFormatPebblev5:    "testdata/readerstats_Pebblev3",
 		}, func(t *testing.T, format TableFormat, dir string) {
 			if dir == "" {
 				t.Skip()
@@ -617,6 +618,7 @@ func TestReaderWithBlockPropertyFilter(t *testing.T) {
 			TableFormatPebblev2:    "testdata/reader_bpf/Pebblev2",
 			TableFormatPebblev3:    "testdata/reader_bpf/Pebblev3",
 			TableFormatPebblev4:    "testdata/reader_bpf/Pebblev3",
+			TableFormatPebblev5:    "testdata/reader_bpf/Pebblev3",
 		}, func(t *testing.T, format TableFormat, dir string) {
 			if dir == "" {
 				t.Skip("Block-properties unsupported")
@@ -1484,6 +1486,11 @@ func TestReaderChecksumErrors(t *testing.T) {
 						layout, err = r.Layout()
 						require.NoError(t, err)
 						require.EqualValues(t, len(layout.Data), 3)
+						if checksumType == block.ChecksumTypeCRC32c {
+							require.Empty(t, r.Properties.ChecksumName)
+						} else {
+							require.Equal(t, checksumType.String(), r.Properties.ChecksumName)
+						}
 						require.NoError(t, r.Close())
 					}
 
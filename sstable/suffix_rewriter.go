@@ -101,6 +101,17 @@ func rewriteKeySuffixesInBlocks(
 		}
 	}()
 
+	// The rewritten data blocks bypass the Writer's sampling of data blocks
+	// for a compression dictionary, so they're compressed with the input's
+	// dictionary, if it has one and a dictionary is wanted.
+	if r.compressionDict != nil && w.compressionDictSize > 0 {
+		dict, err := newZstdDict(r.compressionDict.raw, w.zstdLevel)
+		if err != nil {
+			return nil, TableFormatUnspecified, err
+		}
+		w.layout.compressionDict = dict
+	}
+
 	for _, c := range w.blockPropCollectors {
 		if !c.SupportsSuffixReplacement() {
 			return nil, TableFormatUnspecified,
@@ -156,6 +167,8 @@ func rewriteBlocks(
 	restartInterval int,
 	checksumType block.ChecksumType,
 	compression Compression,
+	zstdLevel int,
+	dict *zstdDict,
 	input []BlockHandleWithProperties,
 	output []blockWithSpan,
 	totalWorkers, worker int,
@@ -247,7 +260,7 @@ func rewriteBlocks(
 
 		keyAlloc, output[i].end = cloneKeyWithBuf(scratch, keyAlloc)
 
-		finished, trailer := compressAndChecksum(bw.Finish(), compression, &buf)
+		finished, trailer := compressAndChecksum(bw.Finish(), compression, zstdLevel, dict, &buf)
 
 		// copy our finished block into the output buffer.
 		blockAlloc, output[i].data = blockAlloc.Alloc(len(finished))
@@ -299,6 +312,8 @@ func rewriteDataBlocksToWriter(
 				w.dataBlockBuf.dataBlock.RestartInterval,
 				w.blockBuf.checksummer.Type,
 				w.compression,
+				w.zstdLevel,
+				w.layout.compressionDict,
 				data,
 				blocks,
 				concurrency,
@@ -526,7 +541,7 @@ func readBlockBuf(r *Reader, bh block.Handle, buf []byte) ([]byte, []byte, error
 		buf = make([]byte, decompressedLen)
 	}
 	dst := buf[:decompressedLen]
-	err = decompressInto(typ, raw[prefix:], dst)
+	err = decompressInto(typ, raw[prefix:], dst, r.compressionDict)
 	return dst, buf, err
 }
 
@@ -68,7 +68,7 @@ func TestRewriteSuffixProps(t *testing.T) {
 
 			var sstBytes [2][]byte
 			adjustPropsForEffectiveFormat := func(effectiveFormat TableFormat) {
-				if effectiveFormat == TableFormatPebblev4 {
+				if effectiveFormat >= TableFormatPebblev4 {
 					expectedProps["obsolete-key"] = string([]byte{3})
 				} else {
 					delete(expectedProps, "obsolete-key")
@@ -144,6 +144,53 @@ func TestRewriteSuffixProps(t *testing.T) {
 	}
 }
 
+func TestRewriteSuffixCompressionDict(t *testing.T) {
+	from, to := []byte("_212"), []byte("_646")
+	wOpts := WriterOptions{
+		BlockSize:           256,
+		Comparer:            test4bSuffixComparer,
+		Compression:         ZstdCompression,
+		CompressionDictSize: 1 << 10,
+		TableFormat:         TableFormatPebblev5,
+	}
+	const keyCount = 10000
+	sst := make4bSuffixTestSST(t, wOpts, from, keyCount, 0 /* rangeKeys */)
+	readerOpts := ReaderOptions{Comparer: test4bSuffixComparer}
+	r, err := NewMemReader(sst, readerOpts)
+	require.NoError(t, err)
+	defer r.Close()
+	require.NotNil(t, r.compressionDict)
+
+	rewrittenSST := &objstorage.MemObj{}
+	_, _, err = rewriteKeySuffixesInBlocks(r, rewrittenSST, wOpts, from, to, 4)
+	require.NoError(t, err)
+	rRewritten, err := NewMemReader(rewrittenSST.Data(), readerOpts)
+	require.NoError(t, err)
+	defer rRewritten.Close()
+	require.NoError(t, rRewritten.ValidateBlockChecksums())
+
+	// The rewritten data blocks are compressed with the input's dictionary,
+	// which the output includes.
+	l, err := rRewritten.Layout()
+	require.NoError(t, err)
+	require.NotZero(t, l.CompressionDict.Length)
+	require.Equal(t, r.compressionDict.raw, rRewritten.compressionDict.raw)
+	for _, bh := range l.Data {
+		typ := blockType(rewrittenSST.Data()[bh.Offset+bh.Length])
+		require.Equal(t, zstdDictCompressionBlockType, typ)
+	}
+
+	it, err := rRewritten.NewIter(NoTransforms, nil, nil)
+	require.NoError(t, err)
+	n := 0
+	for kv := it.First(); kv != nil; kv = it.Next() {
+		require.Equal(t, to, kv.K.UserKey[len(kv.K.UserKey)-len(to):])
+		n++
+	}
+	require.NoError(t, it.Close())
+	require.Equal(t, keyCount, n)
+}
+
 func make4bSuffixTestSST(
 	t testing.TB, writerOpts WriterOptions, suffix []byte, keys int, rangeKeys int,
 ) []byte {
@@ -182,6 +182,11 @@ Data blocks have some additional features:
     in the context of that sstable (for a reader that reads at a higher seqnum
     than the highest seqnum in the sstable). For details, see the comment in
     format.go.
+
+- For TableFormatPebblev5 onwards:
+  - Data blocks may be compressed with a zstd dictionary, stored in the
+    pebble.compression_dict meta block. Such blocks have the
+    zstdDictCompressionBlockType block type.
 */
 
 const (
@@ -209,11 +214,12 @@ const (
 	levelDBFormatVersion  = 0
 	rocksDBFormatVersion2 = 2
 
-	metaRangeKeyName   = "pebble.range_key"
-	metaValueIndexName = "pebble.value_index"
-	metaPropertiesName = "rocksdb.properties"
-	metaRangeDelV1Name = "rocksdb.range_del"
-	metaRangeDelV2Name = "rocksdb.range_del2"
+	metaRangeKeyName        = "pebble.range_key"
+	metaValueIndexName      = "pebble.value_index"
+	metaPropertiesName      = "rocksdb.properties"
+	metaRangeDelV1Name      = "rocksdb.range_del"
+	metaRangeDelV2Name      = "rocksdb.range_del2"
+	metaCompressionDictName = "pebble.compression_dict"
 
 	// Index Types.
 	// A space efficient index block that is optimized for binary-search-based
@@ -248,6 +254,9 @@ const (
 	lz4hcCompressionBlockType  blockType = 5
 	xpressCompressionBlockType blockType = 6
 	zstdCompressionBlockType   blockType = 7
+	// zstdDictCompressionBlockType is a Pebble-specific block type for zstd
+	// compression with the table's compression dictionary.
+	zstdDictCompressionBlockType blockType = 8
 )
 
 // String implements fmt.Stringer.
@@ -269,6 +278,8 @@ func (t blockType) String() string {
 		return "xpress"
 	case 7:
 		return "zstd"
+	case 8:
+		return "zstd-dict"
 	default:
 		panic(errors.Newf("sstable: unknown block type: %d", t))
 	}
@@ -425,7 +436,8 @@ func supportsTwoLevelIndex(format TableFormat) bool {
 	switch format {
 	case TableFormatLevelDB:
 		return false
-	case TableFormatRocksDBv2, TableFormatPebblev1, TableFormatPebblev2, TableFormatPebblev3, TableFormatPebblev4:
+	case TableFormatRocksDBv2, TableFormatPebblev1, TableFormatPebblev2, TableFormatPebblev3, TableFormatPebblev4,
+		TableFormatPebblev5:
 		return true
 	default:
 		panic("sstable: unspecified table format version")
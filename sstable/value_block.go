@@ -336,6 +336,7 @@ type valueBlockWriter struct {
 	blockSize, blockSizeThreshold int
 	// Configured compression.
 	compression Compression
+	zstdLevel   int
 	// checksummer with configured checksum type.
 	checksummer block.Checksummer
 	// Block finished callback.
@@ -406,6 +407,7 @@ func newValueBlockWriter(
 	blockSize int,
 	blockSizeThreshold int,
 	compression Compression,
+	zstdLevel int,
 	checksumType block.ChecksumType,
 	// compressedSize should exclude the block trailer.
 	blockFinishedFunc func(compressedSize int),
@@ -415,6 +417,7 @@ func newValueBlockWriter(
 		blockSize:          blockSize,
 		blockSizeThreshold: blockSizeThreshold,
 		compression:        compression,
+		zstdLevel:          zstdLevel,
 		checksummer: block.Checksummer{
 			Type: checksumType,
 		},
@@ -501,7 +504,7 @@ func (w *valueBlockWriter) compressAndFlush() {
 	b := w.buf
 	if w.compression != NoCompression {
 		blockType, w.compressedBuf.b =
-			compressBlock(w.compression, w.buf.b, w.compressedBuf.b[:cap(w.compressedBuf.b)])
+			compressBlock(w.compression, w.zstdLevel, nil, w.buf.b, w.compressedBuf.b[:cap(w.compressedBuf.b)])
 		if len(w.compressedBuf.b) < len(w.buf.b)-len(w.buf.b)/8 {
 			b = w.compressedBuf
 		} else {
@@ -136,6 +136,7 @@ type Writer struct {
 	split                Split
 	formatKey            base.FormatKey
 	compression          Compression
+	zstdLevel            int
 	separator            Separator
 	successor            Successor
 	tableFormat          TableFormat
@@ -214,6 +215,15 @@ type Writer struct {
 	valueBlockWriter *valueBlockWriter
 
 	allocatorSizeClasses []int
+
+	// For compression dictionaries. When compressionDictSize is non-zero, the
+	// first data blocks are held uncompressed in pendingDictBlocks until enough
+	// of them have been sampled to build the dictionary, which is stored in
+	// layout.compressionDict. pendingDictSize is the uncompressed size of the
+	// pending blocks.
+	compressionDictSize int
+	pendingDictBlocks   []*writeTask
+	pendingDictSize     int
 }
 
 type pointKeyInfo struct {
@@ -629,8 +639,8 @@ func (d *dataBlockBuf) finish() {
 	d.uncompressed = d.dataBlock.Finish()
 }
 
-func (d *dataBlockBuf) compressAndChecksum(c Compression) {
-	d.compressed, d.trailer = compressAndChecksum(d.uncompressed, c, &d.blockBuf)
+func (d *dataBlockBuf) compressAndChecksum(c Compression, zstdLevel int, dict *zstdDict) {
+	d.compressed, d.trailer = compressAndChecksum(d.uncompressed, c, zstdLevel, dict, &d.blockBuf)
 }
 
 func (d *dataBlockBuf) shouldFlush(
@@ -1336,10 +1346,15 @@ func (w *Writer) flush(key InternalKey) error {
 		return err
 	}
 	w.dataBlockBuf.finish()
-	w.dataBlockBuf.compressAndChecksum(w.compression)
-	// Since dataBlockEstimates.addInflightDataBlock was never called, the
-	// inflightSize is set to 0.
-	w.coordination.sizeEstimate.dataBlockCompressed(len(w.dataBlockBuf.compressed), 0)
+	// If we're still sampling data blocks for the compression dictionary, the
+	// block is compressed once the dictionary has been built.
+	sampling := w.compressionDictSize > 0 && w.layout.compressionDict == nil
+	if !sampling {
+		w.dataBlockBuf.compressAndChecksum(w.compression, w.zstdLevel, w.layout.compressionDict)
+		// Since dataBlockEstimates.addInflightDataBlock was never called, the
+		// inflightSize is set to 0.
+		w.coordination.sizeEstimate.dataBlockCompressed(len(w.dataBlockBuf.compressed), 0)
+	}
 
 	// Determine if the index block should be flushed. Since we're accessing the
 	// dataBlockBuf.dataBlock.curKey here, we have to make sure that once we start
@@ -1381,9 +1396,6 @@ func (w *Writer) flush(key InternalKey) error {
 
 	// Schedule a write.
 	writeTask := writeTaskPool.Get().(*writeTask)
-	// We're setting compressionDone to indicate that compression of this block
-	// has already been completed.
-	writeTask.compressionDone <- true
 	writeTask.buf = w.dataBlockBuf
 	writeTask.indexEntrySep = sep
 	writeTask.currIndexBlock = w.indexBlock
@@ -1391,20 +1403,87 @@ func (w *Writer) flush(key InternalKey) error {
 	writeTask.finishedIndexProps = indexProps
 	writeTask.flushableIndexBlock = flushableIndexBlock
 
-	// The writeTask corresponds to an unwritten index entry.
-	w.indexBlock.addInflight(writeTask.indexInflightSize)
-
 	w.dataBlockBuf = nil
-	if w.coordination.parallelismEnabled {
-		w.coordination.writeQueue.add(writeTask)
+	if sampling {
+		w.pendingDictBlocks = append(w.pendingDictBlocks, writeTask)
+		w.pendingDictSize += len(writeTask.buf.uncompressed)
+		if w.pendingDictSize >= compressionDictSampleFactor*w.compressionDictSize {
+			w.layout.compressionDict, err = newZstdDict(
+				buildRawContentDict(w.pendingDictBlocks, w.compressionDictSize), w.zstdLevel)
+			if err == nil {
+				err = w.flushPendingDictBlocks()
+			}
+		}
 	} else {
-		err = w.coordination.writeQueue.addSync(writeTask)
+		err = w.queueWrite(writeTask)
 	}
 	w.dataBlockBuf = newDataBlockBuf(w.restartInterval, w.checksumType)
 
 	return err
 }
 
+// queueWrite schedules the write of a data block whose compression has
+// completed.
+func (w *Writer) queueWrite(writeTask *writeTask) error {
+	// The writeTask corresponds to an unwritten index entry. The index entries
+	// of the data blocks held while sampling for the compression dictionary are
+	// only accounted for once their writes are scheduled, as are their sizes.
+	writeTask.currIndexBlock.addInflight(writeTask.indexInflightSize)
+	// We're setting compressionDone to indicate that compression of this block
+	// has already been completed.
+	writeTask.compressionDone <- true
+	if w.coordination.parallelismEnabled {
+		w.coordination.writeQueue.add(writeTask)
+		return nil
+	}
+	return w.coordination.writeQueue.addSync(writeTask)
+}
+
+// flushPendingDictBlocks compresses the data blocks held while sampling for
+// the compression dictionary with the dictionary, if one has been built, and
+// schedules their writes in order.
+func (w *Writer) flushPendingDictBlocks() error {
+	var err error
+	for i, writeTask := range w.pendingDictBlocks {
+		writeTask.buf.compressAndChecksum(w.compression, w.zstdLevel, w.layout.compressionDict)
+		w.coordination.sizeEstimate.dataBlockCompressed(len(writeTask.buf.compressed), 0)
+		err = firstError(err, w.queueWrite(writeTask))
+		w.pendingDictBlocks[i] = nil
+	}
+	w.pendingDictBlocks = w.pendingDictBlocks[:0]
+	w.pendingDictSize = 0
+	return err
+}
+
+// compressionDictSampleFactor is the ratio of the uncompressed size of the data
+// blocks sampled to build a compression dictionary to the dictionary's size.
+const compressionDictSampleFactor = 8
+
+// zstdFrameMagic is the little-endian encoding of the magic number that
+// begins zstd frames and formatted zstd dictionaries.
+var zstdFrameMagic = []byte{0x37, 0xa4, 0x30, 0xec}
+
+// buildRawContentDict builds a raw content dictionary of at most size bytes
+// from the uncompressed data blocks held by the given write tasks. Each block
+// contributes an equal share of its prefix, so that the dictionary covers the
+// key and value patterns found throughout the sample. The dictionary is not
+// trained: neither zstd binding used by Pebble exposes dictionary training,
+// and zstd matches against raw content directly.
+func buildRawContentDict(tasks []*writeTask, size int) []byte {
+	share := max(1, size/len(tasks))
+	dict := make([]byte, 0, size)
+	for _, task := range tasks {
+		b := task.buf.uncompressed
+		dict = append(dict, b[:min(len(b), share, size-len(dict))]...)
+	}
+	// A dictionary that begins with the zstd magic number would be interpreted
+	// as a formatted dictionary rather than raw content, so drop its first byte.
+	if bytes.HasPrefix(dict, zstdFrameMagic) {
+		dict = dict[1:]
+	}
+	return dict
+}
+
 func (w *Writer) maybeFlush(key InternalKey, valueLen int) error {
 	if !w.dataBlockBuf.shouldFlush(key, valueLen, w.dataBlockOptions, w.allocatorSizeClasses) {
 		return nil
@@ -1772,11 +1851,11 @@ func (w *Writer) writeTwoLevelIndex() (block.Handle, error) {
 }
 
 func compressAndChecksum(
-	b []byte, compression Compression, blockBuf *blockBuf,
+	b []byte, compression Compression, zstdLevel int, dict *zstdDict, blockBuf *blockBuf,
 ) (compressed []byte, trailer block.Trailer) {
 	// Compress the buffer, discarding the result if the improvement isn't at
 	// least 12.5%.
-	blockType, compressed := compressBlock(compression, b, blockBuf.compressedBuf)
+	blockType, compressed := compressBlock(compression, zstdLevel, dict, b, blockBuf.compressedBuf)
 	if blockType != noCompressionBlockType && cap(compressed) > cap(blockBuf.compressedBuf) {
 		blockBuf.compressedBuf = compressed[:cap(compressed)]
 	}
@@ -1873,6 +1952,13 @@ func (w *Writer) Close() (err error) {
 		}
 	}()
 
+	// Write any data blocks still held for sampling. The table was too small
+	// to build a compression dictionary, so they're compressed without one.
+	// Any error is returned by writeQueue.finish.
+	if len(w.pendingDictBlocks) > 0 && w.err == nil {
+		_ = w.flushPendingDictBlocks()
+	}
+
 	// finish must be called before we check for an error, because finish will
 	// block until every single task added to the writeQueue has been processed,
 	// and an error could be encountered while any of those tasks are processed.
@@ -1992,6 +2078,10 @@ func (w *Writer) Close() (err error) {
 		w.props.ValueBlocksSize = vbStats.valueBlocksAndIndexSize
 	}
 
+	if _, err := w.layout.WriteCompressionDictBlock(); err != nil {
+		return err
+	}
+
 	{
 		// Finish and record the prop collectors if props are not yet recorded.
 		// Pre-computed props might have been copied by specialized sst creators
@@ -2063,6 +2153,7 @@ func (w *Writer) EstimatedSize() uint64 {
 		return 0
 	}
 	return w.coordination.sizeEstimate.size() +
+		uint64(w.pendingDictSize) +
 		uint64(w.dataBlockBuf.dataBlock.EstimatedSize()) +
 		w.indexBlock.estimatedSize()
 }
@@ -2107,6 +2198,7 @@ func NewWriter(writable objstorage.Writable, o WriterOptions, extraOpts ...Write
 		split:                o.Comparer.Split,
 		formatKey:            o.Comparer.FormatKey,
 		compression:          o.Compression,
+		zstdLevel:            o.ZstdLevel,
 		separator:            o.Comparer.Separator,
 		successor:            o.Comparer.Successor,
 		tableFormat:          o.TableFormat,
@@ -2123,13 +2215,14 @@ func NewWriter(writable objstorage.Writable, o WriterOptions, extraOpts ...Write
 			Format: o.Comparer.FormatKey,
 		},
 		allocatorSizeClasses: o.AllocatorSizeClasses,
+		compressionDictSize:  o.CompressionDictSize,
 	}
 	if w.tableFormat >= TableFormatPebblev3 {
 		w.shortAttributeExtractor = o.ShortAttributeExtractor
 		w.requiredInPlaceValueBound = o.RequiredInPlaceValueBound
 		if !o.DisableValueBlocks {
 			w.valueBlockWriter = newValueBlockWriter(
-				w.dataBlockOptions.blockSize, w.dataBlockOptions.blockSizeThreshold, w.compression, w.checksumType, func(compressedSize int) {
+				w.dataBlockOptions.blockSize, w.dataBlockOptions.blockSizeThreshold, w.compression, w.zstdLevel, w.checksumType, func(compressedSize int) {
 					w.coordination.sizeEstimate.dataBlockCompressed(compressedSize, 0)
 				})
 		}
@@ -2167,6 +2260,9 @@ func NewWriter(writable objstorage.Writable, o WriterOptions, extraOpts ...Write
 		}
 	}
 
+	if o.Checksum != block.ChecksumTypeCRC32c {
+		w.props.ChecksumName = o.Checksum.String()
+	}
 	w.props.ComparerName = o.Comparer.Name
 	w.props.CompressionName = o.Compression.String()
 	w.props.MergerName = o.MergerName
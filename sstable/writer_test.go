@@ -979,6 +979,75 @@ func TestWriterRace(t *testing.T) {
 	wg.Wait()
 }
 
+func TestWriterCompressionDict(t *testing.T) {
+	value := func(i int) []byte {
+		return []byte(fmt.Sprintf(`{"id":%d,"status":"active","region":"us-east-1","tier":%d}`, i, i%3))
+	}
+	write := func(t *testing.T, n int, dictSize int, parallelism bool) *Reader {
+		f := &objstorage.MemObj{}
+		w := NewWriter(f, WriterOptions{
+			BlockSize:           256,
+			Compression:         ZstdCompression,
+			CompressionDictSize: dictSize,
+			Parallelism:         parallelism,
+			TableFormat:         TableFormatPebblev5,
+		})
+		for i := 0; i < n; i++ {
+			require.NoError(t, w.Set([]byte(fmt.Sprintf("key%06d", i)), value(i)))
+		}
+		require.NoError(t, w.Close())
+		r, err := NewMemReader(f.Data(), ReaderOptions{})
+		require.NoError(t, err)
+		return r
+	}
+	check := func(t *testing.T, r *Reader, n int) {
+		require.NoError(t, r.ValidateBlockChecksums())
+		it, err := r.NewIter(NoTransforms, nil, nil)
+		require.NoError(t, err)
+		i := 0
+		for kv := it.First(); kv != nil; kv = it.Next() {
+			require.Equal(t, fmt.Sprintf("key%06d", i), string(kv.K.UserKey))
+			v, _, err := kv.Value(nil)
+			require.NoError(t, err)
+			require.Equal(t, value(i), v)
+			i++
+		}
+		require.NoError(t, it.Close())
+		require.Equal(t, n, i)
+	}
+
+	for _, parallelism := range []bool{false, true} {
+		t.Run(fmt.Sprintf("parallelism=%t", parallelism), func(t *testing.T) {
+			t.Run("large", func(t *testing.T) {
+				const n = 5000
+				r := write(t, n, 1<<10, parallelism)
+				defer r.Close()
+				check(t, r, n)
+				l, err := r.Layout()
+				require.NoError(t, err)
+				require.NotZero(t, l.CompressionDict.Length)
+				require.LessOrEqual(t, l.CompressionDict.Length, uint64(1<<10))
+
+				// The dictionary should shrink the data blocks.
+				r2 := write(t, n, 0, parallelism)
+				defer r2.Close()
+				check(t, r2, n)
+				require.Less(t, r.Properties.DataSize, r2.Properties.DataSize)
+			})
+			t.Run("small", func(t *testing.T) {
+				// Too few blocks are written to build a dictionary.
+				const n = 20
+				r := write(t, n, 1<<10, parallelism)
+				defer r.Close()
+				check(t, r, n)
+				l, err := r.Layout()
+				require.NoError(t, err)
+				require.Zero(t, l.CompressionDict.Length)
+			})
+		})
+	}
+}
+
 func TestObsoleteBlockPropertyCollectorFilter(t *testing.T) {
 	var c obsoleteKeyBlockPropertyCollector
 	var f obsoleteKeyBlockPropertyFilter
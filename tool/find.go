@@ -328,7 +328,7 @@ func (f *findT) searchLogs(stdout io.Writer, searchKey []byte, refs []findRef) [
 					if f.verbose {
 						fmt.Fprintf(stdout, ": EOF [%s] (may be due to WAL preallocation)", err)
 					}
-				case record.ErrInvalidChunk:
+				case record.ErrInvalidChunk, record.ErrRecycledChunk:
 					if f.verbose {
 						fmt.Fprintf(stdout, ": EOF [%s] (may be due to WAL recycling)", err)
 					}
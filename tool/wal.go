@@ -110,7 +110,7 @@ func (w *walT) runDump(cmd *cobra.Command, args []string) {
 					switch err {
 					case record.ErrZeroedChunk:
 						fmt.Fprintf(stdout, "EOF [%s] (may be due to WAL preallocation)\n", err)
-					case record.ErrInvalidChunk:
+					case record.ErrInvalidChunk, record.ErrRecycledChunk:
 						fmt.Fprintf(stdout, "EOF [%s] (may be due to WAL recycling)\n", err)
 					default:
 						fmt.Fprintf(stdout, "%s\n", err)
@@ -0,0 +1,277 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"context"
+	"io"
+	"slices"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/internal/keyspan"
+	"github.com/cockroachdb/pebble/internal/rangekey"
+)
+
+// ErrTransactionConflict is returned by Transaction.Commit when a key read by
+// the transaction was written after the transaction began.
+var ErrTransactionConflict = errors.New("pebble: transaction conflict")
+
+// Transaction is an optimistic read-write transaction. Reads observe the DB
+// state as of the transaction's creation, overlaid with the transaction's own
+// uncommitted writes. Writes are buffered in an indexed batch and applied
+// atomically by Commit, which first validates that no key the transaction read
+// has been written since the transaction began. The keys read are those read
+// through Get and every key within the bounds of an iterator created by
+// NewIter, whether or not the iterator was positioned over it. If validation
+// fails, Commit returns ErrTransactionConflict and none of the transaction's
+// writes are applied.
+//
+// Validation is by sequence number: a key that was written after the
+// transaction began is a conflict even if it was overwritten with the value the
+// transaction read, and a range deletion or range key written over a key read
+// is a conflict too. Writes are never validated, so blind writes to the same
+// key by concurrent transactions do not conflict, and the last transaction to
+// commit wins.
+//
+// Commit validates the transaction within the DB's commit pipeline, so
+// validation is ordered with respect to every other write to the DB, whether
+// or not it was made through a transaction: no write can be sequenced between
+// the validation and the transaction's own writes.
+//
+// A Transaction is not safe for concurrent use. Either Commit or Rollback must
+// be called, releasing the transaction's snapshot and batch.
+type Transaction struct {
+	db       *DB
+	batch    *Batch
+	snapshot *Snapshot
+	// reads holds every user key read through Get.
+	reads map[string]struct{}
+	// readSpans holds every pair of bounds set on an iterator created by
+	// NewIter, including bounds later set through SetBounds or SetOptions. A
+	// nil bound is unbounded.
+	readSpans []transactionSpan
+}
+
+type transactionSpan struct {
+	lower, upper []byte
+}
+
+// NewTransaction returns a new optimistic transaction reading from a
+// point-in-time view of the current DB state. See Transaction.
+func (d *DB) NewTransaction() *Transaction {
+	return &Transaction{
+		db:       d,
+		batch:    d.NewIndexedBatch(),
+		snapshot: d.NewSnapshot(),
+		reads:    make(map[string]struct{}),
+	}
+}
+
+// Get gets the value for the given key, as of the transaction's snapshot and
+// including the transaction's own writes. It returns ErrNotFound if the key
+// does not exist. The key is added to the transaction's read set, to be
+// validated by Commit.
+//
+// The caller should not modify the contents of the returned slice, but it is
+// safe to modify the contents of the argument after Get returns. The returned
+// slice will remain valid until the returned Closer is closed. On success, the
+// caller MUST call closer.Close() or a memory leak will occur.
+func (t *Transaction) Get(key []byte) ([]byte, io.Closer, error) {
+	if t.batch == nil {
+		panic(ErrClosed)
+	}
+	t.reads[string(key)] = struct{}{}
+	return t.db.getInternal(key, t.batch, t.snapshot)
+}
+
+// NewIter returns an iterator over the transaction's snapshot, overlaid with
+// the transaction's own writes. Every key within the iterator's bounds is added
+// to the transaction's read set, as are the keys within any bounds later set
+// on the iterator or its clones, so a transaction that scans only part of a
+// large span should bound its iterator accordingly.
+func (t *Transaction) NewIter(o *IterOptions) (*Iterator, error) {
+	if t.batch == nil {
+		panic(ErrClosed)
+	}
+	iter := t.db.newIter(context.Background(), t.batch, newIterOpts{
+		snapshot: snapshotIterOpts{seqNum: t.snapshot.seqNum},
+	}, o)
+	iter.onBounds = t.addReadSpan
+	t.addReadSpan(iter.opts.LowerBound, iter.opts.UpperBound)
+	return iter, nil
+}
+
+func (t *Transaction) addReadSpan(lower, upper []byte) {
+	t.readSpans = append(t.readSpans, transactionSpan{
+		lower: slices.Clone(lower),
+		upper: slices.Clone(upper),
+	})
+}
+
+// Set sets the value for the given key within the transaction.
+//
+// It is safe to modify the contents of the arguments after Set returns.
+func (t *Transaction) Set(key, value []byte) error {
+	if t.batch == nil {
+		panic(ErrClosed)
+	}
+	return t.batch.Set(key, value, nil)
+}
+
+// Merge adds an action to the transaction that merges the value at key with
+// the new value. The details of the merge are dependent upon the configured
+// merge operator.
+//
+// It is safe to modify the contents of the arguments after Merge returns.
+func (t *Transaction) Merge(key, value []byte) error {
+	if t.batch == nil {
+		panic(ErrClosed)
+	}
+	return t.batch.Merge(key, value, nil)
+}
+
+// Delete deletes the value for the given key within the transaction.
+//
+// It is safe to modify the contents of the arguments after Delete returns.
+func (t *Transaction) Delete(key []byte) error {
+	if t.batch == nil {
+		panic(ErrClosed)
+	}
+	return t.batch.Delete(key, nil)
+}
+
+// Commit validates the transaction's read set and, if no key read by the
+// transaction has since been written, applies the transaction's writes to the
+// DB. It returns ErrTransactionConflict if validation fails. The transaction is
+// released whether or not Commit succeeds.
+//
+// Validation runs within the commit pipeline, after every earlier write has
+// become visible and before the transaction's writes are sequenced, so it
+// blocks all other writes to the DB while it runs. Other writes are unblocked
+// once the transaction's writes are sequenced, before any WAL sync completes.
+func (t *Transaction) Commit(opts *WriteOptions) error {
+	if t.batch == nil {
+		panic(ErrClosed)
+	}
+	defer t.release()
+
+	if t.batch.Empty() {
+		// An empty batch is not sequenced by the commit pipeline, and there are
+		// no writes to order with respect to the validation.
+		return t.validate()
+	}
+	t.batch.validate = t.validate
+	return t.db.Apply(t.batch, opts)
+}
+
+// validate returns ErrTransactionConflict if a key read by the transaction has
+// been written since the transaction's snapshot was taken.
+func (t *Transaction) validate() error {
+	for key := range t.reads {
+		if err := t.validateKey([]byte(key)); err != nil {
+			return err
+		}
+	}
+	for _, s := range t.readSpans {
+		if err := t.validateSpan(s.lower, s.upper); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Transaction) newValidationIter(lower, upper []byte) (*scanInternalIterator, error) {
+	return t.db.newInternalIter(context.Background(), snapshotIterOpts{}, &scanInternalOptions{
+		includeObsoleteKeys: true,
+		IterOptions: IterOptions{
+			KeyTypes:   IterKeyTypePointsAndRanges,
+			LowerBound: lower,
+			UpperBound: upper,
+		},
+	})
+}
+
+// validateKey returns ErrTransactionConflict if the newest version of key, or
+// a range deletion or range key covering it, is newer than the transaction's
+// snapshot. Older versions of the key are not examined.
+func (t *Transaction) validateKey(key []byte) error {
+	iter, err := t.newValidationIter(key, t.db.opts.Comparer.ImmediateSuccessor(nil, key))
+	if err != nil {
+		return err
+	}
+	defer iter.close()
+	// Spans covering key are interleaved ahead of its point keys, and the
+	// first point key is its newest version.
+	for valid := iter.seekGE(key); valid; valid = iter.next() {
+		if t.conflicts(iter) {
+			return t.conflictError(key)
+		}
+		if kind := iter.unsafeKey().Kind(); kind != InternalKeyKindRangeDelete && !rangekey.IsRangeKey(kind) {
+			break
+		}
+	}
+	return iter.error()
+}
+
+// validateSpan returns ErrTransactionConflict if any internal key, range
+// deletion or range key within [lower, upper) is newer than the transaction's
+// snapshot. It stops at the first such key.
+func (t *Transaction) validateSpan(lower, upper []byte) error {
+	iter, err := t.newValidationIter(lower, upper)
+	if err != nil {
+		return err
+	}
+	defer iter.close()
+	for valid := iter.seekGE(lower); valid; valid = iter.next() {
+		if t.conflicts(iter) {
+			return t.conflictError(iter.unsafeKey().UserKey)
+		}
+	}
+	return iter.error()
+}
+
+// conflicts returns true if the key or span at the iterator's position is newer
+// than the transaction's snapshot.
+func (t *Transaction) conflicts(iter *scanInternalIterator) bool {
+	key := iter.unsafeKey()
+	var seqNum base.SeqNum
+	switch kind := key.Kind(); {
+	case rangekey.IsRangeKey(kind):
+		seqNum = largestSpanSeqNum(iter.unsafeSpan())
+	case kind == InternalKeyKindRangeDelete:
+		seqNum = iter.unsafeRangeDel().LargestSeqNum()
+	default:
+		seqNum = key.SeqNum()
+	}
+	return seqNum >= t.snapshot.seqNum
+}
+
+func (t *Transaction) conflictError(key []byte) error {
+	return errors.Wrapf(ErrTransactionConflict, "key %s", t.db.opts.Comparer.FormatKey(key))
+}
+
+func largestSpanSeqNum(s *keyspan.Span) base.SeqNum {
+	var seqNum base.SeqNum
+	for i := range s.Keys {
+		seqNum = max(seqNum, s.Keys[i].SeqNum())
+	}
+	return seqNum
+}
+
+// Rollback discards the transaction's writes and releases the transaction.
+func (t *Transaction) Rollback() error {
+	if t.batch == nil {
+		panic(ErrClosed)
+	}
+	t.release()
+	return nil
+}
+
+func (t *Transaction) release() {
+	_ = t.batch.Close()
+	_ = t.snapshot.Close()
+	t.batch, t.snapshot, t.reads, t.readSpans = nil, nil, nil, nil
+}
@@ -0,0 +1,336 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package pebble
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/internal/base"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransaction(t *testing.T) {
+	d, err := Open("", testingRandomized(t, &Options{
+		FS: vfs.NewMem(),
+	}))
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, d.Close())
+	}()
+
+	require.NoError(t, d.Set([]byte("a"), []byte("1"), nil))
+	require.NoError(t, d.Set([]byte("b"), []byte("1"), nil))
+
+	getValue := func(get func([]byte) ([]byte, io.Closer, error), key string) string {
+		v, closer, err := get([]byte(key))
+		if err == ErrNotFound {
+			return "<not found>"
+		}
+		require.NoError(t, err)
+		defer closer.Close()
+		return string(v)
+	}
+	txnGet := func(txn *Transaction) func([]byte) ([]byte, io.Closer, error) {
+		return func(key []byte) ([]byte, io.Closer, error) { return txn.Get(key) }
+	}
+	dbGet := func(key []byte) ([]byte, io.Closer, error) { return d.Get(key) }
+
+	// A transaction reads its own writes over a stable snapshot, and its writes
+	// are invisible until it commits. A write after the transaction began to a
+	// key outside the iterator's bounds is not a conflict.
+	txn := d.NewTransaction()
+	require.NoError(t, txn.Set([]byte("a"), []byte("2")))
+	require.NoError(t, txn.Delete([]byte("b")))
+	require.NoError(t, d.Set([]byte("c"), []byte("1"), nil))
+	require.Equal(t, "2", getValue(txnGet(txn), "a"))
+	require.Equal(t, "<not found>", getValue(txnGet(txn), "b"))
+	require.Equal(t, "1", getValue(dbGet, "a"))
+
+	iter, err := txn.NewIter(&IterOptions{UpperBound: []byte("c")})
+	require.NoError(t, err)
+	var keys []string
+	for valid := iter.First(); valid; valid = iter.Next() {
+		keys = append(keys, fmt.Sprintf("%s=%s", iter.Key(), iter.Value()))
+	}
+	require.NoError(t, iter.Close())
+	require.Equal(t, []string{"a=2"}, keys)
+
+	require.NoError(t, txn.Commit(nil))
+	require.Equal(t, "2", getValue(dbGet, "a"))
+	require.Equal(t, "<not found>", getValue(dbGet, "b"))
+
+	// A rolled back transaction applies nothing.
+	txn = d.NewTransaction()
+	require.NoError(t, txn.Set([]byte("a"), []byte("3")))
+	require.NoError(t, txn.Rollback())
+	require.Equal(t, "2", getValue(dbGet, "a"))
+
+	// A key read by a transaction and modified before it commits is a
+	// conflict, and none of the transaction's writes are applied.
+	txn = d.NewTransaction()
+	require.Equal(t, "2", getValue(txnGet(txn), "a"))
+	require.NoError(t, txn.Set([]byte("d"), []byte("1")))
+	require.NoError(t, d.Set([]byte("a"), []byte("4"), nil))
+	err = txn.Commit(nil)
+	require.True(t, errors.Is(err, ErrTransactionConflict), "%v", err)
+	require.Equal(t, "<not found>", getValue(dbGet, "d"))
+
+	// Reading a key that does not exist and is created before the commit is a
+	// conflict too.
+	txn = d.NewTransaction()
+	require.Equal(t, "<not found>", getValue(txnGet(txn), "e"))
+	require.NoError(t, txn.Set([]byte("f"), []byte("1")))
+	require.NoError(t, d.Set([]byte("e"), []byte("1"), nil))
+	require.True(t, errors.Is(txn.Commit(nil), ErrTransactionConflict))
+
+	// Validation is by sequence number, so a key overwritten with the value
+	// the transaction read is a conflict.
+	txn = d.NewTransaction()
+	require.Equal(t, "4", getValue(txnGet(txn), "a"))
+	require.NoError(t, d.Set([]byte("a"), []byte("5"), nil))
+	require.NoError(t, d.Set([]byte("a"), []byte("4"), nil))
+	require.True(t, errors.Is(txn.Commit(nil), ErrTransactionConflict))
+
+	// Blind writes never conflict.
+	txn = d.NewTransaction()
+	require.NoError(t, txn.Set([]byte("c"), []byte("2")))
+	require.NoError(t, d.Set([]byte("c"), []byte("3"), nil))
+	require.NoError(t, txn.Commit(nil))
+	require.Equal(t, "2", getValue(dbGet, "c"))
+
+	// A range deletion over a key read is a conflict.
+	txn = d.NewTransaction()
+	require.Equal(t, "4", getValue(txnGet(txn), "a"))
+	require.NoError(t, d.DeleteRange([]byte("0"), []byte("b"), nil))
+	require.True(t, errors.Is(txn.Commit(nil), ErrTransactionConflict))
+}
+
+func TestTransactionIterConflicts(t *testing.T) {
+	d, err := Open("", testingRandomized(t, &Options{
+		FS: vfs.NewMem(),
+	}))
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, d.Close())
+	}()
+	for _, k := range []string{"a", "c", "e", "g"} {
+		require.NoError(t, d.Set([]byte(k), []byte("1"), nil))
+	}
+	require.NoError(t, d.Flush())
+
+	scan := func(txn *Transaction, o *IterOptions) {
+		iter, err := txn.NewIter(o)
+		require.NoError(t, err)
+		for valid := iter.First(); valid; valid = iter.Next() {
+		}
+		require.NoError(t, iter.Close())
+	}
+
+	// Every key within the bounds of an iterator is read, including keys that
+	// did not exist when the transaction scanned them.
+	for _, tc := range []struct {
+		lower, upper string
+		write        string
+		conflict     bool
+	}{
+		{write: "z", conflict: true},
+		{lower: "b", upper: "e", write: "b", conflict: true},
+		{lower: "b", upper: "e", write: "c", conflict: true},
+		{lower: "b", upper: "e", write: "d", conflict: true},
+		{lower: "b", upper: "e", write: "a"},
+		{lower: "b", upper: "e", write: "e"},
+	} {
+		t.Run(fmt.Sprintf("[%s,%s)/%s", tc.lower, tc.upper, tc.write), func(t *testing.T) {
+			txn := d.NewTransaction()
+			o := &IterOptions{}
+			if tc.lower != "" {
+				o.LowerBound, o.UpperBound = []byte(tc.lower), []byte(tc.upper)
+			}
+			scan(txn, o)
+			require.NoError(t, txn.Set([]byte("out"), []byte(tc.write)))
+			require.NoError(t, d.Set([]byte(tc.write), []byte("2"), nil))
+			err := txn.Commit(nil)
+			if tc.conflict {
+				require.True(t, errors.Is(err, ErrTransactionConflict), "%v", err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+
+	// Bounds set on an iterator after its creation, and on its clones, are
+	// read too.
+	txn := d.NewTransaction()
+	iter, err := txn.NewIter(&IterOptions{LowerBound: []byte("a"), UpperBound: []byte("b")})
+	require.NoError(t, err)
+	iter.SetBounds([]byte("f"), []byte("h"))
+	require.NoError(t, iter.Close())
+	require.NoError(t, d.Set([]byte("g"), []byte("2"), nil))
+	require.True(t, errors.Is(txn.Commit(nil), ErrTransactionConflict))
+
+	txn = d.NewTransaction()
+	iter, err = txn.NewIter(&IterOptions{LowerBound: []byte("a"), UpperBound: []byte("b")})
+	require.NoError(t, err)
+	clone, err := iter.Clone(CloneOptions{IterOptions: &IterOptions{LowerBound: []byte("p"), UpperBound: []byte("q")}})
+	require.NoError(t, err)
+	require.NoError(t, clone.Close())
+	require.NoError(t, iter.Close())
+	require.NoError(t, d.Set([]byte("p"), []byte("2"), nil))
+	require.True(t, errors.Is(txn.Commit(nil), ErrTransactionConflict))
+
+	// A range key written over the bounds of an iterator is a conflict.
+	txn = d.NewTransaction()
+	scan(txn, &IterOptions{LowerBound: []byte("c"), UpperBound: []byte("d")})
+	require.NoError(t, d.RangeKeySet([]byte("a"), []byte("z"), nil, []byte("v"), nil))
+	require.True(t, errors.Is(txn.Commit(nil), ErrTransactionConflict))
+}
+
+func TestTransactionConcurrentIncrements(t *testing.T) {
+	d, err := Open("", testingRandomized(t, &Options{
+		FS: vfs.NewMem(),
+	}))
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, d.Close())
+	}()
+
+	// Each worker increments a counter in a read-modify-write transaction,
+	// retrying on conflict. No increment may be lost.
+	const workers, increments = 4, 50
+	key := []byte("counter")
+	increment := func() error {
+		for {
+			txn := d.NewTransaction()
+			n := 0
+			v, closer, err := txn.Get(key)
+			if err == nil {
+				n, err = strconv.Atoi(string(v))
+				closer.Close()
+			} else if err == ErrNotFound {
+				err = nil
+			}
+			if err != nil {
+				_ = txn.Rollback()
+				return err
+			}
+			if err := txn.Set(key, []byte(strconv.Itoa(n+1))); err != nil {
+				_ = txn.Rollback()
+				return err
+			}
+			if err := txn.Commit(nil); !errors.Is(err, ErrTransactionConflict) {
+				return err
+			}
+		}
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < increments; j++ {
+				if err := increment(); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	verifyGet(t, d, key, []byte(strconv.Itoa(workers*increments)))
+}
+
+func TestTransactionRacingWrites(t *testing.T) {
+	d, err := Open("", &Options{FS: vfs.NewMem()})
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, d.Close())
+	}()
+
+	// Transactions read "a" and write their id to "b", racing with plain
+	// writes to "a". A transaction that commits must be sequenced before any
+	// write to "a" made after its snapshot.
+	const writes = 200
+	var wg sync.WaitGroup
+	var writerSeqNums []base.SeqNum
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < writes; i++ {
+			b := d.NewBatch()
+			_ = b.Set([]byte("a"), []byte(strconv.Itoa(i)), nil)
+			if err := d.Apply(b, nil); err != nil {
+				panic(err)
+			}
+			writerSeqNums = append(writerSeqNums, b.SeqNum())
+			_ = b.Close()
+		}
+	}()
+	snapshots := make(map[string]base.SeqNum)
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for id, finished := 0, false; !finished; id++ {
+		select {
+		case <-done:
+			// Commit one final transaction after all of the writes.
+			finished = true
+		default:
+		}
+		txn := d.NewTransaction()
+		snapshot := txn.snapshot.seqNum
+		if _, closer, err := txn.Get([]byte("a")); err == nil {
+			require.NoError(t, closer.Close())
+		} else {
+			require.Equal(t, ErrNotFound, err)
+		}
+		require.NoError(t, txn.Set([]byte("b"), []byte(strconv.Itoa(id))))
+		if err := txn.Commit(nil); err == nil {
+			snapshots[strconv.Itoa(id)] = snapshot
+		} else {
+			require.True(t, errors.Is(err, ErrTransactionConflict), "%v", err)
+		}
+	}
+	require.NotEmpty(t, snapshots)
+
+	// Every version of "b" is still in the memtable.
+	iter, err := d.newInternalIter(context.Background(), snapshotIterOpts{}, &scanInternalOptions{
+		includeObsoleteKeys: true,
+		IterOptions:         IterOptions{LowerBound: []byte("b"), UpperBound: []byte("b\x00")},
+	})
+	require.NoError(t, err)
+	committed := 0
+	for valid := iter.seekGE([]byte("b")); valid; valid = iter.next() {
+		lv := iter.lazyValue()
+		v, _, err := lv.Value(nil)
+		require.NoError(t, err)
+		snapshot, ok := snapshots[string(v)]
+		require.True(t, ok, "uncommitted transaction %s", v)
+		commitSeqNum := iter.unsafeKey().SeqNum()
+		for _, seqNum := range writerSeqNums {
+			if seqNum >= snapshot && seqNum < commitSeqNum {
+				t.Fatalf("transaction %s with snapshot %s committed at %s after write at %s",
+					v, snapshot, commitSeqNum, seqNum)
+			}
+		}
+		committed++
+	}
+	require.NoError(t, iter.error())
+	require.NoError(t, iter.close())
+	require.Equal(t, len(snapshots), committed)
+}
@@ -0,0 +1,394 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+// Package encryptedfs provides a vfs.FS that encrypts the contents of every
+// file it writes, so that sstables, WAL files, the MANIFEST and all other
+// files Pebble stores are encrypted at rest without relying on an encrypted
+// filesystem.
+//
+// Each file begins with a fixed-size plaintext header recording the ID of the
+// key the file was encrypted with and a random initialization vector. The
+// remainder of the file is encrypted with AES in counter mode, which allows
+// any byte range to be read independently. Sizes and offsets seen by the user
+// of the FS exclude the header.
+//
+// Counter mode must never encrypt two plaintexts with the same key, IV and
+// offset, so files are written strictly sequentially: a write that does not
+// begin at the end of the file's contents is refused, OpenReadWrite is not
+// supported (which rules out the secondary cache), and a file reused for
+// writing is truncated and given a new IV. Unwritten extents must not be left
+// in a file either, since zeros on disk decrypt to garbage rather than to the
+// zeros the WAL reader recognizes as the end of a preallocated log. Preallocate
+// is therefore a no-op, and reusing a file forgoes the benefit of recycling its
+// storage.
+//
+// Encryption provides confidentiality only: it does not detect tampering,
+// which Pebble's own checksums catch only incidentally. File names and sizes
+// are not hidden. Files written without encryption cannot be read through the
+// FS, so encryption must be enabled when a store is created.
+//
+// To encrypt a store, wrap the FS it is opened with:
+//
+//	opts.FS = encryptedfs.New(vfs.Default, keyManager)
+package encryptedfs
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/cockroachdb/errors"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+// The header at the start of every encrypted file is laid out as follows:
+//
+//	+---------+---------+-----------+----------+--------+--------------------+
+//	| magic   | version | ID length | reserved | IV     | key ID (0-padded)  |
+//	| 4 bytes | 1 byte  | 1 byte    | 2 bytes  | 16 B   | MaxKeyIDLen bytes  |
+//	+---------+---------+-----------+----------+--------+--------------------+
+const (
+	headerMagic   = "\xa7PEB"
+	headerVersion = 1
+	ivOffset      = 8
+	keyIDOffset   = ivOffset + aes.BlockSize
+	// HeaderLen is the number of bytes by which an encrypted file is larger
+	// than its contents.
+	HeaderLen = keyIDOffset + MaxKeyIDLen
+)
+
+// New returns an FS that encrypts files written to fs with the active key of
+// keys, and decrypts files read from fs with the key recorded in their header.
+func New(fs vfs.FS, keys KeyManager) *FS {
+	return &FS{FS: fs, keys: keys}
+}
+
+// FS is a vfs.FS that encrypts the contents of the files it stores. Directory
+// operations and renames, links and removals are passed through to the
+// wrapped FS.
+type FS struct {
+	vfs.FS
+	keys KeyManager
+}
+
+var _ vfs.FS = (*FS)(nil)
+
+// Create implements vfs.FS.
+func (fs *FS) Create(name string, category vfs.DiskWriteCategory) (vfs.File, error) {
+	f, err := fs.FS.Create(name, category)
+	if err != nil {
+		return nil, err
+	}
+	return fs.initFile(f)
+}
+
+// Open implements vfs.FS.
+func (fs *FS) Open(name string, opts ...vfs.OpenOption) (vfs.File, error) {
+	f, err := fs.FS.Open(name, opts...)
+	if err != nil {
+		return nil, err
+	}
+	ef, err := fs.openFile(f)
+	if err != nil {
+		return nil, errors.CombineErrors(errors.Wrapf(err, "pebble: opening %q", name), f.Close())
+	}
+	return ef, nil
+}
+
+// OpenReadWrite implements vfs.FS. It always returns an error, as a file
+// opened for both reading and writing may be overwritten in place, which would
+// reuse the keystream of the overwritten contents.
+func (fs *FS) OpenReadWrite(
+	name string, category vfs.DiskWriteCategory, opts ...vfs.OpenOption,
+) (vfs.File, error) {
+	return nil, errors.Newf("pebble: opening %q: encrypted files cannot be opened for read-write", name)
+}
+
+// ReuseForWrite implements vfs.FS. The reused file is truncated and given a
+// new header, so that its new contents are never encrypted with the same key
+// and IV as its old ones, and its old contents do not remain beyond the end of
+// its new ones, where they would decrypt to garbage.
+func (fs *FS) ReuseForWrite(
+	oldname, newname string, category vfs.DiskWriteCategory,
+) (vfs.File, error) {
+	if err := fs.FS.Rename(oldname, newname); err != nil {
+		return nil, err
+	}
+	return fs.Create(newname, category)
+}
+
+// Stat implements vfs.FS. The size of a regular file excludes its header.
+func (fs *FS) Stat(name string) (os.FileInfo, error) {
+	info, err := fs.FS.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return statInfo(info), nil
+}
+
+// KeyIDs returns the number of files in dir encrypted with each key, which
+// allows a caller rotating keys to determine when a retired key is no longer
+// needed. Files that are too short to have a header are not counted.
+func (fs *FS) KeyIDs(dir string) (map[string]int, error) {
+	names, err := fs.FS.List(dir)
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[string]int)
+	for _, name := range names {
+		path := fs.FS.PathJoin(dir, name)
+		if info, err := fs.FS.Stat(path); err != nil {
+			return nil, err
+		} else if info.IsDir() {
+			continue
+		}
+		f, err := fs.FS.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		var hdr [HeaderLen]byte
+		n, err := f.ReadAt(hdr[:], 0)
+		f.Close()
+		if n < HeaderLen {
+			if err != nil && err != io.EOF {
+				return nil, err
+			}
+			continue
+		}
+		id, _, err := decodeHeader(hdr[:])
+		if err != nil {
+			return nil, errors.Wrapf(err, "pebble: reading %q", path)
+		}
+		ids[id]++
+	}
+	return ids, nil
+}
+
+// initFile writes a new header naming the active key to f, and returns f
+// wrapped for encryption with that key.
+func (fs *FS) initFile(f vfs.File) (vfs.File, error) {
+	key, err := fs.keys.ActiveKey()
+	if err == nil {
+		err = key.validate()
+	}
+	if err != nil {
+		return nil, errors.CombineErrors(err, f.Close())
+	}
+	var iv [aes.BlockSize]byte
+	if _, err := rand.Read(iv[:]); err != nil {
+		return nil, errors.CombineErrors(err, f.Close())
+	}
+	var hdr [HeaderLen]byte
+	encodeHeader(hdr[:], key.ID, iv[:])
+	if _, err := f.WriteAt(hdr[:], 0); err != nil {
+		return nil, errors.CombineErrors(err, f.Close())
+	}
+	block, err := aes.NewCipher(key.Secret)
+	if err != nil {
+		return nil, errors.CombineErrors(err, f.Close())
+	}
+	return &file{File: f, block: block, iv: iv}, nil
+}
+
+// openFile reads the header of f and returns f wrapped for decryption. A file
+// shorter than a header, which may be left behind by a crash immediately
+// after its creation, is treated as empty and returned with a nil block.
+func (fs *FS) openFile(f vfs.File) (*file, error) {
+	var hdr [HeaderLen]byte
+	n, err := f.ReadAt(hdr[:], 0)
+	if n < HeaderLen {
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		return &file{File: f}, nil
+	}
+	id, iv, err := decodeHeader(hdr[:])
+	if err != nil {
+		return nil, err
+	}
+	key, err := fs.keys.GetKey(id)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key.Secret)
+	if err != nil {
+		return nil, errors.Wrapf(err, "pebble: encryption key %q", id)
+	}
+	ef := &file{File: f, block: block}
+	copy(ef.iv[:], iv)
+	return ef, nil
+}
+
+func encodeHeader(hdr []byte, keyID string, iv []byte) {
+	copy(hdr, headerMagic)
+	hdr[4] = headerVersion
+	hdr[5] = byte(len(keyID))
+	copy(hdr[ivOffset:], iv)
+	copy(hdr[keyIDOffset:], keyID)
+}
+
+func decodeHeader(hdr []byte) (keyID string, iv []byte, err error) {
+	if !bytes.Equal(hdr[:len(headerMagic)], []byte(headerMagic)) {
+		return "", nil, errors.New("pebble: file is not encrypted")
+	}
+	if hdr[4] != headerVersion {
+		return "", nil, errors.Newf("pebble: unsupported encryption header version %d", hdr[4])
+	}
+	idLen := int(hdr[5])
+	if idLen == 0 || idLen > MaxKeyIDLen {
+		return "", nil, errors.Newf("pebble: invalid encryption key ID length %d", idLen)
+	}
+	return string(hdr[keyIDOffset : keyIDOffset+idLen]), hdr[ivOffset:keyIDOffset], nil
+}
+
+// file is a vfs.File whose contents, following the header, are encrypted
+// with AES-CTR. The counter for the block at offset off is the IV plus
+// off/aes.BlockSize, so any offset can be encrypted or decrypted on its own.
+type file struct {
+	vfs.File
+	// block is nil for a file opened for reading that has no header, which
+	// reads as empty.
+	block cipher.Block
+	iv    [aes.BlockSize]byte
+
+	mu struct {
+		sync.Mutex
+		// offset is the offset of the next Read or Write, excluding the
+		// header. Reads and writes of the underlying file are positioned
+		// explicitly, since its own offset includes the header.
+		offset int64
+		// size is the length of the contents written through the file, at
+		// which the next write must begin.
+		size int64
+		// buf holds the ciphertext of writes, as Write must not modify the
+		// slice it is given.
+		buf []byte
+	}
+}
+
+var _ vfs.File = (*file)(nil)
+
+// xorKeyStream encrypts or decrypts src into dst, where src holds the data
+// at offset off.
+func (f *file) xorKeyStream(dst, src []byte, off int64) {
+	var ctr [aes.BlockSize]byte
+	copy(ctr[:], f.iv[:])
+	// Add the block index to the IV as a 128-bit big-endian integer, which is
+	// how cipher.NewCTR increments the counter.
+	lo := binary.BigEndian.Uint64(ctr[8:])
+	sum := lo + uint64(off/aes.BlockSize)
+	binary.BigEndian.PutUint64(ctr[8:], sum)
+	if sum < lo {
+		binary.BigEndian.PutUint64(ctr[:8], binary.BigEndian.Uint64(ctr[:8])+1)
+	}
+	stream := cipher.NewCTR(f.block, ctr[:])
+	if skip := int(off % aes.BlockSize); skip > 0 {
+		var discard [aes.BlockSize]byte
+		stream.XORKeyStream(discard[:skip], discard[:skip])
+	}
+	stream.XORKeyStream(dst, src)
+}
+
+// Read implements io.Reader.
+func (f *file) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, err := f.ReadAt(p, f.mu.offset)
+	f.mu.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// ReadAt implements io.ReaderAt.
+func (f *file) ReadAt(p []byte, off int64) (int, error) {
+	if f.block == nil {
+		return 0, io.EOF
+	}
+	n, err := f.File.ReadAt(p, off+HeaderLen)
+	f.xorKeyStream(p[:n], p[:n], off)
+	return n, err
+}
+
+// Write implements io.Writer.
+func (f *file) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, err := f.writeAtLocked(p, f.mu.offset)
+	f.mu.offset += int64(n)
+	return n, err
+}
+
+// WriteAt implements io.WriterAt.
+func (f *file) WriteAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.writeAtLocked(p, off)
+}
+
+func (f *file) writeAtLocked(p []byte, off int64) (int, error) {
+	if f.block == nil {
+		return 0, errors.New("pebble: file was not opened for writing")
+	}
+	if off != f.mu.size {
+		return 0, errors.Newf("pebble: encrypted file written at offset %d, not at its end (%d)", off, f.mu.size)
+	}
+	if cap(f.mu.buf) < len(p) {
+		f.mu.buf = make([]byte, len(p))
+	}
+	buf := f.mu.buf[:len(p)]
+	f.xorKeyStream(buf, p, off)
+	n, err := f.File.WriteAt(buf, off+HeaderLen)
+	f.mu.size += int64(n)
+	return n, err
+}
+
+// Preallocate implements vfs.File. It is a no-op, as an extent preallocated by
+// a filesystem that does not keep the file's size reads as zeros, which do not
+// decrypt to zeros.
+func (f *file) Preallocate(offset, length int64) error {
+	return nil
+}
+
+// Prefetch implements vfs.File.
+func (f *file) Prefetch(offset, length int64) error {
+	return f.File.Prefetch(offset+HeaderLen, length)
+}
+
+// SyncTo implements vfs.File.
+func (f *file) SyncTo(length int64) (fullSync bool, err error) {
+	return f.File.SyncTo(length + HeaderLen)
+}
+
+// Stat implements vfs.File.
+func (f *file) Stat() (os.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return statInfo(info), nil
+}
+
+// fileInfo reports the size of an encrypted file excluding its header.
+type fileInfo struct {
+	os.FileInfo
+}
+
+func statInfo(info os.FileInfo) os.FileInfo {
+	if info.IsDir() {
+		return info
+	}
+	return fileInfo{info}
+}
+
+// Size implements os.FileInfo.
+func (i fileInfo) Size() int64 {
+	return max(0, i.FileInfo.Size()-HeaderLen)
+}
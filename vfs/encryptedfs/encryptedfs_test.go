@@ -0,0 +1,185 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package encryptedfs
+
+import (
+	"bytes"
+	"crypto/aes"
+	"io"
+	"testing"
+
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+func testKey(id string, b byte) Key {
+	return Key{ID: id, Secret: bytes.Repeat([]byte{b}, 32)}
+}
+
+func TestEncryptedFS(t *testing.T) {
+	mem := vfs.NewMem()
+	keys, err := NewKeyRing(testKey("k1", 1))
+	require.NoError(t, err)
+	fs := New(mem, keys)
+
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	f, err := fs.Create("a", vfs.WriteCategoryUnspecified)
+	require.NoError(t, err)
+	// Write in pieces that are not aligned to the AES block size.
+	for _, p := range [][]byte{data[:7], data[7:100], data[100:]} {
+		written := bytes.Clone(p)
+		n, err := f.Write(p)
+		require.NoError(t, err)
+		require.Equal(t, len(p), n)
+		require.Equal(t, written, p)
+	}
+	require.NoError(t, f.Close())
+
+	// The underlying file holds the header and the ciphertext.
+	raw, err := mem.Open("a")
+	require.NoError(t, err)
+	rawData, err := io.ReadAll(raw)
+	require.NoError(t, err)
+	require.NoError(t, raw.Close())
+	require.Len(t, rawData, HeaderLen+len(data))
+	require.NotEqual(t, data, rawData[HeaderLen:])
+
+	info, err := fs.Stat("a")
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), info.Size())
+
+	f, err = fs.Open("a")
+	require.NoError(t, err)
+	got, err := io.ReadAll(f)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+	for _, off := range []int64{0, 1, 15, 16, 17, 511, 999} {
+		p := make([]byte, 50)
+		n, err := f.ReadAt(p, off)
+		if off+50 > int64(len(data)) {
+			require.Equal(t, io.EOF, err)
+		} else {
+			require.NoError(t, err)
+		}
+		require.Equal(t, data[off:off+int64(n)], p[:n])
+	}
+	info, err = f.Stat()
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), info.Size())
+	require.NoError(t, f.Close())
+
+	// After rotation, new files use the new key and old files remain
+	// readable while the old key is known.
+	require.NoError(t, keys.Rotate(testKey("k2", 2)))
+	f, err = fs.Create("b", vfs.WriteCategoryUnspecified)
+	require.NoError(t, err)
+	_, err = f.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	ids, err := fs.KeyIDs("")
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"k1": 1, "k2": 1}, ids)
+
+	require.NoError(t, keys.Remove("k1"))
+	_, err = fs.Open("a")
+	require.ErrorContains(t, err, `unknown encryption key "k1"`)
+	f, err = fs.Open("b")
+	require.NoError(t, err)
+	got, err = io.ReadAll(f)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+	require.NoError(t, f.Close())
+
+	// A file cannot be overwritten in place, nor written past its end, and
+	// cannot be opened for read-write.
+	f, err = fs.Create("d", vfs.WriteCategoryUnspecified)
+	require.NoError(t, err)
+	_, err = f.Write(data[:10])
+	require.NoError(t, err)
+	_, err = f.WriteAt(data[:10], 5)
+	require.ErrorContains(t, err, "not at its end")
+	_, err = f.WriteAt(data[:10], 11)
+	require.ErrorContains(t, err, "not at its end")
+	_, err = f.WriteAt(data[10:20], 10)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	_, err = fs.OpenReadWrite("d", vfs.WriteCategoryUnspecified)
+	require.ErrorContains(t, err, "cannot be opened for read-write")
+
+	// A reused file is truncated and given a new header, so that rewriting
+	// an offset with the same data yields different ciphertext.
+	readRaw := func(name string) []byte {
+		f, err := mem.Open(name)
+		require.NoError(t, err)
+		defer f.Close()
+		b, err := io.ReadAll(f)
+		require.NoError(t, err)
+		return b
+	}
+	oldRaw := readRaw("b")
+	f, err = fs.ReuseForWrite("b", "c", vfs.WriteCategoryUnspecified)
+	require.NoError(t, err)
+	_, err = f.Write(data[:10])
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	newRaw := readRaw("c")
+	require.Len(t, newRaw, HeaderLen+10)
+	require.NotEqual(t, oldRaw[:ivOffset+aes.BlockSize], newRaw[:ivOffset+aes.BlockSize])
+	require.NotEqual(t, oldRaw[HeaderLen:HeaderLen+10], newRaw[HeaderLen:])
+	f, err = fs.Open("c")
+	require.NoError(t, err)
+	got, err = io.ReadAll(f)
+	require.NoError(t, err)
+	require.Equal(t, data[:10], got)
+	require.NoError(t, f.Close())
+
+	// An empty file, as left behind by a crash after its creation, reads as
+	// empty.
+	f, err = mem.Create("empty", vfs.WriteCategoryUnspecified)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	f, err = fs.Open("empty")
+	require.NoError(t, err)
+	got, err = io.ReadAll(f)
+	require.NoError(t, err)
+	require.Empty(t, got)
+	require.NoError(t, f.Close())
+
+	// A file written without encryption cannot be read.
+	f, err = mem.Create("plain", vfs.WriteCategoryUnspecified)
+	require.NoError(t, err)
+	_, err = f.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	_, err = fs.Open("plain")
+	require.ErrorContains(t, err, "file is not encrypted")
+}
+
+func TestKeyRing(t *testing.T) {
+	_, err := NewKeyRing(Key{ID: "short", Secret: []byte("too short")})
+	require.ErrorContains(t, err, "invalid key size")
+	_, err = NewKeyRing(Key{ID: string(bytes.Repeat([]byte("x"), MaxKeyIDLen+1)), Secret: make([]byte, 16)})
+	require.ErrorContains(t, err, "must be between 1 and 40 bytes")
+
+	var r KeyRing
+	_, err = r.ActiveKey()
+	require.ErrorContains(t, err, "no active encryption key")
+	require.NoError(t, r.Rotate(testKey("k1", 1)))
+	require.ErrorContains(t, r.Remove("k1"), "cannot remove the active encryption key")
+	require.NoError(t, r.Rotate(testKey("k2", 2)))
+	// A known key may be made active again, but not with a different secret.
+	require.ErrorContains(t, r.Rotate(testKey("k1", 3)), `encryption key "k1" already exists with a different secret`)
+	require.NoError(t, r.Rotate(testKey("k1", 1)))
+	require.NoError(t, r.Rotate(testKey("k2", 2)))
+	k, err := r.ActiveKey()
+	require.NoError(t, err)
+	require.Equal(t, "k2", k.ID)
+	require.NoError(t, r.Remove("k1"))
+	_, err = r.GetKey("k1")
+	require.ErrorContains(t, err, `unknown encryption key "k1"`)
+}
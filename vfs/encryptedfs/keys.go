@@ -0,0 +1,137 @@
+// Copyright 2024 The LevelDB-Go and Pebble Authors. All rights reserved. Use
+// of this source code is governed by a BSD-style license that can be found in
+// the LICENSE file.
+
+package encryptedfs
+
+import (
+	"bytes"
+	"crypto/aes"
+	"sync"
+
+	"github.com/cockroachdb/errors"
+)
+
+// MaxKeyIDLen is the maximum length of a Key's ID, which is recorded in the
+// header of every file encrypted with the key.
+const MaxKeyIDLen = 40
+
+// Key is an AES key together with the ID under which it is known to a
+// KeyManager.
+type Key struct {
+	// ID identifies the key. It is stored in plaintext in the header of each
+	// file encrypted with the key, and must be at most MaxKeyIDLen bytes long.
+	ID string
+	// Secret is the AES key material. It must be 16, 24 or 32 bytes long,
+	// selecting AES-128, AES-192 or AES-256 respectively.
+	Secret []byte
+}
+
+// validate returns an error if the key cannot be used to encrypt files.
+func (k *Key) validate() error {
+	if len(k.ID) == 0 || len(k.ID) > MaxKeyIDLen {
+		return errors.Newf("pebble: encryption key ID %q must be between 1 and %d bytes", k.ID, MaxKeyIDLen)
+	}
+	if _, err := aes.NewCipher(k.Secret); err != nil {
+		return errors.Wrapf(err, "pebble: encryption key %q", k.ID)
+	}
+	return nil
+}
+
+// KeyManager provides the keys with which an encrypted FS encrypts and
+// decrypts files. Implementations may be backed by an external key management
+// service, and must be safe for concurrent use.
+//
+// Keys are rotated by changing the key returned by ActiveKey: files created
+// after the rotation are encrypted with the new key, while existing files
+// remain readable for as long as GetKey continues to return the key they were
+// written with. Since Pebble rewrites sstables through compactions and
+// replaces its WAL and MANIFEST files over time, data written under a retired
+// key eventually disappears; FS.KeyIDs reports which keys are still in use.
+type KeyManager interface {
+	// ActiveKey returns the key with which newly created files are encrypted.
+	ActiveKey() (Key, error)
+	// GetKey returns the key with the given ID, which is used to decrypt
+	// existing files.
+	GetKey(id string) (Key, error)
+}
+
+// KeyRing is a KeyManager that holds its keys in memory. It is useful for
+// tests and for applications that load their keys from elsewhere at startup.
+type KeyRing struct {
+	mu struct {
+		sync.RWMutex
+		keys   map[string]Key
+		active string
+	}
+}
+
+var _ KeyManager = (*KeyRing)(nil)
+
+// NewKeyRing returns a KeyRing holding the given keys. The last key is the
+// active one.
+func NewKeyRing(keys ...Key) (*KeyRing, error) {
+	r := &KeyRing{}
+	r.mu.keys = make(map[string]Key)
+	for _, k := range keys {
+		if err := r.Rotate(k); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Rotate adds the given key to the ring, if it is not already present, and
+// makes it the active key. Previously added keys remain available for reading
+// existing files. A key whose ID is already present with a different secret
+// is rejected, as files encrypted under that ID would otherwise silently
+// decrypt to garbage.
+func (r *KeyRing) Rotate(k Key) error {
+	if err := k.validate(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.mu.keys == nil {
+		r.mu.keys = make(map[string]Key)
+	}
+	if old, ok := r.mu.keys[k.ID]; ok && !bytes.Equal(old.Secret, k.Secret) {
+		return errors.Newf("pebble: encryption key %q already exists with a different secret", k.ID)
+	}
+	r.mu.keys[k.ID] = Key{ID: k.ID, Secret: bytes.Clone(k.Secret)}
+	r.mu.active = k.ID
+	return nil
+}
+
+// Remove removes the key with the given ID from the ring. Files encrypted
+// with it can no longer be read. The active key cannot be removed.
+func (r *KeyRing) Remove(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if id == r.mu.active {
+		return errors.Newf("pebble: cannot remove the active encryption key %q", id)
+	}
+	delete(r.mu.keys, id)
+	return nil
+}
+
+// ActiveKey implements KeyManager.
+func (r *KeyRing) ActiveKey() (Key, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.mu.active == "" {
+		return Key{}, errors.New("pebble: no active encryption key")
+	}
+	return r.mu.keys[r.mu.active], nil
+}
+
+// GetKey implements KeyManager.
+func (r *KeyRing) GetKey(id string) (Key, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	k, ok := r.mu.keys[id]
+	if !ok {
+		return Key{}, errors.Newf("pebble: unknown encryption key %q", id)
+	}
+	return k, nil
+}
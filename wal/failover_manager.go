@@ -625,6 +625,8 @@ func (wm *failoverManager) Create(wn NumWAL, jobID int) (Writer, error) {
 		minSyncInterval:             wm.opts.MinSyncInterval,
 		fsyncLatency:                wm.opts.FsyncLatency,
 		queueSemChan:                wm.opts.QueueSemChan,
+		compression:                 wm.opts.compression(),
+		syncCallback:                wm.opts.syncCallback(wn),
 		stopper:                     wm.stopper,
 		failoverWriteAndSyncLatency: wm.opts.FailoverWriteAndSyncLatency,
 		writerClosed:                wm.writerClosed,
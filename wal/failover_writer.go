@@ -456,6 +456,8 @@ type failoverWriterOpts struct {
 	minSyncInterval func() time.Duration
 	fsyncLatency    prometheus.Histogram
 	queueSemChan    chan struct{}
+	compression     record.Compression
+	syncCallback    record.SyncCallback
 	stopper         *stopper
 
 	failoverWriteAndSyncLatency prometheus.Histogram
@@ -632,6 +634,8 @@ func (ww *failoverWriter) switchToNewDir(dir dirAndFileHandle) error {
 				WALFsyncLatency:           ww.opts.fsyncLatency,
 				QueueSemChan:              ww.opts.queueSemChan,
 				ExternalSyncQueueCallback: ww.doneSyncCallback,
+				Compression:               ww.opts.compression,
+				WALSyncCallback:           ww.opts.syncCallback,
 			})
 		closeWriter := func() bool {
 			ww.mu.Lock()
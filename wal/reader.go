@@ -19,6 +19,12 @@ import (
 	"github.com/cockroachdb/pebble/vfs"
 )
 
+// ErrShortRecord marks the corruption error returned by Reader.NextRecord for
+// an intact record that is too short to hold a batch header. The reader
+// remains positioned after the record, so a caller that tolerates such
+// corruption may skip the record by calling NextRecord again.
+var ErrShortRecord = errors.New("pebble: WAL record too short to hold a batch header")
+
 // A LogicalLog identifies a logical WAL and its consituent segment files.
 type LogicalLog struct {
 	Num NumWAL
@@ -306,11 +312,11 @@ func (r *virtualWALReader) NextRecord() (io.Reader, Offset, error) {
 			// envelope successfully decoded and the checkums of the individual
 			// record fragment(s) validated, so the writer truly wrote an
 			// invalid batch. During Open WAL recovery treats this as
-			// corruption. We could return the record to the caller, allowing
+			// corruption, unless it skips corrupted records. We could return the record to the caller, allowing
 			// the caller to interpret it as corruption, but it seems safer to
 			// be explicit and surface the corruption error here.
-			return nil, r.off, base.CorruptionErrorf("pebble: corrupt log file logNum=%d, logNameIndex=%s: invalid batch",
-				r.Num, errors.Safe(r.segments[r.currIndex].logNameIndex))
+			return nil, r.off, errors.Mark(base.CorruptionErrorf("pebble: corrupt log file logNum=%d, logNameIndex=%s: invalid batch",
+				r.Num, errors.Safe(r.segments[r.currIndex].logNameIndex)), ErrShortRecord)
 		}
 
 		// There's a subtlety necessitated by LogData operations. A LogData
@@ -338,6 +344,13 @@ func (r *virtualWALReader) NextRecord() (io.Reader, Offset, error) {
 	}
 }
 
+// Recover implements Reader.Recover.
+func (r *virtualWALReader) Recover() {
+	if r.currReader != nil {
+		r.currReader.Recover()
+	}
+}
+
 // Close closes the reader, releasing open resources.
 func (r *virtualWALReader) Close() error {
 	if r.currFile != nil {
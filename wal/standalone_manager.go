@@ -197,6 +197,8 @@ func (m *StandaloneManager) Create(wn NumWAL, jobID int) (Writer, error) {
 		WALFsyncLatency:    m.o.FsyncLatency,
 		WALMinSyncInterval: m.o.MinSyncInterval,
 		QueueSemChan:       m.o.QueueSemChan,
+		Compression:        m.o.compression(),
+		WALSyncCallback:    m.o.syncCallback(wn),
 	})
 	m.w = &standaloneWriter{
 		m: m,
@@ -121,6 +121,10 @@ type Options struct {
 
 	// MinSyncInterval is documented in Options.WALMinSyncInterval.
 	MinSyncInterval func() time.Duration
+	// Compression returns the algorithm with which the records of a new WAL are
+	// compressed. It is consulted when the WAL is created, and may be nil, in
+	// which case records are not compressed.
+	Compression func() record.Compression
 	// FsyncLatency records fsync latency. This doesn't differentiate between
 	// fsyncs on the primary and secondary dir.
 	//
@@ -170,6 +174,14 @@ func (o *Options) Dirs() []Dir {
 	return []Dir{o.Primary, o.Secondary}
 }
 
+// compression returns the compression algorithm for a new WAL.
+func (o *Options) compression() record.Compression {
+	if o.Compression == nil {
+		return record.NoCompression
+	}
+	return o.Compression()
+}
+
 // FailoverOptions are options that are specific to failover mode.
 type FailoverOptions struct {
 	// PrimaryDirProbeInterval is the interval for probing the primary dir, when
@@ -236,6 +248,10 @@ func (o *FailoverOptions) EnsureDefaults() {
 type EventListener interface {
 	// LogCreated informs the listener of a log file creation.
 	LogCreated(CreateInfo)
+	// LogSynced informs the listener of a sync of a log file. It is invoked
+	// from the goroutine performing the sync, and delays the completion of the
+	// sync, so it must return quickly (see record.SyncCallback).
+	LogSynced(SyncInfo)
 }
 
 // CreateInfo contains info about a log file creation event.
@@ -259,6 +275,28 @@ type CreateInfo struct {
 	Err error
 }
 
+// SyncInfo contains info about a log file sync event.
+type SyncInfo struct {
+	// Num is the WAL number.
+	Num NumWAL
+	// Duration is the time spent syncing the log file.
+	Duration time.Duration
+	// Err contains any error.
+	Err error
+}
+
+// syncCallback returns the record.SyncCallback that informs the listener of
+// the syncs of a log file for the WAL wn, or nil if there is no listener.
+func (o *Options) syncCallback(wn NumWAL) record.SyncCallback {
+	if o.EventListener == nil {
+		return nil
+	}
+	l := o.EventListener
+	return func(duration time.Duration, err error) {
+		l.LogSynced(SyncInfo{Num: wn, Duration: duration, Err: err})
+	}
+}
+
 // Stats exposes stats used in Pebble metrics.
 //
 // NB: Metrics.WAL.{Size,BytesIn,BytesWritten} are not maintained by the wal
@@ -411,6 +449,12 @@ type Reader interface {
 	// are no more records. The reader returned becomes stale after the next Next
 	// call, and should no longer be used.
 	NextRecord() (io.Reader, Offset, error)
+	// Recover clears the error returned by the most recent call to NextRecord,
+	// if it was an invalid record (see record.IsInvalidRecord), so that the
+	// next call to NextRecord resumes reading at the next intact 32KiB block of
+	// the current physical file. The record that failed to be read, and any
+	// others within the rest of its block, are skipped.
+	Recover()
 	// Close the reader.
 	Close() error
 }